@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DefaultBatchConcurrency is the maximum number of concurrent provider calls
+// made by a single batch lookup if no other limit is configured.
+const DefaultBatchConcurrency = 8
+
+// A LookupError is returned by the batch lookup methods if any of the IDs
+// could not be looked up, mapping each such ID to its error.
+type LookupError map[string]error
+
+func (e LookupError) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = id + ": " + e[id].Error()
+	}
+	return fmt.Sprintf("cache: lookup of %d IDs failed: %s", len(ids), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error of every failed ID.
+func (e LookupError) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Is returns true if the error of any failed ID matches target, such that
+// errors.Is(err, ErrMissing) reports whether any ID was missing.
+func (e LookupError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error of a failed ID, in order of ID, which matches
+// target, as errors.As.
+func (e LookupError) As(target interface{}) bool {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if errors.As(e[id], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Channels looks up every channel in IDs, returning the channels found keyed
+// by ID. Cached channels are returned without calling the provider, and the
+// rest are fetched concurrently, with at most a limited number of provider
+// calls in flight at once (see WithBatchConcurrency). If any channel could not
+// be looked up, the channels which could are returned along with a
+// LookupError.
+func (c *Cache) Channels(IDs []string) (map[string]discordgo.Channel, error) {
+	return c.ChannelsContext(context.Background(), IDs)
+}
+
+// ChannelsContext is like Channels, but each lookup is made with ctx.
+func (c *Cache) ChannelsContext(ctx context.Context, IDs []string) (map[string]discordgo.Channel, error) {
+	return batch(ctx, c.batchConcurrency, IDs, c.ChannelContext)
+}
+
+// Users is like Channels, but looks up users.
+func (c *Cache) Users(IDs []string) (map[string]discordgo.User, error) {
+	return c.UsersContext(context.Background(), IDs)
+}
+
+// UsersContext is like Users, but each lookup is made with ctx.
+func (c *Cache) UsersContext(ctx context.Context, IDs []string) (map[string]discordgo.User, error) {
+	return batch(ctx, c.batchConcurrency, IDs, c.UserContext)
+}
+
+// Guilds is like Channels, but looks up guilds.
+func (c *Cache) Guilds(IDs []string) (map[string]discordgo.Guild, error) {
+	return c.GuildsContext(context.Background(), IDs)
+}
+
+// GuildsContext is like Guilds, but each lookup is made with ctx.
+func (c *Cache) GuildsContext(ctx context.Context, IDs []string) (map[string]discordgo.Guild, error) {
+	return batch(ctx, c.batchConcurrency, IDs, c.GuildContext)
+}
+
+// batch looks up every distinct ID in IDs with lookup, running at most limit
+// lookups at once.
+func batch[T any](ctx context.Context, limit int, IDs []string, lookup func(context.Context, string) (T, error)) (map[string]T, error) {
+	var (
+		mu    sync.Mutex
+		found = make(map[string]T, len(IDs))
+		errs  = make(LookupError)
+	)
+
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	seen := make(map[string]bool, len(IDs))
+	for _, id := range IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			v, err := lookup(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[id] = err
+				return
+			}
+			found[id] = v
+		}(id)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return found, errs
+	}
+	return found, nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SlowProvider is a MockProvider whose user lookups take a while, recording
+// the most lookups in flight at once.
+type SlowProvider struct {
+	MockProvider
+	inflight, peak int32
+}
+
+func (p *SlowProvider) User(userID string) (*discordgo.User, error) {
+	n := atomic.AddInt32(&p.inflight, 1)
+	defer atomic.AddInt32(&p.inflight, -1)
+	for {
+		peak := atomic.LoadInt32(&p.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&p.peak, peak, n) {
+			break
+		}
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if userID == "5678" {
+		return p.MockProvider.User(userID)
+	}
+	return &discordgo.User{ID: userID}, nil
+}
+
+func TestBatch(t *testing.T) {
+	p := &SlowProvider{}
+	c := NewCache(p, WithBatchConcurrency(2))
+
+	IDs := []string{"5678", "a", "b", "c", "d", "5678"}
+	users, err := c.Users(IDs)
+	if err != nil {
+		t.Fatal("Unexpected error from batch user retrieval:", err)
+	}
+	if len(users) != 5 || users["5678"].Username != "Testing User" {
+		t.Errorf("wrong users returned from batch: %v", users)
+	}
+	if p.peak > 2 {
+		t.Errorf("batch exceeded concurrency limit\nexpect: 2\ngot: %d", p.peak)
+	}
+	if s := c.Stats().User; s.Misses != 5 {
+		t.Errorf("duplicate ID was looked up twice\nexpect misses: 5\ngot: %d", s.Misses)
+	}
+
+	// Partial failure
+	channels, err := c.Channels([]string{"1234", "abcd"})
+	var lerr LookupError
+	if !errors.As(err, &lerr) || len(lerr) != 1 || lerr["abcd"] != ErrMissing {
+		t.Fatalf("wrong error from partial batch failure: %v", err)
+	}
+	if _, ok := channels["1234"]; !ok || len(channels) != 1 {
+		t.Errorf("wrong channels returned from partial batch: %v", channels)
+	}
+	if !errors.Is(err, ErrMissing) {
+		t.Error("ID errors were not matched by errors.Is:", err)
+	}
+	var rerr *discordgo.RESTError
+	if !errors.As(LookupError{"1": errBroken, "2": notFoundError(10003)}, &rerr) {
+		t.Error("ID errors were not matched by errors.As")
+	}
+}
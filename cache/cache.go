@@ -1,7 +1,10 @@
 // Package cache implements a simple cache of Discord objects which require a
 // remote API or web request such that their details be discovered. It can also
-// be used to cache web requests to the Discord CDN. It is not designed to be
-// concurrency safe.
+// be used to cache web requests to the Discord CDN. All Cache methods are safe
+// for concurrent use; lookups which hit the cache only take a shared lock, so
+// concurrent hits never serialize behind one another. The channel, user, guild
+// and member caches are further split into shards (see WithShards), such that
+// lookups of unrelated IDs do not contend for the same lock.
 //
 // The Cache object takes a provider as its main source of truth, being an
 // abstract representation of the Discord API. Out of the box, it is intended
@@ -10,135 +13,895 @@
 package cache
 
 import (
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/time/rate"
 )
 
 // Generic errors.
 var (
-	ErrMissing     = errors.New("cache: entry not present")
-	ErrNilProvider = errors.New("cache: attempted to create cache with nil provider")
-	ErrIO          = errors.New("cache: attachment download: I/O error")
-	ErrRequest     = errors.New("cache: attachment download: network request failed")
-	ErrGetFailed   = errors.New("cache: attachment download: http error")
+	ErrMissing        = errors.New("cache: entry not present")
+	ErrNilProvider    = errors.New("cache: attempted to create cache with nil provider")
+	ErrIO             = errors.New("cache: attachment download: I/O error")
+	ErrRequest        = errors.New("cache: attachment download: network request failed")
+	ErrGetFailed      = errors.New("cache: attachment download: http error")
+	ErrTooLarge       = errors.New("cache: attachment download: attachment too large")
+	ErrDisallowedType = errors.New("cache: attachment download: content type not allowed")
+	ErrNotFound       = errors.New("cache: object does not exist")
+	ErrUnsupported    = errors.New("cache: operation not supported by provider")
+	ErrCorrupt        = errors.New("cache: attachment content does not match its checksum")
 )
 
+// wrapError is an error of a generic kind (one of the errors above) caused by
+// a more specific underlying error. It matches both with errors.Is.
+type wrapError struct {
+	kind, err error
+}
+
+func (w wrapError) Error() string {
+	return w.kind.Error() + ": " + w.err.Error()
+}
+
+func (w wrapError) Is(target error) bool {
+	return target == w.kind
+}
+
+func (w wrapError) Unwrap() error {
+	return w.err
+}
+
+// statusError is the unsuccessful HTTP status of an attachment download,
+// wrapped as ErrGetFailed.
+type statusError int
+
+func (s statusError) Error() string {
+	return strconv.Itoa(int(s)) + " " + http.StatusText(int(s))
+}
+
 // Cache cleanup constants.
 const (
-	// Approximate maximum lifetime an attachment can live for without being cleaned up.
+	// Approximate maximum lifetime an attachment can live for without being
+	// cleaned up, unless configured otherwise with WithAttachmentLifetime.
 	AttachmentLifetime = time.Minute * 5
-	// Threshold at which the attachments cache will begin to prune excess elements.
+	// Threshold at which the attachments cache will begin to prune excess
+	// elements, unless configured otherwise with
+	// WithAttachmentPruneThreshold.
 	AttachmentPruneThreshold = 1000
 )
 
-// Cache represents a cache of Discord API data objects.
+// DefaultHTTPTimeout is the per-request timeout of the HTTP client used for
+// attachment downloads if no other client is configured.
+const DefaultHTTPTimeout = time.Second * 30
+
+// DefaultMaxConnsPerHost is the maximum number of connections the HTTP client
+// used for attachment downloads opens to a single host if no other client or
+// limit is configured. As attachments are all served by the Discord CDN, this
+// bounds the connections opened by the cache as a whole.
+const DefaultMaxConnsPerHost = 16
+
+// Connection reuse settings of transports from NewTransport. Idle connections
+// to the CDN are kept for DefaultIdleConnTimeout, and TCP keep-alives are sent
+// on open connections every DefaultKeepAlive.
+const (
+	DefaultIdleConnTimeout = time.Second * 90
+	DefaultKeepAlive       = time.Second * 30
+)
+
+// NewTransport returns an HTTP transport suited to downloading attachments
+// from the Discord CDN, opening at most maxConnsPerHost connections to a
+// single host and keeping as many idle for reuse, such that repeated downloads
+// skip the TCP and TLS handshakes. HTTP/2 is attempted, multiplexing downloads
+// over fewer connections where the CDN supports it. A single transport may be
+// shared between the clients of several caches (see WithHTTPClient) to bound
+// their connections together. A maxConnsPerHost of zero means no limit, in
+// which case up to DefaultMaxConnsPerHost connections are kept idle.
+func NewTransport(maxConnsPerHost int) *http.Transport {
+	idle := maxConnsPerHost
+	if idle <= 0 {
+		idle = DefaultMaxConnsPerHost
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{
+		Timeout:   DefaultHTTPTimeout,
+		KeepAlive: DefaultKeepAlive,
+	}).DialContext
+	t.ForceAttemptHTTP2 = true
+	t.MaxConnsPerHost = maxConnsPerHost
+	t.MaxIdleConnsPerHost = idle
+	if t.MaxIdleConns < idle {
+		t.MaxIdleConns = idle
+	}
+	t.IdleConnTimeout = DefaultIdleConnTimeout
+
+	return t
+}
+
+// DefaultMaxAttachmentSize is the maximum size of a downloaded attachment if no
+// other limit is configured, mirroring Discord's own upload limit.
+const DefaultMaxAttachmentSize = 25 * 1024 * 1024
+
+// Default attachment download retry policy (see WithRetry).
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryDelay    = time.Millisecond * 250
+)
+
+// DefaultTTL is the time to live of cached channels, users, guilds, members,
+// guild roles and guild emojis if no other TTL is configured.
+const DefaultTTL = time.Minute * 10
+
+// NeverExpire may be given as the TTL of a single entry (see
+// SetChannelWithTTL) to keep the entry until it is invalidated or evicted to
+// make room for others.
+const NeverExpire time.Duration = -1
+
+// An ObjectType identifies one of the types of object held by a Cache.
+type ObjectType int
+
+// Cached object types.
+const (
+	TypeChannel ObjectType = iota
+	TypeUser
+	TypeGuild
+	TypeAttachment
+	TypeMember
+	TypeRole
+	TypeEmoji
+	TypeSticker
+	TypeMessage
+	TypeHistory
+)
+
+func (t ObjectType) String() string {
+	switch t {
+	case TypeChannel:
+		return "channel"
+	case TypeUser:
+		return "user"
+	case TypeGuild:
+		return "guild"
+	case TypeAttachment:
+		return "attachment"
+	case TypeMember:
+		return "member"
+	case TypeRole:
+		return "role"
+	case TypeEmoji:
+		return "emoji"
+	case TypeSticker:
+		return "sticker"
+	case TypeMessage:
+		return "message"
+	case TypeHistory:
+		return "history"
+	default:
+		return "unknown"
+	}
+}
+
+// Cache represents a cache of Discord API data objects. It is safe for
+// concurrent use by multiple goroutines. Objects are copied when they are
+// cached and returned by value, so neither the provider nor callers can change
+// a cached object by mutating their own copy of it. The copies are shallow,
+// however, so the slices, maps and pointers within an object must still be
+// treated as read-only.
+//
+// Lookups through the Context methods which miss the cache, calling the
+// provider or downloading an attachment, are traced with OpenTelemetry as a
+// child of the span in the context, using that span's tracer. If the context
+// carries no recording span, nothing is traced.
 type Cache struct {
-	provider        Provider
-	channelCache    map[string]*discordgo.Channel
-	userCache       map[string]*discordgo.User
-	guildCache      map[string]*discordgo.Guild
+	provider   Provider
+	opts       []Option
+	shards     int
+	httpClient *http.Client
+	// Connection limit of the default HTTP client.
+	maxConnsPerHost int
+
+	channels *objectCache[discordgo.Channel]
+	users    *objectCache[discordgo.User]
+	guilds   *objectCache[discordgo.Guild]
+	members  *objectCache[discordgo.Member]
+	// Role sets, keyed by guild ID.
+	roles *objectCache[roleSet]
+	// Emoji sets, keyed by guild ID.
+	emojis   *objectCache[emojiSet]
+	stickers *objectCache[discordgo.Sticker]
+	// Messages, keyed by channel and message ID.
+	messages *objectCache[discordgo.Message]
+	// Recent message histories, keyed by channel ID, and the number of
+	// messages kept in each.
+	histories    *objectCache[history]
+	historyLimit int
+	// historyMu serialises updates of histories from events, and their
+	// insertion by lookups.
+	historyMu sync.Mutex
+
+	channelTTL, userTTL, guildTTL, memberTTL, roleTTL, emojiTTL, stickerTTL, messageTTL, historyTTL time.Duration
+	channelMax, userMax, guildMax, memberMax, roleMax, emojiMax, stickerMax, messageMax, historyMax int
+	// Maximum number of cached members of each guild, or zero if unbounded.
+	guildMemberMax int
+	// Estimated size above which guilds are trimmed before being cached,
+	// or zero if never, and the function trimming them.
+	maxGuildBytes int64
+	guildTrim     func(g *discordgo.Guild)
+	// Maximum fraction by which the TTL of each entry is randomly adjusted.
+	ttlJitter float64
+	// Interval after which cached attachments are revalidated, or zero to
+	// never revalidate.
+	attachmentTTL time.Duration
+	// Backend of the tables above, or nil to store them in memory.
+	store Store
+	// Maximum concurrent lookups made by a batch lookup.
+	batchConcurrency int
+	// Maximum concurrent downloads made by PrefetchAttachments.
+	prefetchConcurrency int
+	// Rate limit of the provider calls made by WarmUsers.
+	warmRate    rate.Limit
+	warmBurst   int
+	warmLimiter *rate.Limiter
+
+	// Negative cache of flight keys to the time until which they are known
+	// not to exist, either from a lookup or a deletion event.
+	missing      *shardMap[time.Time]
+	negativeTTL  time.Duration
+	tombstoneTTL time.Duration
+
+	// mu guards the attachment cache and its accounting. Downloads are
+	// made without holding mu, and paths which only read the attachment
+	// cache, such as HasAttachment, take only its read lock.
+	mu              sync.RWMutex
 	attachmentCache map[string]*Attachment
+	// Keys of cached attachments by checksum.
+	checksums map[[sha256.Size]byte]map[string]bool
+	// Running total of len(Content) over attachmentCache.
+	attachmentBytes int64
+	// Running total of len(Content) over the attachments held in memory,
+	// rather than backed by disk.
+	attachmentMemory int64
+	// Cached attachments by last reference, and those with signed urls by
+	// expiry, so that Clean need not walk the whole attachment cache.
+	byReference, byExpiry *attachmentHeap
+	// Heap of attachments by value if evicted by an LFU policy, or nil.
+	byValue *attachmentHeap
+	// Attachment eviction policy, and the half-life and epoch of reference
+	// counts under an LFU policy.
+	evictionPolicy EvictionPolicy
+	lfuHalfLife    time.Duration
+	lfuEpoch       time.Time
+	// Byte budget enforced by Clean, or zero for no budget.
+	maxAttachmentBytes int64
+	// Time since last reference after which Clean evicts an attachment.
+	attachmentLifetime time.Duration
+	// Number of attachments above which Clean evicts the least recently
+	// referenced.
+	attachmentPruneThreshold int
+	// Directory backing the attachment cache, or empty to hold attachments
+	// in memory.
+	attachmentDir string
+	// Allowed media types of downloads, or empty to allow any. Entries may
+	// be wildcards such as "image/*".
+	allowedTypes []string
+	// Size limit of a single download, or zero for no limit.
+	maxAttachmentSize int64
+	// Size from which attachment content held in memory is compressed, or
+	// zero to never compress.
+	compressThreshold int64
+	// Key of each attachment, or nil to key attachments by url.
+	attachmentKey AttachmentKeyFunc
+	// Directory of attachments deposited by others, read before the CDN,
+	// and the function finding each attachment within it.
+	mirrorDir  string
+	mirrorPath MirrorFunc
+	// Whether downloaded attachments are retained (see
+	// WithAttachmentCaching).
+	attachmentCaching bool
+	// Object types whose caches are disabled (see WithDisabledTypes).
+	disabled map[ObjectType]bool
+	// Object types invalidated on reconnecting to the gateway, and whether
+	// the session has disconnected since it last connected.
+	resumeFlush, readyFlush []ObjectType
+	disconnected            atomic.Bool
+	// Budget of the hot tier of attachments held in memory, or zero if the
+	// attachment cache is not tiered.
+	hotAttachmentBytes int64
+	// Keys of attachments of the cold tier referenced since the last Clean,
+	// to be promoted to the hot tier.
+	promote map[string]bool
+	// Download retry policy.
+	retryAttempts int
+	retryDelay    time.Duration
+
+	channelStats, userStats, guildStats, memberStats  counters
+	roleStats, emojiStats, stickerStats, messageStats counters
+	historyStats, attachmentStats                     counters
+
+	onHit, onMiss, onInsert, onEvict Hook
+	logger                           Logger
+	clock                            Clock
+
+	// janitorMu guards the channels of the running janitor, which are nil
+	// if there is none.
+	janitorMu                sync.Mutex
+	janitorStop, janitorDone chan struct{}
+	// Whether the cache has been closed (see Close).
+	closed atomic.Bool
+	// Whether entries are walked and evicted in order of key (see
+	// WithDeterministicOrder).
+	deterministic bool
+	// Whether users are indexed by name (see WithUserNameIndex).
+	userNameIndex bool
+
+	// flight collapses concurrent misses for the same object into a single
+	// provider call or download. Keys are the object type, a colon and the
+	// ID (or URL for attachments).
+	flight flightGroup
+}
+
+// entry is a cached channel, user, guild, member, role set or emoji set along
+// with the time at which it was inserted.
+type entry[T any] struct {
+	val      *T
+	inserted time.Time
+	// ttl overrides the TTL of the entry's type if non-zero.
+	ttl time.Duration
+	// jitter is the fraction by which the TTL of the entry's type is
+	// lengthened or, if negative, shortened (see WithTTLJitter).
+	jitter float64
+}
+
+// newEntry creates an entry for a copy of val inserted at now, such that later
+// changes to *val do not affect the entry.
+func newEntry[T any](val *T, now time.Time) *entry[T] {
+	cp := *val
+	return &entry[T]{val: &cp, inserted: now}
+}
+
+// expired returns true if e has outlived its own TTL, if set, or otherwise ttl
+// adjusted by its jitter, at now. A zero or negative TTL never expires.
+func (e *entry[T]) expired(now time.Time, ttl time.Duration) bool {
+	if e.ttl != 0 {
+		ttl = e.ttl
+	} else if ttl > 0 && e.jitter != 0 {
+		ttl += time.Duration(float64(ttl) * e.jitter)
+	}
+	return ttl > 0 && now.Sub(e.inserted) > ttl
 }
 
 // An Attachment is a generic representation for an attachment downloaded from
 // the Discord API.
 type Attachment struct {
-	Name, Type    string
-	Content       []byte
+	// Type is the content type of the attachment: that sent by the CDN
+	// with a downloaded attachment, unless it is missing or generic, such
+	// as application/octet-stream, in which case it is sniffed from the
+	// content, falling back to the type given by the Discord API.
+	Name, Type string
+	// DeclaredType is the type given by the Discord API for a downloaded
+	// attachment if it disagrees with Type, or empty otherwise.
+	DeclaredType string
+	Content      []byte
+	// Path is the backing file of the attachment if the cache is backed by
+	// disk (see WithAttachmentDir), or empty if it is held in memory.
+	Path string
+	// Checksum is the SHA-256 of the content.
+	Checksum [sha256.Size]byte
+	// ETag and LastModified are the validators sent by the CDN with the
+	// content, if any, used to revalidate the attachment (see WithTTL).
+	ETag, LastModified string
+	// Expires is the time at which the signature of the attachment's url
+	// expires (see Expired), or zero if the url is not signed.
+	Expires       time.Time
 	LastReference time.Time
+
+	// Size of the backing file, as Content is not held in memory, or of the
+	// original content, if Content is compressed.
+	size int64
+	// Whether Content is compressed (see WithCompression).
+	compressed bool
+	// Time the content was last downloaded or revalidated.
+	validated time.Time
+	// Key of the attachment in the attachment cache, and its positions in
+	// the heaps of the cache (see attachmentHeap).
+	key                               string
+	refIndex, expiryIndex, valueIndex int
+	// Logarithm of the decayed reference count (see PolicyLFU).
+	score float64
+}
+
+// bytes returns the size of the content of a.
+func (a *Attachment) bytes() int64 {
+	if a.Path != "" {
+		return a.size
+	}
+
+	return int64(len(a.Content))
+}
+
+// contentSize returns the size of the original content of a, however it is
+// held.
+func (a *Attachment) contentSize() int64 {
+	if a.compressed {
+		return a.size
+	}
+
+	return a.bytes()
+}
+
+// memory returns the size of the content of a held in memory, which is zero
+// for a cached attachment backed by disk.
+func (a *Attachment) memory() int64 {
+	return int64(len(a.Content))
 }
 
 // Provider is a data provider for discord users and channels. This is mainly
 // for testing and is designed for use with either a mock or
-// *discordgo.Session.
+// *discordgo.Session. Lookups of other objects require the provider to also
+// implement the corresponding optional interface, such as MemberProvider, all
+// of which but StickerProvider *discordgo.Session implements. If it does not,
+// those lookups return ErrUnsupported.
 type Provider interface {
 	Channel(channelID string) (c *discordgo.Channel, err error)
 	User(userID string) (u *discordgo.User, err error)
 	Guild(guildID string) (st *discordgo.Guild, err error)
 }
 
-// NewCache creates a new cache object with provider p.
-func NewCache(p Provider) *Cache {
+// NewCache creates a new cache object with provider p, configured by any
+// options given.
+func NewCache(p Provider, opts ...Option) *Cache {
 	if p == nil {
 		panic(ErrNilProvider)
 	}
 
-	return &Cache{
-		provider:        p,
-		channelCache:    make(map[string]*discordgo.Channel),
-		userCache:       make(map[string]*discordgo.User),
-		guildCache:      make(map[string]*discordgo.Guild),
-		attachmentCache: make(map[string]*Attachment),
+	c := &Cache{
+		provider:                 p,
+		opts:                     opts,
+		shards:                   DefaultShards,
+		maxConnsPerHost:          DefaultMaxConnsPerHost,
+		channelTTL:               DefaultTTL,
+		userTTL:                  DefaultTTL,
+		guildTTL:                 DefaultTTL,
+		memberTTL:                DefaultTTL,
+		roleTTL:                  DefaultTTL,
+		emojiTTL:                 DefaultTTL,
+		stickerTTL:               DefaultTTL,
+		messageTTL:               DefaultTTL,
+		historyTTL:               DefaultTTL,
+		historyMax:               DefaultMaxHistories,
+		historyLimit:             DefaultHistoryLimit,
+		maxAttachmentSize:        DefaultMaxAttachmentSize,
+		attachmentLifetime:       AttachmentLifetime,
+		attachmentPruneThreshold: AttachmentPruneThreshold,
+		retryAttempts:            DefaultRetryAttempts,
+		retryDelay:               DefaultRetryDelay,
+		batchConcurrency:         DefaultBatchConcurrency,
+		prefetchConcurrency:      DefaultPrefetchConcurrency,
+		attachmentCaching:        true,
+		resumeFlush:              defaultResumeFlush,
+		readyFlush:               defaultReadyFlush,
+		warmRate:                 DefaultWarmRate,
+		warmBurst:                DefaultWarmBurst,
+		clock:                    realClock{},
+		attachmentCache:          make(map[string]*Attachment),
+		checksums:                make(map[[sha256.Size]byte]map[string]bool),
+		promote:                  make(map[string]bool),
+		byReference:              newReferenceHeap(),
+		byExpiry:                 newExpiryHeap(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{
+			Transport: NewTransport(c.maxConnsPerHost),
+			Timeout:   DefaultHTTPTimeout,
+		}
+	}
+
+	c.channels = newObjectCache[discordgo.Channel](c, TypeChannel, "channel", c.channelTTL, c.channelMax)
+	c.users = newObjectCache[discordgo.User](c, TypeUser, "user", c.userTTL, c.userMax)
+	if c.userNameIndex {
+		c.users.indexBy(func(_ string, u *discordgo.User) string { return nameGroup(u.Username) }, 0)
+	}
+	c.guilds = newObjectCache[discordgo.Guild](c, TypeGuild, "guild", c.guildTTL, c.guildMax)
+	if c.maxGuildBytes > 0 {
+		c.guilds.trim = c.trimGuild
 	}
+	c.channels.indexBy(func(_ string, ch *discordgo.Channel) string { return ch.GuildID }, 0)
+	c.members = newObjectCache[discordgo.Member](c, TypeMember, "member", c.memberTTL, c.memberMax)
+	c.members.indexBy(func(key string, _ *discordgo.Member) string {
+		k, _ := parseCompositeKey(key)
+		return k.parent
+	}, c.guildMemberMax)
+	c.roles = newObjectCache[roleSet](c, TypeRole, "roles", c.roleTTL, c.roleMax)
+	c.emojis = newObjectCache[emojiSet](c, TypeEmoji, "emojis", c.emojiTTL, c.emojiMax)
+	c.stickers = newObjectCache[discordgo.Sticker](c, TypeSticker, "sticker", c.stickerTTL, c.stickerMax)
+	c.messages = newObjectCache[discordgo.Message](c, TypeMessage, "message", c.messageTTL, c.messageMax)
+	c.histories = newObjectCache[history](c, TypeHistory, "history", c.historyTTL, c.historyMax)
+	c.histories.insertMu = &c.historyMu
+	c.missing = newShardMap[time.Time](c.shards, 0)
+	c.warmLimiter = rate.NewLimiter(c.warmRate, c.warmBurst)
+	if c.evictionPolicy != PolicyLRU {
+		c.byValue = newValueHeap(c.evictionPolicy == PolicyWeightedLFU)
+		c.lfuEpoch = c.now()
+	}
+	if c.deterministic {
+		for _, h := range []*attachmentHeap{c.byReference, c.byExpiry, c.byValue} {
+			if h != nil {
+				h.byKey()
+			}
+		}
+	}
+	return c
 }
 
 // Channel looks up and returns a channel's data from the discord API, or
-// returns the cached value if already found. If the channel could not be
-// found, error is returned from the discord API. Errors are not cached and
-// failed lookups cause a new API hit.
+// returns the cached value if already found and not older than the channel TTL
+// (see WithTTL). If the channel does not exist, an error matching ErrNotFound
+// and wrapping the error from the discord API is returned, while other errors
+// from the discord API are returned as is. Errors are not cached (but see
+// WithNegativeTTL) and failed lookups cause a new API hit, although concurrent
+// lookups of the same channel share a single in-flight request.
 func (c *Cache) Channel(ID string) (discordgo.Channel, error) {
-	if ch, ok := c.channelCache[ID]; ok {
-		return *ch, nil
+	return c.ChannelContext(context.Background(), ID)
+}
+
+// ChannelContext is like Channel, but stops waiting for the provider and
+// returns the context's error if ctx is done before the lookup completes. If
+// the provider is a ContextProvider, its call is also cancelled once no lookup
+// sharing it is left waiting.
+func (c *Cache) ChannelContext(ctx context.Context, ID string) (discordgo.Channel, error) {
+	v, _, err := c.ChannelCachedContext(ctx, ID)
+	return v, err
+}
+
+// User looks up and returns a user's data from the discord API, or returns the
+// cached value if already found and not older than the user TTL (see WithTTL).
+// If the user does not exist, an error matching ErrNotFound and wrapping the
+// error from the discord API is returned, while other errors from the discord
+// API are returned as is. Errors are not cached (but see WithNegativeTTL) and
+// failed lookups cause a new API hit, although concurrent lookups of the same
+// user share a single in-flight request.
+func (c *Cache) User(ID string) (discordgo.User, error) {
+	return c.UserContext(context.Background(), ID)
+}
+
+// UserContext is like User, but stops waiting for the provider and returns the
+// context's error if ctx is done before the lookup completes.
+func (c *Cache) UserContext(ctx context.Context, ID string) (discordgo.User, error) {
+	v, _, err := c.UserCachedContext(ctx, ID)
+	return v, err
+}
+
+// Guild looks up and returns a guild's data from the discord API, or returns
+// the cached value if already found and not older than the guild TTL (see
+// WithTTL). If the guild does not exist, an error matching ErrNotFound and
+// wrapping the error from the discord API is returned, while other errors from
+// the discord API are returned as is. Errors are not cached (but see
+// WithNegativeTTL) and failed lookups cause a new API hit, although concurrent
+// lookups of the same guild share a single in-flight request. The guild is
+// returned as fetched or seeded, so may lack its roles or channels (see
+// IsPartialGuild, GuildWithRoles and GuildWithChannels), and may have been
+// trimmed if it is large (see WithMaxGuildBytes).
+func (c *Cache) Guild(ID string) (discordgo.Guild, error) {
+	return c.GuildContext(context.Background(), ID)
+}
+
+// GuildContext is like Guild, but stops waiting for the provider and returns
+// the context's error if ctx is done before the lookup completes.
+func (c *Cache) GuildContext(ctx context.Context, ID string) (discordgo.Guild, error) {
+	v, _, err := c.GuildCachedContext(ctx, ID)
+	return v, err
+}
+
+// Attachment looks up and returns the content and info for a remote attachment
+// from the Discord API. Lookups from the same url are guaranteed not to cause
+// an API hit, and concurrent lookups of the same url share a single download:
+// a lookup made while the url is being downloaded blocks until the download
+// completes and is then served its content. Transient download failures are
+// retried as configured by WithRetry. Errors are not cached and the attachment
+// is assumed to not exist, so a later lookup of the url downloads it again.
+//
+// As a hit updates the reference time of the attachment, attachment lookups
+// take an exclusive lock, unlike the other lookup methods.
+func (c *Cache) Attachment(at *discordgo.MessageAttachment) (Attachment, error) {
+	return c.AttachmentContext(context.Background(), at)
+}
+
+// AttachmentContext is like Attachment, but the download is made with ctx.
+// Cancelling ctx aborts the download, returning an error which matches both
+// ErrRequest and the context's error.
+//
+// As concurrent lookups of the same url share a download, the download is
+// made using the context of whichever caller started it. The progress of the
+// download may be reported by setting a callback on ctx with
+// ContextWithProgress.
+func (c *Cache) AttachmentContext(ctx context.Context, at *discordgo.MessageAttachment) (Attachment, error) {
+	a, _, _, err := c.AttachmentWithMetaContext(ctx, at)
+	return a, err
+}
+
+// AttachmentWithMeta is like Attachment, but also returns whether this call
+// downloaded the attachment and, if it was served from the cache, the age of
+// the cached copy: the time since it was last referenced before this call.
+// Unlike separate calls to HasAttachment and Attachment, the result cannot be
+// raced by a concurrent lookup. A lookup which waited on a download started
+// by another is not fresh, and its age is the time since that download.
+func (c *Cache) AttachmentWithMeta(at *discordgo.MessageAttachment) (a Attachment, fresh bool, age time.Duration, err error) {
+	return c.AttachmentWithMetaContext(context.Background(), at)
+}
+
+// AttachmentWithMetaContext is like AttachmentWithMeta, but the download is
+// made with ctx, as by AttachmentContext.
+func (c *Cache) AttachmentWithMetaContext(ctx context.Context, at *discordgo.MessageAttachment) (a Attachment, fresh bool, age time.Duration, err error) {
+	if c.closed.Load() {
+		return Attachment{Name: at.Filename, Type: at.ContentType}, false, 0, ErrClosed
+	}
+	if c.disabled[TypeAttachment] {
+		return Attachment{Name: at.Filename, Type: at.ContentType}, false, 0, ErrUnsupported
 	}
 
-	newchan, err := c.provider.Channel(ID)
-	if err != nil {
-		return discordgo.Channel{}, err
+	key := c.keyOf(at)
+	if a, last, ok := c.referenceAttachment(key); ok {
+		a = c.revalidate(ctx, at, a)
+		err := loadAttachment(&a)
+		if err == nil {
+			c.noteHit(TypeAttachment, key)
+			return a, false, c.since(last), nil
+		}
+		// The backing file has been lost or corrupted, so download it
+		// again
+		c.discardAttachment(key, err)
+	}
+	c.noteMiss(TypeAttachment, key)
+
+	start := c.now()
+	// Set by the flight, should this call be the one to make it
+	var (
+		downloaded bool
+		last       time.Time
+	)
+	v, err := c.do(ctx, "attachment:"+key, func() (interface{}, error) {
+		// A download which completed since the lookup above has already
+		// left its flight, so check again rather than downloading twice
+		if a, prev, ok := c.referenceAttachment(key); ok {
+			err := loadAttachment(&a)
+			if err == nil {
+				last = prev
+				return a, nil
+			}
+			c.discardAttachment(key, err)
+		}
+
+		downloaded = true
+		ret, err := c.download(ctx, at)
+		return ret, err
+	})
+	if err != nil && c.logger != nil {
+		c.logger.Warn("cache: attachment download failed", "type", TypeAttachment.String(), "id", key,
+			"latency", c.since(start), "error", err)
+	}
+	if v == nil {
+		// Gave up waiting for the download
+		return Attachment{Name: at.Filename, Type: at.ContentType}, false, 0, wrapError{ErrRequest, err}
 	}
 
-	c.channelCache[ID] = newchan
-	return *newchan, nil
+	a = v.(Attachment)
+	switch {
+	case downloaded:
+		return a, true, 0, err
+	case !last.IsZero():
+		return a, false, c.since(last), err
+	default:
+		return a, false, c.since(a.LastReference), err
+	}
 }
 
-// User looks up and returns a user's data from the discord API, or returns the
-// cached value if already found. If the user could not be found, error is
-// returned from the discord API. Errors are not cached and failed lookups
-// cause a new API hit.
-func (c *Cache) User(ID string) (discordgo.User, error) {
-	if u, ok := c.userCache[ID]; ok {
-		return *u, nil
+// AttachmentStream is like Attachment, but returns the content of the
+// attachment as a stream rather than a buffer, such that large attachments
+// need not be held in memory. If the attachment is cached, the stream reads
+// from the cached content. Otherwise, the stream is the body of a new download
+// from the Discord CDN, which is neither shared with concurrent lookups nor
+// cached, and the Content of the returned Attachment is nil. The caller must
+// close the stream once done with it.
+func (c *Cache) AttachmentStream(at *discordgo.MessageAttachment) (io.ReadCloser, Attachment, error) {
+	return c.AttachmentStreamContext(context.Background(), at)
+}
+
+// AttachmentStreamContext is like AttachmentStream, but the download is made
+// with ctx. Cancelling ctx aborts the download, including while the stream is
+// being read.
+func (c *Cache) AttachmentStreamContext(ctx context.Context, at *discordgo.MessageAttachment) (io.ReadCloser, Attachment, error) {
+	if c.closed.Load() {
+		return nil, Attachment{Name: at.Filename, Type: at.ContentType}, ErrClosed
+	}
+	if c.disabled[TypeAttachment] {
+		return nil, Attachment{Name: at.Filename, Type: at.ContentType}, ErrUnsupported
 	}
 
-	newuser, err := c.provider.User(ID)
+	key := c.keyOf(at)
+	if a, ok := c.cachedAttachment(key); ok {
+		a = c.revalidate(ctx, at, a)
+		rc, err := c.openCached(key, a)
+		if err == nil {
+			c.noteHit(TypeAttachment, key)
+			return rc, a, nil
+		}
+		c.discardAttachment(key, err)
+	}
+	c.noteMiss(TypeAttachment, key)
+
+	ret := Attachment{
+		Name:          at.Filename,
+		Type:          at.ContentType,
+		LastReference: c.now(),
+	}
+	r, err := c.fetch(ctx, at, nil)
 	if err != nil {
-		return discordgo.User{}, err
+		return nil, ret, err
 	}
 
-	c.userCache[ID] = newuser
-	return *newuser, nil
+	return r.Body, ret, nil
 }
 
-// Guild looks up and returns a guild's data from the discord API, or returns
-// the cached value if already found. If the guild could not be found, error is
-// returned from the discord API. Errors are not cached and failed lookups
-// cause a new API hit.
-func (c *Cache) Guild(ID string) (discordgo.Guild, error) {
-	if g, ok := c.guildCache[ID]; ok {
-		return *g, nil
+// cachedAttachment returns a copy of the cached attachment under key, if any,
+// recording the reference. The content of an attachment backed by disk is not
+// loaded. An attachment whose signed url has expired is evicted instead.
+func (c *Cache) cachedAttachment(key string) (Attachment, bool) {
+	a, _, ok := c.referenceAttachment(key)
+	return a, ok
+}
+
+// referenceAttachment is like cachedAttachment, but also returns the time the
+// attachment was last referenced before this reference.
+func (c *Cache) referenceAttachment(key string) (Attachment, time.Time, bool) {
+	c.mu.Lock()
+	a, ok := c.attachmentCache[key]
+	if !ok {
+		c.mu.Unlock()
+		return Attachment{}, time.Time{}, false
+	}
+	if a.expiredAt(c.now()) {
+		c.mu.Unlock()
+		c.forgetAttachment(key)
+		return Attachment{}, time.Time{}, false
+	}
+	last := a.LastReference
+	a.LastReference = c.now()
+	c.byReference.fix(a)
+	if c.byValue != nil {
+		c.referenceScore(a, a.LastReference)
+		c.byValue.fix(a)
+	}
+	if a.Path != "" && c.tiered() {
+		c.promote[key] = true
+	}
+	ret := *a
+	c.mu.Unlock()
+
+	return ret, last, true
+}
+
+// revalidate checks that the cached attachment a is still current if it was
+// last validated longer ago than the attachment TTL, returning the attachment
+// as now cached. The request is made conditional on the validators of a, such
+// that if the CDN responds that the content is unchanged, only the validation
+// time is refreshed. If the attachment cannot be revalidated, a is returned as
+// is, so callers continue to be served the cached content.
+func (c *Cache) revalidate(ctx context.Context, at *discordgo.MessageAttachment, a Attachment) Attachment {
+	if c.attachmentTTL == 0 || c.since(a.validated) <= c.attachmentTTL {
+		return a
 	}
 
-	newuser, err := c.provider.Guild(ID)
+	key := c.keyOf(at)
+	v, err := c.do(ctx, "revalidate:"+key, func() (interface{}, error) {
+		hdr := make(http.Header)
+		if a.ETag != "" {
+			hdr.Set("If-None-Match", a.ETag)
+		}
+		if a.LastModified != "" {
+			hdr.Set("If-Modified-Since", a.LastModified)
+		}
+
+		r, err := c.fetch(ctx, at, hdr)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Body.Close()
+
+		if r.StatusCode == http.StatusNotModified {
+			now := c.now()
+			c.mu.Lock()
+			if cached, ok := c.attachmentCache[key]; ok {
+				cached.validated = now
+			}
+			c.mu.Unlock()
+
+			ret := a
+			ret.validated = now
+			return ret, nil
+		}
+
+		return c.readAttachment(ctx, at, r)
+	})
 	if err != nil {
-		return discordgo.Guild{}, err
+		return a
 	}
 
-	c.guildCache[ID] = newuser
-	return *newuser, nil
+	return v.(Attachment)
 }
 
-// Attachment looks up and returns the content and info for a remote attachment
-// from the Discord API. Lookups from the same url are guaranteed not to cause
-// an API hit. Errors are not cached and the attachment is assumed to not
-// exist.
-func (c *Cache) Attachment(at *discordgo.MessageAttachment) (Attachment, error) {
-	if a, ok := c.attachmentCache[at.URL]; ok {
-		a.LastReference = time.Now()
-		return *a, nil
+// forgetAttachment evicts the attachment under key, such as when its backing
+// file can no longer be read.
+func (c *Cache) forgetAttachment(key string) {
+	c.mu.Lock()
+	removed := c.removeAttachment(key)
+	c.mu.Unlock()
+
+	if removed {
+		c.noteEvict(TypeAttachment, key)
+	}
+}
+
+// discardAttachment forgets the attachment under key, whose content could
+// not be read with err, counting it as corrupt if err is ErrCorrupt.
+func (c *Cache) discardAttachment(key string, err error) {
+	if errors.Is(err, ErrCorrupt) {
+		c.attachmentStats.corrupt.Add(1)
+		if c.logger != nil {
+			c.logger.Warn("cache: discarded corrupt attachment", "type", TypeAttachment.String(), "id", key)
+		}
+	}
+	c.forgetAttachment(key)
+}
+
+// do runs fn, sharing the call with any concurrent calls for the same key.
+// If ctx is done before fn completes, ctx.Err() is returned and fn is left to
+// complete for any other callers. If the cache is closed, ErrClosed is
+// returned without calling fn.
+func (c *Cache) do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	return c.doContext(ctx, key, func(context.Context) (interface{}, error) { return fn() })
+}
+
+// doContext is like do, but fn is given a context which is cancelled once
+// every caller sharing the call has given up waiting for it, such that the
+// call may be abandoned rather than left to complete for nobody.
+func (c *Cache) doContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.flight.do(ctx, key, fn)
+}
+
+// download fetches the attachment at from the Discord CDN and inserts it into
+// the attachment cache. On error, the attachment returned contains only the
+// details known from at.
+func (c *Cache) download(ctx context.Context, at *discordgo.MessageAttachment) (a Attachment, err error) {
+	ctx, span := startSpan(ctx, TypeAttachment, at.URL)
+	if span != nil {
+		defer func() {
+			span.SetAttributes(attribute.Int("cache.bytes", len(a.Content)))
+			endSpan(span, err)
+		}()
 	}
 
 	ret := Attachment{
@@ -146,72 +909,629 @@ func (c *Cache) Attachment(at *discordgo.MessageAttachment) (Attachment, error)
 		Type: at.ContentType,
 	}
 
-	r, err := http.Get(at.URL)
-	if err != nil {
-		return ret, fmt.Errorf("%w: %s", ErrRequest, err.Error())
+	if c.attachmentDir != "" {
+		// Left behind by a previous process
+		key := c.keyOf(at)
+		path := c.attachmentPath(key)
+		if buf, err := os.ReadFile(path); err == nil {
+			ret.Content = buf
+			ret.Path = path
+			detectType(&ret, "")
+			return c.storeAttachment(key, ret), nil
+		}
 	}
-	if r.StatusCode != 200 {
-		return ret, ErrGetFailed
+	if c.mirrorDir != "" {
+		if a, ok := c.readMirror(at); ok {
+			return c.storeAttachment(c.keyOf(at), a), nil
+		}
+	}
+
+	r, err := c.fetch(ctx, at, nil)
+	if err != nil {
+		return ret, err
 	}
 	defer r.Body.Close()
 
-	buf, err := io.ReadAll(r.Body)
+	return c.readAttachment(ctx, at, r)
+}
+
+// readAttachment reads the attachment at from the body of the successful
+// response r and inserts it into the attachment cache. On error, the
+// attachment returned contains only the details known from at.
+func (c *Cache) readAttachment(ctx context.Context, at *discordgo.MessageAttachment, r *http.Response) (Attachment, error) {
+	ret := Attachment{
+		Name: at.Filename,
+		Type: at.ContentType,
+	}
+
+	var body io.Reader = r.Body
+	if fn := progressFrom(ctx); fn != nil {
+		body = &progressReader{r: body, fn: fn, total: r.ContentLength}
+	}
+
+	buf, err := io.ReadAll(body)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ret, wrapError{ErrRequest, ctx.Err()}
+		}
+		if errors.Is(err, ErrTooLarge) {
+			return ret, err
+		}
+		// The client timeout also applies while reading the body
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return ret, fmt.Errorf("%w: %s", ErrRequest, err.Error())
+		}
 		return ret, fmt.Errorf("%w: %s", ErrIO, err.Error())
 	}
 	ret.Content = buf
-	ret.LastReference = time.Now()
+	detectType(&ret, r.Header.Get("Content-Type"))
+	ret.ETag = r.Header.Get("ETag")
+	ret.LastModified = r.Header.Get("Last-Modified")
+	return c.storeAttachment(c.keyOf(at), ret), nil
+}
 
-	c.attachmentCache[at.URL] = &ret
-	return ret, nil
+// storeAttachment inserts the downloaded attachment a into the attachment
+// cache under key, writing its content to disk if the cache is backed by disk,
+// unless it is already there, and returns it as inserted. If the content
+// cannot be written, it is held in memory instead. If attachment caching is
+// disabled (see WithAttachmentCaching), a is returned without being inserted.
+func (c *Cache) storeAttachment(key string, a Attachment) Attachment {
+	a.Checksum = sha256.Sum256(a.Content)
+	a.Expires = urlExpiry(key)
+	a.LastReference = c.now()
+	a.validated = a.LastReference
+	if !c.attachmentCaching || c.disabled[TypeAttachment] {
+		return a
+	}
+	if c.attachmentDir != "" && a.Path == "" && !c.tiered() {
+		if path, err := c.writeAttachment(key, a.Content); err == nil {
+			a.Path = path
+		}
+	}
+
+	cached := a
+	if a.Path != "" {
+		cached.Content = nil
+		cached.size = int64(len(a.Content))
+	} else {
+		c.holdInMemory(&cached)
+	}
+
+	c.mu.Lock()
+	c.insertAttachment(key, &cached)
+	c.mu.Unlock()
+
+	c.noteInsert(TypeAttachment, key, nil)
+	return a
 }
 
-// InvalidateChannel invalidates the cache entry for a given channel ID.
-func (c *Cache) InvalidateChannel(ID string) error {
-	if _, ok := c.channelCache[ID]; !ok {
-		return ErrMissing
+// fetch requests the attachment at from the Discord CDN. On success, the caller
+// must close the body of the returned response. If a size limit is configured,
+// responses declaring a larger Content-Length are rejected outright, and the
+// body returned fails with ErrTooLarge once read beyond the limit.
+//
+// Network errors and 5xx responses are retried with exponential backoff as
+// configured by WithRetry. Retries stop early if ctx is done, or if its
+// deadline would pass before the next attempt.
+//
+// Any headers in hdr are added to the request. If hdr makes the request
+// conditional, a 304 response is also considered successful.
+func (c *Cache) fetch(ctx context.Context, at *discordgo.MessageAttachment, hdr http.Header) (*http.Response, error) {
+	delay := c.retryDelay
+	for attempt := 1; ; attempt++ {
+		r, retry, err := c.request(ctx, at, hdr)
+		if !retry || attempt >= c.retryAttempts {
+			return r, err
+		}
+
+		// Wait as long as a rate limit asks, rather than backing off
+		wait := delay
+		var rlerr *RateLimitError
+		if errors.As(err, &rlerr) && rlerr.RetryAfter > 0 {
+			if rlerr.RetryAfter > MaxRetryAfter {
+				return nil, err
+			}
+			wait = rlerr.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, err
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, wrapError{ErrRequest, err}
+		}
+		delay *= 2
+	}
+}
+
+// request makes a single request for the attachment at, returning whether a
+// failure is transient and so worth retrying.
+func (c *Cache) request(ctx context.Context, at *discordgo.MessageAttachment, hdr http.Header) (*http.Response, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, at.URL, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s", ErrRequest, err.Error())
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false, wrapError{ErrRequest, ctx.Err()}
+		}
+		return nil, true, fmt.Errorf("%w: %s", ErrRequest, err.Error())
+	}
+	if r.StatusCode == http.StatusNotModified && len(hdr) > 0 {
+		return r, false, nil
+	}
+	if r.StatusCode == http.StatusTooManyRequests {
+		r.Body.Close()
+		wait, _ := parseRetryAfter(r.Header, time.Now())
+		return nil, true, &RateLimitError{RetryAfter: wait, Err: wrapError{ErrGetFailed, statusError(r.StatusCode)}}
+	}
+	if r.StatusCode != 200 {
+		r.Body.Close()
+		return nil, r.StatusCode >= 500, wrapError{ErrGetFailed, statusError(r.StatusCode)}
+	}
+	if !c.allowedType(r.Header.Get("Content-Type")) {
+		r.Body.Close()
+		return nil, false, ErrDisallowedType
+	}
+	if c.maxAttachmentSize > 0 {
+		if r.ContentLength > c.maxAttachmentSize {
+			r.Body.Close()
+			return nil, false, ErrTooLarge
+		}
+		r.Body = &limitedBody{
+			ReadCloser: r.Body,
+			r:          io.LimitReader(r.Body, c.maxAttachmentSize+1),
+			remaining:  c.maxAttachmentSize,
+		}
 	}
 
-	delete(c.channelCache, ID)
-	return nil
+	return r, false, nil
 }
 
-// InvalidateUser invalidates the cache entry for a given user ID.
-func (c *Cache) InvalidateUser(ID string) error {
-	if _, ok := c.userCache[ID]; !ok {
-		return ErrMissing
+// allowedType returns true if contentType, as sent by the CDN, is allowed by
+// the configured allowlist.
+func (c *Cache) allowedType(contentType string) bool {
+	if len(c.allowedTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
 	}
+	for _, allowed := range c.allowedTypes {
+		if allowed == mediaType {
+			return true
+		}
+		if prefix := strings.TrimSuffix(allowed, "*"); prefix != allowed && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limitedBody is a response body which fails with ErrTooLarge once more than
+// a limited number of bytes have been read from it. Reading one byte past the
+// limit is what distinguishes a body of exactly the limit from a larger one.
+type limitedBody struct {
+	io.ReadCloser
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrTooLarge
+	}
+
+	return n, err
+}
+
+// insertAttachment adds a to the attachment cache under key, replacing and
+// accounting for any existing entry. c.mu must be held.
+func (c *Cache) insertAttachment(key string, a *Attachment) {
+	if old, ok := c.attachmentCache[key]; ok {
+		c.attachmentBytes -= old.bytes()
+		c.attachmentMemory -= old.memory()
+		c.unindexChecksum(key, old.Checksum)
+		c.byReference.remove(old)
+		c.byExpiry.remove(old)
+		if c.byValue != nil {
+			c.byValue.remove(old)
+			a.score = old.score
+		}
+		if old.Path != "" && old.Path != a.Path {
+			os.Remove(old.Path)
+		}
+	} else if c.byValue != nil {
+		a.score = c.halfLives(c.now())
+	}
+	a.key, a.refIndex, a.expiryIndex, a.valueIndex = key, -1, -1, -1
+	c.attachmentCache[key] = a
+	c.attachmentBytes += a.bytes()
+	c.attachmentMemory += a.memory()
+	c.indexChecksum(key, a.Checksum)
+	c.byReference.add(a)
+	if !a.Expires.IsZero() {
+		c.byExpiry.add(a)
+	}
+	if c.byValue != nil {
+		c.byValue.add(a)
+	}
+}
+
+// removeAttachment evicts the attachment under key from the attachment cache,
+// if present, deleting its backing file and returning true. As c.mu must be
+// held, the caller must note the eviction once it is released.
+func (c *Cache) removeAttachment(key string) bool {
+	old, ok := c.attachmentCache[key]
+	if !ok {
+		return false
+	}
+
+	c.attachmentBytes -= old.bytes()
+	c.attachmentMemory -= old.memory()
+	c.unindexChecksum(key, old.Checksum)
+	c.byReference.remove(old)
+	c.byExpiry.remove(old)
+	if c.byValue != nil {
+		c.byValue.remove(old)
+	}
+	if old.Path != "" {
+		os.Remove(old.Path)
+	}
+	delete(c.attachmentCache, key)
+	return true
+}
 
-	delete(c.userCache, ID)
-	return nil
+// HasChannel returns true if the channel ID is cached and has not outlived its
+// TTL, such that a lookup would be served from the cache. The provider is never
+// called, and neither the statistics nor the recency of the entry are updated.
+func (c *Cache) HasChannel(ID string) bool {
+	return c.channels.has(ID)
+}
+
+// HasUser is like HasChannel, but for the user ID.
+func (c *Cache) HasUser(ID string) bool {
+	return c.users.has(ID)
+}
+
+// HasGuild is like HasChannel, but for the guild ID.
+func (c *Cache) HasGuild(ID string) bool {
+	return c.guilds.has(ID)
+}
+
+// AddAttachment inserts an attachment at url with the given name, content
+// type and content into the cache without downloading anything, such that
+// later lookups of the attachment are served from the cache. An attachment
+// already cached at url is replaced. The attachment is otherwise cached as if
+// downloaded, so it is written to the attachment directory if one is set (see
+// WithAttachmentDir) and is evicted by Clean like any other. Content held in
+// memory is not copied, so the caller must not modify content afterwards.
+func (c *Cache) AddAttachment(url, name, contentType string, content []byte) {
+	c.storeAttachment(c.keyOfURL(url), Attachment{
+		Name:    name,
+		Type:    contentType,
+		Content: content,
+	})
+}
+
+// HasAttachment returns true if the attachment at url is cached. Nothing is
+// downloaded, and the reference time of the attachment is not updated.
+func (c *Cache) HasAttachment(url string) bool {
+	return c.hasAttachment(c.keyOfURL(url))
+}
+
+// hasAttachment returns true if an attachment is cached under key.
+func (c *Cache) hasAttachment(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.attachmentCache[key]
+	return ok
+}
+
+// InvalidateChannel invalidates the cache entry for a given channel ID.
+func (c *Cache) InvalidateChannel(ID string) error {
+	return c.channels.invalidate(ID)
+}
+
+// InvalidateUser invalidates the cache entry for a given user ID.
+func (c *Cache) InvalidateUser(ID string) error {
+	return c.users.invalidate(ID)
 }
 
 // InvalidateGuild invalidates the cache entry for a given guild ID.
 func (c *Cache) InvalidateGuild(ID string) error {
-	if _, ok := c.guildCache[ID]; !ok {
-		return ErrMissing
+	return c.guilds.invalidate(ID)
+}
+
+// InvalidateGuildCascade invalidates the guild guildID along with everything
+// cached which belongs to it: its channels, its members, and its roles and
+// emojis. This should be called on leaving a guild. The channels and members
+// of the guild are found through an index maintained by the cache, without
+// walking every cached channel and member, so those inserted by other caches
+// sharing a Store (see WithStore) are not invalidated. The total number of
+// entries invalidated is returned.
+func (c *Cache) InvalidateGuildCascade(guildID string) int {
+	n := c.channels.invalidateGroup(guildID) + c.members.invalidateGroup(guildID)
+	for _, o := range []interface{ invalidate(string) error }{c.guilds, c.roles, c.emojis} {
+		if o.invalidate(guildID) == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// InvalidateAll invalidates every entry in the cache, of every type.
+func (c *Cache) InvalidateAll() {
+	c.InvalidateAllChannels()
+	c.InvalidateAllUsers()
+	c.InvalidateAllGuilds()
+	c.InvalidateAllMembers()
+	c.InvalidateAllRoles()
+	c.InvalidateAllEmojis()
+	c.InvalidateAllStickers()
+	c.InvalidateAllMessages()
+	c.InvalidateAllHistories()
+	c.InvalidateAllAttachments()
+}
+
+// InvalidateOlderThan invalidates every cached channel, user, guild, member,
+// role set, emoji set, sticker, message and channel history inserted longer
+// than d ago, whether or not it has expired or been used since, bounding the
+// staleness of the cache even if it has no TTL configured (see WithTTL).
+// Entries completed since their insertion, such as partial guilds (see
+// GuildWithRoles), keep their original insertion time. The number of entries
+// invalidated of each type is returned. Attachments are not affected (but see
+// WithAttachmentLifetime).
+func (c *Cache) InvalidateOlderThan(d time.Duration) map[ObjectType]int {
+	return map[ObjectType]int{
+		TypeChannel: c.channels.invalidateOlderThan(d),
+		TypeUser:    c.users.invalidateOlderThan(d),
+		TypeGuild:   c.guilds.invalidateOlderThan(d),
+		TypeMember:  c.members.invalidateOlderThan(d),
+		TypeRole:    c.roles.invalidateOlderThan(d),
+		TypeEmoji:   c.emojis.invalidateOlderThan(d),
+		TypeSticker: c.stickers.invalidateOlderThan(d),
+		TypeMessage: c.messages.invalidateOlderThan(d),
+		TypeHistory: c.histories.invalidateOlderThan(d),
+	}
+}
+
+// InvalidateAllChannels invalidates every cached channel.
+func (c *Cache) InvalidateAllChannels() {
+	c.channels.invalidateAll()
+}
+
+// InvalidateAllUsers invalidates every cached user.
+func (c *Cache) InvalidateAllUsers() {
+	c.users.invalidateAll()
+}
+
+// InvalidateAllGuilds invalidates every cached guild.
+func (c *Cache) InvalidateAllGuilds() {
+	c.guilds.invalidateAll()
+}
+
+// InvalidateChannelsFunc invalidates every cached channel for which pred
+// returns true, for example every channel of a guild which has been left,
+// returning the number of channels invalidated. Each shard of the cache is
+// locked while pred is called for its channels, so pred must not call back
+// into the cache.
+func (c *Cache) InvalidateChannelsFunc(pred func(ch discordgo.Channel) bool) int {
+	return c.channels.invalidateFunc(pred)
+}
+
+// InvalidateUsersFunc is like InvalidateChannelsFunc, but for users.
+func (c *Cache) InvalidateUsersFunc(pred func(u discordgo.User) bool) int {
+	return c.users.invalidateFunc(pred)
+}
+
+// InvalidateGuildsFunc is like InvalidateChannelsFunc, but for guilds.
+func (c *Cache) InvalidateGuildsFunc(pred func(g discordgo.Guild) bool) int {
+	return c.guilds.invalidateFunc(pred)
+}
+
+// InvalidateAllAttachments invalidates every cached attachment.
+func (c *Cache) InvalidateAllAttachments() {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.attachmentCache))
+	for key, a := range c.attachmentCache {
+		if a.Path != "" {
+			os.Remove(a.Path)
+		}
+		keys = append(keys, key)
 	}
+	c.attachmentCache = make(map[string]*Attachment)
+	c.checksums = make(map[[sha256.Size]byte]map[string]bool)
+	c.promote = make(map[string]bool)
+	c.attachmentBytes = 0
+	c.attachmentMemory = 0
+	c.byReference.reset()
+	c.byExpiry.reset()
+	if c.byValue != nil {
+		c.byValue.reset()
+	}
+	c.mu.Unlock()
 
-	delete(c.guildCache, ID)
-	return nil
+	c.noteEvict(TypeAttachment, c.sortedKeys(keys)...)
 }
 
 // Clean walks the cache, freeing any bulky cached items which are deemed not
-// particularly useful (e.g attachments which have not been reused in a while).
+// particularly useful (e.g attachments which have not been referenced within
+// their lifetime, see WithAttachmentLifetime) and any channels, users, guilds,
+// members, role sets or emoji sets which have outlived their TTL. If more than
+// the prune threshold of attachments (see WithAttachmentPruneThreshold) remain,
+// or a byte budget set with WithMaxAttachmentBytes is exceeded, the least
+// recently referenced attachments are then evicted until both limits are met.
+// Evicting an attachment backed by disk deletes its backing file, and stale
+// backing files left behind by previous processes are deleted too. If the
+// attachment cache is tiered (see WithHotAttachmentBytes), attachments are
+// then moved between memory and disk.
+//
+// Attachments are kept ordered by last reference and url expiry, so the cost of
+// cleaning the attachment cache grows with the number of attachments evicted
+// rather than the number cached, keeping frequent cleans of a mostly fresh
+// cache cheap.
 func (c *Cache) Clean() {
-	delfirst := 0
-	if len(c.attachmentCache) > AttachmentPruneThreshold {
-		delfirst = len(c.attachmentCache) - AttachmentPruneThreshold
+	c.channels.clean()
+	c.users.clean()
+	c.guilds.clean()
+	c.members.clean()
+	c.roles.clean()
+	c.emojis.clean()
+	c.stickers.clean()
+	c.messages.clean()
+	c.histories.clean()
+
+	now := c.now()
+	c.missing.deleteFunc(func(_ string, t *time.Time) bool {
+		return now.After(*t)
+	})
+
+	c.mu.Lock()
+	plan := c.planAttachments()
+	evicted := make([]string, len(plan))
+	for i, ev := range plan {
+		c.removeAttachment(ev.URL)
+		evicted[i] = ev.URL
 	}
+	c.mu.Unlock()
+
+	c.tierAttachments()
 
-	i := 0
-	for key, val := range c.attachmentCache {
-		if i < delfirst {
-			delete(c.attachmentCache, key)
-		} else if time.Since(val.LastReference) > AttachmentLifetime {
-			delete(c.attachmentCache, key)
+	c.mu.Lock()
+	var tracked map[string]bool
+	if c.attachmentDir != "" {
+		tracked = make(map[string]bool, len(c.attachmentCache))
+		for _, a := range c.attachmentCache {
+			tracked[a.Path] = true
 		}
+	}
+	c.mu.Unlock()
+
+	c.noteEvict(TypeAttachment, evicted...)
+	c.logEvictions(TypeAttachment, evicted)
+	if tracked != nil {
+		c.sweepAttachmentDir(tracked)
+	}
+}
+
+// An EvictionReason is the reason for which Clean evicts an attachment.
+type EvictionReason int
 
-		i++
+// Reasons for evicting attachments.
+const (
+	// The attachment has outlived its lifetime (see WithAttachmentLifetime),
+	// or its signed url has expired (see Attachment.Expired).
+	EvictExpired EvictionReason = iota
+	// The attachment cache is over its prune threshold or byte budget, and
+	// the attachment is among the least recently referenced.
+	EvictOverThreshold
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictOverThreshold:
+		return "over threshold"
+	default:
+		return "unknown"
 	}
 }
+
+// An Eviction is an attachment which Clean would evict, along with why.
+type Eviction struct {
+	URL    string
+	Reason EvictionReason
+}
+
+// CleanPlan returns the attachments which Clean would evict if called now, in
+// the order in which it would evict them, without changing the cache. As the
+// cache may change concurrently, a later call to Clean may evict different
+// attachments.
+func (c *Cache) CleanPlan() []Eviction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.planAttachments()
+}
+
+// planAttachments returns the attachments to evict to clean the attachment
+// cache: first those which have outlived their lifetime, then the least
+// recently referenced, or the least valuable under an LFU policy (see
+// WithEvictionPolicy), until the cache is within its limits. c.mu must be
+// held.
+//
+// Only the attachments planned for eviction and their neighbours in the heaps
+// of the cache are visited, so planning takes O(k log k) time to evict k
+// attachments, however many are cached.
+func (c *Cache) planAttachments() (plan []Eviction) {
+	now := c.now()
+	count, size := len(c.attachmentCache), c.attachmentBytes
+	planned := make(map[*Attachment]bool)
+	evict := func(a *Attachment, reason EvictionReason) {
+		plan = append(plan, Eviction{a.key, reason})
+		planned[a] = true
+		count, size = count-1, size-a.bytes()
+	}
+
+	c.byExpiry.ascend(func(a *Attachment) bool {
+		if !a.expiredAt(now) {
+			return false
+		}
+		evict(a, EvictExpired)
+		return true
+	})
+
+	// Every attachment which has outlived its lifetime precedes any which
+	// has not, so the limits are only checked once all have been planned
+	lru := c.byValue == nil
+	c.byReference.ascend(func(a *Attachment) bool {
+		switch {
+		case planned[a]:
+		case now.Sub(a.LastReference) > c.attachmentLifetime:
+			evict(a, EvictExpired)
+		case lru && c.overAttachmentLimits(count, size):
+			evict(a, EvictOverThreshold)
+		default:
+			return false
+		}
+		return true
+	})
+	if lru {
+		return plan
+	}
+
+	c.byValue.ascend(func(a *Attachment) bool {
+		switch {
+		case planned[a]:
+		case c.overAttachmentLimits(count, size):
+			evict(a, EvictOverThreshold)
+		default:
+			return false
+		}
+		return true
+	})
+
+	return plan
+}
+
+// overAttachmentLimits returns true if count attachments totalling size bytes
+// are more than the attachment cache allows. c.mu must be held.
+func (c *Cache) overAttachmentLimits(count int, size int64) bool {
+	if count > c.attachmentPruneThreshold {
+		return true
+	}
+
+	return c.maxAttachmentBytes > 0 && size > c.maxAttachmentBytes
+}
@@ -1,8 +1,16 @@
 package cache
 
 import (
+	"context"
+	"crypto/sha256"
 	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -47,6 +55,77 @@ func (m MockProvider) Guild(guildID string) (st *discordgo.Guild, err error) {
 	return nil, ErrMissing
 }
 
+func (m MockProvider) GuildMember(guildID, userID string) (st *discordgo.Member, err error) {
+	if guildID == "9101112" && userID == "5678" {
+		return &discordgo.Member{
+			GuildID: "9101112",
+			Nick:    "Testing Nickname",
+			User:    &discordgo.User{ID: "5678", Username: "Testing User"},
+		}, nil
+	}
+
+	return nil, ErrMissing
+}
+
+func (m MockProvider) GuildRoles(guildID string) (st []*discordgo.Role, err error) {
+	if guildID == "9101112" {
+		return []*discordgo.Role{
+			{ID: "1", Name: "Testing Role", Color: 0xff0000},
+			{ID: "2", Name: "Other Role"},
+		}, nil
+	}
+
+	return nil, ErrMissing
+}
+
+func (m MockProvider) GuildEmojis(guildID string) (emoji []*discordgo.Emoji, err error) {
+	if guildID == "9101112" {
+		return []*discordgo.Emoji{
+			{ID: "1", Name: "testing"},
+			{ID: "2", Name: "dancing", Animated: true},
+		}, nil
+	}
+
+	return nil, ErrMissing
+}
+
+func (m MockProvider) Sticker(stickerID string) (st *discordgo.Sticker, err error) {
+	if stickerID == "1314" {
+		return &discordgo.Sticker{
+			ID:         "1314",
+			Name:       "Testing Sticker",
+			FormatType: discordgo.StickerFormatTypeLottie,
+		}, nil
+	}
+
+	return nil, ErrMissing
+}
+
+func (m MockProvider) GuildChannels(guildID string) (st []*discordgo.Channel, err error) {
+	if guildID == "9101112" {
+		ch, _ := m.Channel("1234")
+		return []*discordgo.Channel{
+			ch,
+			{ID: "4321", Name: "Other Channel", GuildID: "9101112"},
+		}, nil
+	}
+
+	return nil, ErrMissing
+}
+
+func (m MockProvider) ChannelMessage(channelID, messageID string) (st *discordgo.Message, err error) {
+	if channelID == "1234" && messageID == "1516" {
+		return &discordgo.Message{
+			ID:        "1516",
+			ChannelID: "1234",
+			Content:   "Testing Message",
+			Author:    &discordgo.User{ID: "5678"},
+		}, nil
+	}
+
+	return nil, ErrMissing
+}
+
 func testChannel(t *testing.T) {
 	provider := MockProvider{}
 	cache := NewCache(provider)
@@ -60,12 +139,12 @@ func testChannel(t *testing.T) {
 		t.Error("Incorrect channel returned from retrieval")
 	}
 
-	cr, ok := cache.channelCache["1234"]
+	cr, ok := cache.channels.get("1234")
 	if !ok {
 		t.Error("Failed to insert channel into lookup cache")
 		return
 	}
-	if cr.ID != cexpect.ID {
+	if cr.val.ID != cexpect.ID {
 		t.Error("Incorrect channel inserted into cache map")
 	}
 
@@ -73,7 +152,7 @@ func testChannel(t *testing.T) {
 		ID:   "testcache",
 		Name: "test channel",
 	}
-	cache.channelCache["testcache"] = &testchan
+	cache.channels.set("testcache", newEntry(&testchan, time.Now()))
 	if hc, err := cache.Channel("testcache"); hc.ID != testchan.ID || err != nil {
 		t.Error("Failed to hit cache for cached channel value")
 	}
@@ -89,7 +168,7 @@ func testChannelError(t *testing.T) {
 		return
 	}
 
-	if _, ok := cache.channelCache["abcd"]; ok {
+	if _, ok := cache.channels.get("abcd"); ok {
 		t.Error("Channel cache contains non-existent channel `abcd`")
 	}
 }
@@ -107,12 +186,12 @@ func testUser(t *testing.T) {
 		t.Error("Incorrect user returned from retrieval")
 	}
 
-	ur, ok := cache.userCache["5678"]
+	ur, ok := cache.users.get("5678")
 	if !ok {
 		t.Error("Failed to insert user into lookup cache")
 		return
 	}
-	if ur.ID != uexpect.ID {
+	if ur.val.ID != uexpect.ID {
 		t.Error("Incorrect user inserted into cache map")
 	}
 
@@ -120,7 +199,7 @@ func testUser(t *testing.T) {
 		ID:       "testuser",
 		Username: "test user",
 	}
-	cache.userCache["testcache"] = &testuser
+	cache.users.set("testcache", newEntry(&testuser, time.Now()))
 	if hc, err := cache.User("testcache"); hc.ID != testuser.ID || err != nil {
 		t.Error("Failed to hit cache for cached user value")
 	}
@@ -136,7 +215,7 @@ func testUserError(t *testing.T) {
 		return
 	}
 
-	if _, ok := cache.userCache["abcd"]; ok {
+	if _, ok := cache.users.get("abcd"); ok {
 		t.Error("Channel cache contains non-existent user `abcd`")
 	}
 }
@@ -154,12 +233,12 @@ func testGuild(t *testing.T) {
 		t.Error("Incorrect guild returned from retrieval")
 	}
 
-	gr, ok := cache.guildCache["9101112"]
+	gr, ok := cache.guilds.get("9101112")
 	if !ok {
 		t.Error("Failed to insert user into lookup cache")
 		return
 	}
-	if gr.ID != gexpect.ID {
+	if gr.val.ID != gexpect.ID {
 		t.Error("Incorrect user inserted into cache map")
 	}
 
@@ -167,12 +246,123 @@ func testGuild(t *testing.T) {
 		ID:   "testguild",
 		Name: "test guild",
 	}
-	cache.guildCache["testcache"] = &testguild
+	cache.guilds.set("testcache", newEntry(&testguild, time.Now()))
 	if hc, err := cache.Guild("testcache"); hc.ID != testguild.ID || err != nil {
 		t.Error("Failed to hit cache for cached guild value")
 	}
 }
 
+func testMember(t *testing.T) {
+	provider := MockProvider{}
+	cache := NewCache(provider)
+
+	m, err := cache.Member("9101112", "5678")
+	if err != nil {
+		t.Error("Unexpected error from member retrieval:", err)
+	}
+	mexpect, _ := provider.GuildMember("9101112", "5678")
+	if m.Nick != mexpect.Nick {
+		t.Error("Incorrect member returned from retrieval")
+	}
+
+	mr, ok := cache.members.get("9101112:5678")
+	if !ok {
+		t.Error("Failed to insert member into lookup cache")
+		return
+	}
+	if mr.val.Nick != mexpect.Nick {
+		t.Error("Incorrect member inserted into cache map")
+	}
+
+	if err := cache.InvalidateMember("9101112", "5678"); err != nil {
+		t.Error("Unexpected error from member invalidation:", err)
+	}
+	if err := cache.InvalidateMember("9101112", "5678"); err != ErrMissing {
+		t.Error("Expected ErrMissing from invalidation of missing member, got:", err)
+	}
+}
+
+func testMemberError(t *testing.T) {
+	provider := MockProvider{}
+	cache := NewCache(provider)
+
+	_, err := cache.Member("9101112", "abcd")
+	if err == nil {
+		t.Error("Expected error from non-existent member `abcd`")
+		return
+	}
+
+	if _, ok := cache.members.get("9101112:abcd"); ok {
+		t.Error("Member cache contains non-existent member `abcd`")
+	}
+}
+
+func testRole(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	cache := NewCache(p)
+
+	r, err := cache.Role("9101112", "1")
+	if err != nil {
+		t.Error("Unexpected error from role retrieval:", err)
+	}
+	if r.Name != "Testing Role" || r.Color != 0xff0000 {
+		t.Error("Incorrect role returned from retrieval")
+	}
+
+	// Rest of the guild's roles are now cached
+	if r, err := cache.Role("9101112", "2"); err != nil || r.Name != "Other Role" {
+		t.Error("Failed to hit cache for other role in same guild")
+	}
+	if _, err := cache.Role("9101112", "3"); err != ErrMissing {
+		t.Error("Expected ErrMissing from non-existent role `3`, got:", err)
+	}
+	if p.calls != 1 {
+		t.Errorf("wrong number of provider calls\nexpect: 1\ngot: %d", p.calls)
+	}
+
+	if err := cache.InvalidateGuildRoles("9101112"); err != nil {
+		t.Error("Unexpected error from role invalidation:", err)
+	}
+	cache.Role("9101112", "1")
+	if p.calls != 2 {
+		t.Errorf("wrong number of provider calls after invalidation\nexpect: 2\ngot: %d", p.calls)
+	}
+}
+
+func testEmoji(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	cache := NewCache(p)
+
+	e, err := cache.Emoji("9101112", "1")
+	if err != nil {
+		t.Error("Unexpected error from emoji retrieval:", err)
+	}
+	if e.Name != "testing" || e.Animated {
+		t.Error("Incorrect emoji returned from retrieval")
+	}
+
+	// Rest of the guild's emojis are now cached
+	if e, err := cache.Emoji("9101112", "2"); err != nil || e.Name != "dancing" || !e.Animated {
+		t.Error("Failed to hit cache for animated emoji in same guild")
+	}
+	if _, err := cache.Emoji("9101112", "3"); err != ErrMissing {
+		t.Error("Expected ErrMissing from non-existent emoji `3`, got:", err)
+	}
+	if p.calls != 1 {
+		t.Errorf("wrong number of provider calls\nexpect: 1\ngot: %d", p.calls)
+	}
+
+	if err := cache.InvalidateGuildEmojis("9101112"); err != nil {
+		t.Error("Unexpected error from emoji invalidation:", err)
+	}
+	cache.Emoji("9101112", "1")
+	if p.calls != 2 {
+		t.Errorf("wrong number of provider calls after invalidation\nexpect: 2\ngot: %d", p.calls)
+	}
+}
+
 func testGuildError(t *testing.T) {
 	provider := MockProvider{}
 	cache := NewCache(provider)
@@ -183,7 +373,7 @@ func testGuildError(t *testing.T) {
 		return
 	}
 
-	if _, ok := cache.guildCache["abcd"]; ok {
+	if _, ok := cache.guilds.get("abcd"); ok {
 		t.Error("Guild cache contains non-existent user `abcd`")
 	}
 }
@@ -197,6 +387,12 @@ func TestRetrieval(t *testing.T) {
 
 	t.Run("Guild", testGuild)
 	t.Run("GuildError", testGuildError)
+
+	t.Run("Member", testMember)
+	t.Run("MemberError", testMemberError)
+
+	t.Run("Role", testRole)
+	t.Run("Emoji", testEmoji)
 }
 
 func testAttachment(t *testing.T) {
@@ -268,20 +464,107 @@ func TestAttachment(t *testing.T) {
 	t.Run("Failure", testAttachmentFailure)
 }
 
+func TestInvalidateAll(t *testing.T) {
+	c := NewCache(MockProvider{})
+	c.Channel("1234")
+	c.User("5678")
+	c.Guild("9101112")
+	c.mu.Lock()
+	c.insertAttachment("a", &Attachment{Content: []byte("abcd")})
+	c.mu.Unlock()
+
+	c.InvalidateAllUsers()
+	if c.users.len() != 0 {
+		t.Error("user cache not empty after InvalidateAllUsers")
+	}
+	if c.channels.len() != 1 || c.guilds.len() != 1 {
+		t.Error("InvalidateAllUsers invalidated other caches")
+	}
+
+	c.InvalidateAll()
+	if c.channels.len() != 0 || c.guilds.len() != 0 || len(c.attachmentCache) != 0 {
+		t.Error("cache not empty after InvalidateAll")
+	}
+	if c.attachmentBytes != 0 {
+		t.Errorf("wrong byte count after InvalidateAll\nexpect: 0\ngot: %d", c.attachmentBytes)
+	}
+}
+
+func TestInvalidateOlderThan(t *testing.T) {
+	clock := NewFakeClock()
+	c := NewCache(MockProvider{}, WithClock(clock))
+	c.Channel("1234")
+	c.Guild("9101112")
+	clock.Advance(time.Hour)
+	c.User("5678")
+
+	n := c.InvalidateOlderThan(time.Minute)
+	if n[TypeChannel] != 1 || n[TypeGuild] != 1 || n[TypeUser] != 0 {
+		t.Errorf("wrong counts of invalidated entries\nexpect: 1 channel, 1 guild, 0 users\ngot: %v", n)
+	}
+	if c.channels.len() != 0 || c.guilds.len() != 0 || c.users.len() != 1 {
+		t.Error("wrong entries invalidated by InvalidateOlderThan")
+	}
+	if s := c.Stats().Channel; s.Evictions != 1 {
+		t.Errorf("wrong channel eviction count\nexpect: 1\ngot: %d", s.Evictions)
+	}
+}
+
+// Expired entries must be re-fetched from the provider and swept by Clean.
+func TestTTL(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p, WithTTL(TypeChannel, time.Hour), WithTTL(TypeUser, 0))
+
+	c.Channel("1234")
+	c.Channel("1234")
+	if p.calls != 1 {
+		t.Fatalf("wrong number of provider calls for fresh entry\nexpect: 1\ngot: %d", p.calls)
+	}
+
+	e, _ := c.channels.get("1234")
+	e.inserted = e.inserted.Add(-2 * time.Hour)
+	c.Channel("1234")
+	if p.calls != 2 {
+		t.Fatalf("wrong number of provider calls for expired entry\nexpect: 2\ngot: %d", p.calls)
+	}
+
+	// Users never expire; guilds use the default TTL
+	c.User("5678")
+	c.Guild("9101112")
+	u, _ := c.users.get("5678")
+	u.inserted = u.inserted.Add(-24 * time.Hour)
+	g, _ := c.guilds.get("9101112")
+	g.inserted = g.inserted.Add(-2 * DefaultTTL)
+	e, _ = c.channels.get("1234")
+	e.inserted = e.inserted.Add(-2 * time.Hour)
+	c.Clean()
+
+	if c.channels.len() != 0 {
+		t.Error("expired channel was not swept by Clean")
+	}
+	if c.guilds.len() != 0 {
+		t.Error("expired guild was not swept by Clean")
+	}
+	if c.users.len() != 1 {
+		t.Error("user with no TTL was wrongfully swept by Clean")
+	}
+}
+
 // Tests cleaning the cache based on last reference time.
 func testCacheCleanRef(t *testing.T) {
 	c := NewCache(MockProvider{})
 
 	// Attachment referenced 24 hours in the future - will not be deleted
-	c.attachmentCache["0"] = &Attachment{
+	c.insertAttachment("0", &Attachment{
 		Name:          "0",
 		LastReference: time.Now().Add(time.Hour * 24),
-	}
+	})
 	// Attachment last referenced two deletion cycles ago - *will* be deleted
-	c.attachmentCache["1"] = &Attachment{
+	c.insertAttachment("1", &Attachment{
 		Name:          "1",
 		LastReference: time.Now().Add(-2 * AttachmentLifetime),
-	}
+	})
 	c.Clean()
 
 	if _, ok := c.attachmentCache["0"]; !ok {
@@ -292,6 +575,45 @@ func testCacheCleanRef(t *testing.T) {
 	}
 }
 
+// Tests cleaning the cache based on a configured attachment lifetime.
+func testCacheCleanLifetime(t *testing.T) {
+	c := NewCache(MockProvider{}, WithAttachmentLifetime(time.Minute))
+
+	c.insertAttachment("0", &Attachment{Name: "0", LastReference: time.Now()})
+	c.insertAttachment("1", &Attachment{Name: "1", LastReference: time.Now().Add(-time.Minute * 2)})
+	c.Clean()
+
+	if _, ok := c.attachmentCache["0"]; !ok {
+		t.Error("element '0' was wrongfully removed from cache")
+	}
+	if _, ok := c.attachmentCache["1"]; ok {
+		t.Error("element '1' outlived the configured lifetime")
+	}
+}
+
+// Tests cleaning the cache based on a configured prune threshold.
+func testCacheCleanThreshold(t *testing.T) {
+	c := NewCache(MockProvider{}, WithAttachmentPruneThreshold(2))
+
+	for i := 0; i < 5; i++ {
+		str := strconv.Itoa(i)
+		c.insertAttachment(str, &Attachment{
+			Name:          str,
+			LastReference: time.Now().Add(time.Duration(i) * time.Second),
+		})
+	}
+	c.Clean()
+
+	if len(c.attachmentCache) != 2 {
+		t.Fatalf("wrong count after clean\nexpect: %d\ngot: %d", 2, len(c.attachmentCache))
+	}
+	for _, key := range []string{"3", "4"} {
+		if _, ok := c.attachmentCache[key]; !ok {
+			t.Errorf("element '%s' was wrongfully removed from cache", key)
+		}
+	}
+}
+
 // Tests cleaning the cache based on the count in the cache.
 func testCacheCleanLeak(t *testing.T) {
 	c := NewCache(MockProvider{})
@@ -299,7 +621,7 @@ func testCacheCleanLeak(t *testing.T) {
 	// 100 excess elements - should be pruned down to the prune threshold
 	for i := int64(2); i < AttachmentPruneThreshold+100; i++ {
 		str := strconv.FormatInt(i, 10)
-		c.attachmentCache[str] = &Attachment{Name: str}
+		c.insertAttachment(str, &Attachment{Name: str})
 	}
 	c.Clean()
 
@@ -308,7 +630,921 @@ func testCacheCleanLeak(t *testing.T) {
 	}
 }
 
+// Tests that cleaning the cache by count evicts the oldest entries first.
+func testCacheCleanOrder(t *testing.T) {
+	c := NewCache(MockProvider{})
+
+	// 100 excess elements, each referenced later than the last
+	now := time.Now()
+	for i := 0; i < AttachmentPruneThreshold+100; i++ {
+		str := strconv.Itoa(i)
+		c.insertAttachment(str, &Attachment{
+			Name:          str,
+			LastReference: now.Add(time.Duration(i) * time.Millisecond),
+		})
+	}
+	c.Clean()
+
+	for i := 0; i < AttachmentPruneThreshold+100; i++ {
+		_, ok := c.attachmentCache[strconv.Itoa(i)]
+		if i < 100 && ok {
+			t.Errorf("old element '%d' was wrongfully saved from removal from cache", i)
+		} else if i >= 100 && !ok {
+			t.Errorf("new element '%d' was wrongfully removed from cache", i)
+		}
+	}
+}
+
+// Tests cleaning the cache based on the total size of cached content.
+func testCacheCleanBytes(t *testing.T) {
+	c := NewCache(MockProvider{}, WithMaxAttachmentBytes(2500))
+
+	// Ten attachments of 1000 bytes, each referenced later than the last
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		str := strconv.Itoa(i)
+		c.insertAttachment(str, &Attachment{
+			Name:          str,
+			Content:       make([]byte, 1000),
+			LastReference: now.Add(time.Duration(i) * time.Second),
+		})
+	}
+	if c.attachmentBytes != 10000 {
+		t.Fatalf("wrong byte count after insert\nexpect: %d\ngot: %d", 10000, c.attachmentBytes)
+	}
+	c.Clean()
+
+	if c.attachmentBytes != 2000 {
+		t.Errorf("wrong byte count after clean\nexpect: %d\ngot: %d", 2000, c.attachmentBytes)
+	}
+	for _, key := range []string{"8", "9"} {
+		if _, ok := c.attachmentCache[key]; !ok {
+			t.Errorf("recently referenced element '%s' was wrongfully removed from cache", key)
+		}
+	}
+}
+
+// Tests that planning a clean reports what would be evicted without evicting
+// it.
+func testCacheCleanPlan(t *testing.T) {
+	c := NewCache(MockProvider{}, WithAttachmentPruneThreshold(2))
+
+	now := time.Now()
+	c.insertAttachment("expired", &Attachment{LastReference: now.Add(-2 * AttachmentLifetime)})
+	for i := 0; i < 4; i++ {
+		str := strconv.Itoa(i)
+		c.insertAttachment(str, &Attachment{LastReference: now.Add(time.Duration(i) * time.Second)})
+	}
+
+	plan := c.CleanPlan()
+	expect := []Eviction{
+		{"expired", EvictExpired},
+		{"0", EvictOverThreshold},
+		{"1", EvictOverThreshold},
+	}
+	if len(plan) != len(expect) {
+		t.Fatalf("wrong clean plan\nexpect: %v\ngot: %v", expect, plan)
+	}
+	for i := range expect {
+		if plan[i] != expect[i] {
+			t.Errorf("wrong eviction planned\nexpect: %v\ngot: %v", expect[i], plan[i])
+		}
+	}
+	if len(c.attachmentCache) != 5 {
+		t.Error("planning a clean changed the cache")
+	}
+
+	c.Clean()
+	if len(c.attachmentCache) != 2 {
+		t.Errorf("clean did not follow its plan\nexpect: 2 remaining\ngot: %d", len(c.attachmentCache))
+	}
+}
+
+// Tests that referencing an attachment saves it from eviction by count, and
+// that repeated cleans stay consistent as attachments come and go.
+func testCacheCleanReference(t *testing.T) {
+	c := NewCache(MockProvider{}, WithAttachmentPruneThreshold(2))
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		str := strconv.Itoa(i)
+		c.insertAttachment(str, &Attachment{Name: str, LastReference: now.Add(time.Duration(i-10) * time.Second)})
+	}
+	c.cachedAttachment("0")
+	c.Clean()
+
+	for key, expect := range map[string]bool{"0": true, "1": false, "2": true} {
+		if _, ok := c.attachmentCache[key]; ok != expect {
+			t.Errorf("element '%s': wrong state after clean\nexpect cached: %t\ngot: %t", key, expect, ok)
+		}
+	}
+
+	c.insertAttachment("2", &Attachment{Name: "2", LastReference: now.Add(time.Minute)})
+	c.insertAttachment("3", &Attachment{Name: "3", LastReference: now.Add(time.Second)})
+	c.Clean()
+	if _, ok := c.attachmentCache["0"]; ok || len(c.attachmentCache) != 2 {
+		t.Errorf("wrong attachments after second clean: %d remaining", len(c.attachmentCache))
+	}
+}
+
 func TestCache_Clean(t *testing.T) {
 	t.Run("Time", testCacheCleanRef)
+	t.Run("Lifetime", testCacheCleanLifetime)
+	t.Run("Threshold", testCacheCleanThreshold)
 	t.Run("Count", testCacheCleanLeak)
+	t.Run("Order", testCacheCleanOrder)
+	t.Run("Bytes", testCacheCleanBytes)
+	t.Run("Plan", testCacheCleanPlan)
+	t.Run("Reference", testCacheCleanReference)
+}
+
+// Hammers the cache from many goroutines at once. This is only really useful
+// when run under the race detector (go test -race).
+func TestConcurrentAccess(t *testing.T) {
+	c := NewCache(MockProvider{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				if _, err := c.Channel("1234"); err != nil {
+					t.Error("Unexpected error from channel retrieval:", err)
+				}
+				if _, err := c.User("5678"); err != nil {
+					t.Error("Unexpected error from user retrieval:", err)
+				}
+				if _, err := c.Guild("9101112"); err != nil {
+					t.Error("Unexpected error from guild retrieval:", err)
+				}
+
+				switch (i + j) % 10 {
+				case 0:
+					c.InvalidateChannel("1234")
+				case 1:
+					c.InvalidateUser("5678")
+				case 2:
+					c.InvalidateGuild("9101112")
+				case 3:
+					c.Clean()
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// CountingProvider wraps MockProvider, counting calls and holding each call
+// until release is closed.
+type CountingProvider struct {
+	MockProvider
+	calls   int32
+	release chan struct{}
+}
+
+func (p *CountingProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return p.MockProvider.Channel(channelID)
+}
+
+func (p *CountingProvider) User(userID string) (*discordgo.User, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return p.MockProvider.User(userID)
+}
+
+func (p *CountingProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return p.MockProvider.Guild(guildID)
+}
+
+func (p *CountingProvider) GuildRoles(guildID string) ([]*discordgo.Role, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return p.MockProvider.GuildRoles(guildID)
+}
+
+func (p *CountingProvider) GuildEmojis(guildID string) ([]*discordgo.Emoji, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return p.MockProvider.GuildEmojis(guildID)
+}
+
+func (p *CountingProvider) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return p.MockProvider.GuildChannels(guildID)
+}
+
+func (p *CountingProvider) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return p.MockProvider.ChannelMessage(channelID, messageID)
+}
+
+// Concurrent misses for the same ID should cause exactly one provider call.
+func TestSingleFlight(t *testing.T) {
+	lookups := []struct {
+		Name      string
+		ExpectErr bool
+		Lookup    func(c *Cache) error
+	}{
+		{"Channel", false, func(c *Cache) error { _, err := c.Channel("1234"); return err }},
+		{"User", false, func(c *Cache) error { _, err := c.User("5678"); return err }},
+		{"Guild", false, func(c *Cache) error { _, err := c.Guild("9101112"); return err }},
+		{"Error", true, func(c *Cache) error { _, err := c.Channel("abcd"); return err }},
+	}
+
+	for _, l := range lookups {
+		t.Run(l.Name, func(t *testing.T) {
+			p := &CountingProvider{release: make(chan struct{})}
+			c := NewCache(p)
+			wg := sync.WaitGroup{}
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := l.Lookup(c); (err != nil) != l.ExpectErr {
+						t.Error("Unexpected error result from retrieval:", err)
+					}
+				}()
+			}
+
+			// Give every goroutine a chance to join the in-flight call
+			time.Sleep(time.Millisecond * 100)
+			close(p.release)
+			wg.Wait()
+
+			if p.calls != 1 {
+				t.Errorf("wrong number of provider calls\nexpect: 1\ngot: %d", p.calls)
+			}
+		})
+	}
+}
+
+// closeTracker records whether the body it wraps was closed.
+type closeTracker struct {
+	io.ReadCloser
+	closed *int32
+}
+
+func (c closeTracker) Close() error {
+	atomic.StoreInt32(c.closed, 1)
+	return c.ReadCloser.Close()
+}
+
+// trackingTransport wraps every response body in a closeTracker.
+type trackingTransport struct {
+	closed int32
+}
+
+func (t *trackingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = closeTracker{resp.Body, &t.closed}
+	return resp, nil
+}
+
+// A failed download must still close the response body.
+func TestAttachmentBodyClosed(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	tr := &trackingTransport{}
+	c := NewCache(MockProvider{}, WithHTTPClient(&http.Client{Transport: tr}))
+	_, err := c.Attachment(&discordgo.MessageAttachment{
+		URL:      srv.URL + "/notexist.png",
+		Filename: "notexist.png",
+	})
+	if !errors.Is(err, ErrGetFailed) {
+		t.Errorf("wrong error\nexpect: %v\ngot: %v", ErrGetFailed, err)
+	}
+	if atomic.LoadInt32(&tr.closed) == 0 {
+		t.Error("response body was not closed after failed download")
+	}
+}
+
+// A streamed attachment must be read from the CDN without being cached, closing
+// the response body along with the stream, and a cached attachment must be
+// streamed from the cache.
+func TestAttachmentStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("streamed"))
+	}))
+	defer srv.Close()
+
+	tr := &trackingTransport{}
+	c := NewCache(MockProvider{}, WithHTTPClient(&http.Client{Transport: tr}))
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.txt", Filename: "a.txt"}
+
+	rc, a, err := c.AttachmentStream(at)
+	if err != nil {
+		t.Fatal("Unexpected error from attachment stream:", err)
+	}
+	buf, err := io.ReadAll(rc)
+	if err != nil || string(buf) != "streamed" {
+		t.Errorf("wrong streamed content\nexpect: %s\ngot: %s (%v)", "streamed", buf, err)
+	}
+	if a.Name != "a.txt" || a.Content != nil {
+		t.Error("wrong attachment info returned from stream")
+	}
+	rc.Close()
+	if atomic.LoadInt32(&tr.closed) == 0 {
+		t.Error("response body was not closed along with stream")
+	}
+	if c.Stats().Attachment.Entries != 0 {
+		t.Error("streamed attachment was cached")
+	}
+
+	c.mu.Lock()
+	c.insertAttachment(at.URL, &Attachment{Name: "a.txt", Content: []byte("cached")})
+	c.mu.Unlock()
+	rc, _, err = c.AttachmentStream(at)
+	if err != nil {
+		t.Fatal("Unexpected error from cached attachment stream:", err)
+	}
+	defer rc.Close()
+	if buf, _ := io.ReadAll(rc); string(buf) != "cached" {
+		t.Errorf("wrong cached content\nexpect: %s\ngot: %s", "cached", buf)
+	}
+}
+
+// A download larger than the size limit must fail without being cached,
+// whether or not the response declares its length.
+func TestAttachmentTooLarge(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Handler http.HandlerFunc
+	}{
+		{"ContentLength", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("0123456789"))
+		}},
+		{"Chunked", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("01234"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("56789"))
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.Handler)
+			defer srv.Close()
+
+			c := NewCache(MockProvider{}, WithMaxAttachmentSize(8))
+			_, err := c.Attachment(&discordgo.MessageAttachment{URL: srv.URL})
+			if !errors.Is(err, ErrTooLarge) {
+				t.Errorf("wrong error\nexpect: %v\ngot: %v", ErrTooLarge, err)
+			}
+			if c.Stats().Attachment.Entries != 0 {
+				t.Error("oversized attachment was cached")
+			}
+
+			// Exactly the limit is fine
+			c = NewCache(MockProvider{}, WithMaxAttachmentSize(10))
+			if a, err := c.Attachment(&discordgo.MessageAttachment{URL: srv.URL}); err != nil || len(a.Content) != 10 {
+				t.Errorf("failed to download attachment at size limit: %v", err)
+			}
+		})
+	}
+}
+
+// Transient download failures must be retried, while client errors must fail
+// on the first attempt.
+func TestAttachmentRetry(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Status   int
+		Failures int32
+		Attempts int
+		Expect   int32
+		Err      error
+	}{
+		{"Recovers", http.StatusServiceUnavailable, 2, 3, 3, nil},
+		{"Exhausted", http.StatusBadGateway, 5, 3, 3, ErrGetFailed},
+		{"ClientError", http.StatusNotFound, 5, 3, 1, ErrGetFailed},
+		{"SingleShot", http.StatusServiceUnavailable, 5, 1, 1, ErrGetFailed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var hits int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&hits, 1) <= tc.Failures {
+					w.WriteHeader(tc.Status)
+					return
+				}
+				w.Write([]byte("content"))
+			}))
+			defer srv.Close()
+
+			c := NewCache(MockProvider{}, WithRetry(tc.Attempts, time.Millisecond))
+			_, err := c.Attachment(&discordgo.MessageAttachment{URL: srv.URL})
+			if !errors.Is(err, tc.Err) {
+				t.Errorf("wrong error\nexpect: %v\ngot: %v", tc.Err, err)
+			}
+			if hits != tc.Expect {
+				t.Errorf("wrong number of attempts\nexpect: %d\ngot: %d", tc.Expect, hits)
+			}
+		})
+	}
+}
+
+// Downloads rejected by a rate limit must wait as long as the CDN asks before
+// retrying, and fail with the wait once no attempts remain.
+func TestAttachmentRetryAfter(t *testing.T) {
+	var hits int32
+	limited := int32(1)
+	retryAfter := "0.05"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) <= atomic.LoadInt32(&limited) {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	// The delay of the retry policy is ignored in favour of Retry-After
+	c := NewCache(MockProvider{}, WithRetry(3, time.Hour))
+	start := time.Now()
+	a, err := c.Attachment(&discordgo.MessageAttachment{URL: srv.URL + "/1"})
+	if err != nil || string(a.Content) != "content" {
+		t.Errorf("download did not recover from rate limit: %v", err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond || d > time.Second {
+		t.Errorf("wrong wait before retry\nexpect: 50ms\ngot: %s", d)
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	atomic.StoreInt32(&limited, 5)
+	c = NewCache(MockProvider{}, WithRetry(2, time.Millisecond))
+	_, err = c.Attachment(&discordgo.MessageAttachment{URL: srv.URL + "/2"})
+	var rlerr *RateLimitError
+	if !errors.As(err, &rlerr) || !errors.Is(err, ErrRateLimited) || !errors.Is(err, ErrGetFailed) {
+		t.Fatalf("wrong error once attempts exhausted\nexpect: %v\ngot: %v", ErrRateLimited, err)
+	}
+	if rlerr.RetryAfter != 50*time.Millisecond || hits != 2 {
+		t.Errorf("wrong rate limit error\nexpect: 50ms after 2 attempts\ngot: %s after %d", rlerr.RetryAfter, hits)
+	}
+}
+
+// Retries must not wait beyond the context deadline.
+func TestAttachmentRetryDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{}, WithRetry(5, time.Second*10))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.AttachmentContext(ctx, &discordgo.MessageAttachment{URL: srv.URL})
+	if !errors.Is(err, ErrGetFailed) {
+		t.Errorf("wrong error\nexpect: %v\ngot: %v", ErrGetFailed, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("retry waited beyond context deadline")
+	}
+}
+
+// A cached attachment past its TTL must be revalidated with its ETag, only
+// being downloaded again if it has changed.
+func TestAttachmentRevalidate(t *testing.T) {
+	var full, notModified int32
+	etag := `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(etag))
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{}, WithTTL(TypeAttachment, time.Minute))
+	at := &discordgo.MessageAttachment{URL: srv.URL}
+	age := func() {
+		c.mu.Lock()
+		c.attachmentCache[at.URL].validated = time.Now().Add(-time.Hour)
+		c.mu.Unlock()
+	}
+
+	a, err := c.Attachment(at)
+	if err != nil || a.ETag != etag {
+		t.Fatalf("wrong ETag stored\nexpect: %s\ngot: %s (%v)", etag, a.ETag, err)
+	}
+
+	// Within the TTL, no request is made
+	c.Attachment(at)
+	if full != 1 || notModified != 0 {
+		t.Errorf("unexpected request within TTL\nfull: %d\nnot modified: %d", full, notModified)
+	}
+
+	age()
+	if a, err := c.Attachment(at); err != nil || string(a.Content) != `"v1"` {
+		t.Error("wrong content after 304 revalidation:", err)
+	}
+	if full != 1 || notModified != 1 {
+		t.Errorf("expected a single 304 revalidation\nfull: %d\nnot modified: %d", full, notModified)
+	}
+
+	etag = `"v2"`
+	age()
+	if a, err := c.Attachment(at); err != nil || string(a.Content) != `"v2"` || a.ETag != `"v2"` {
+		t.Error("changed attachment was not downloaded again:", err)
+	}
+	if full != 2 {
+		t.Errorf("wrong number of full downloads\nexpect: 2\ngot: %d", full)
+	}
+}
+
+// Downloads must be checked against the allowed types using the Content-Type of
+// the response rather than that reported by the API.
+func TestAttachmentAllowedTypes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Name    string
+		Allowed []string
+		Type    string
+		Err     error
+	}{
+		{"Exact", []string{"image/png"}, "image/png", nil},
+		{"Parameters", []string{"text/plain"}, "text/plain; charset=utf-8", nil},
+		{"Wildcard", []string{"video/mp4", "image/*"}, "image/gif", nil},
+		{"Disallowed", []string{"image/*"}, "application/x-msdownload", ErrDisallowedType},
+		{"Missing", []string{"image/*"}, "", ErrDisallowedType},
+		{"Empty", nil, "application/x-msdownload", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := NewCache(MockProvider{}, WithAllowedTypes(tc.Allowed...))
+			_, err := c.Attachment(&discordgo.MessageAttachment{
+				URL:         srv.URL + "/?type=" + url.QueryEscape(tc.Type),
+				ContentType: "image/png",
+			})
+			if !errors.Is(err, tc.Err) {
+				t.Errorf("wrong error\nexpect: %v\ngot: %v", tc.Err, err)
+			}
+			if tc.Err != nil && c.AttachmentLen() != 0 {
+				t.Error("disallowed attachment was cached")
+			}
+		})
+	}
+}
+
+// A stalled download must give up after the client timeout.
+func TestAttachmentTimeout(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Handler http.HandlerFunc
+	}{
+		{"Headers", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond * 500)
+		}},
+		{"Body", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond * 500)
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.Handler)
+			defer srv.Close()
+
+			c := NewCache(MockProvider{}, WithHTTPClient(&http.Client{Timeout: time.Millisecond * 100}))
+			_, err := c.Attachment(&discordgo.MessageAttachment{URL: srv.URL})
+			if !errors.Is(err, ErrRequest) {
+				t.Errorf("wrong error\nexpect: %v\ngot: %v", ErrRequest, err)
+			}
+		})
+	}
+}
+
+// Cancelling a lookup must return promptly with the context's error.
+func TestContextCancel(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	defer close(p.release)
+	c := NewCache(p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if _, err := c.ChannelContext(ctx, "1234"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error from channel retrieval\nexpect: %v\ngot: %v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.UserContext(ctx, "5678"); !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error from user retrieval\nexpect: %v\ngot: %v", context.Canceled, err)
+	}
+}
+
+// Cancelling an attachment lookup must abort the download.
+func TestAttachmentContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		cancel()
+	}()
+
+	_, err := c.AttachmentContext(ctx, &discordgo.MessageAttachment{URL: srv.URL})
+	if !errors.Is(err, ErrRequest) || !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error\nexpect: %v and %v\ngot: %v", ErrRequest, context.Canceled, err)
+	}
+	if _, ok := c.attachmentCache[srv.URL]; ok {
+		t.Error("inserted into cache despite cancelled download")
+	}
+}
+
+func TestAddAttachment(t *testing.T) {
+	url := "http://invalid.invalid/a.png"
+	c := NewCache(MockProvider{})
+	c.AddAttachment(url, "a.png", "image/png", []byte("content"))
+
+	a, err := c.Attachment(&discordgo.MessageAttachment{URL: url})
+	if err != nil {
+		t.Fatal("Unexpected error from added attachment retrieval:", err)
+	}
+	if a.Name != "a.png" || a.Type != "image/png" || string(a.Content) != "content" {
+		t.Errorf("wrong attachment returned: %+v", a)
+	}
+	if s := c.Stats().Attachment; s.Hits != 1 || s.Misses != 0 {
+		t.Errorf("added attachment was not a hit: %+v", s)
+	}
+}
+
+func TestHas(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p, WithTTL(TypeGuild, time.Minute))
+
+	if c.HasChannel("1234") || c.HasUser("5678") || c.HasGuild("9101112") || c.HasAttachment("a") {
+		t.Error("empty cache reported membership")
+	}
+	if p.calls != 0 {
+		t.Errorf("membership check called provider %d times", p.calls)
+	}
+
+	c.Channel("1234")
+	c.User("5678")
+	c.mu.Lock()
+	c.insertAttachment("a", &Attachment{})
+	c.mu.Unlock()
+	expired := discordgo.Guild{ID: "9101112"}
+	c.guilds.set("9101112", &entry[discordgo.Guild]{val: &expired, inserted: time.Now().Add(-time.Hour)})
+
+	if !c.HasChannel("1234") || !c.HasUser("5678") || !c.HasAttachment("a") {
+		t.Error("cached entries not reported as members")
+	}
+	if c.HasGuild("9101112") {
+		t.Error("expired guild reported as member")
+	}
+	if s := c.Stats().Channel; s.Hits != 0 {
+		t.Error("membership check counted as a hit")
+	}
+}
+
+// SharedProvider returns the same channel object from every lookup.
+type SharedProvider struct {
+	MockProvider
+	ch *discordgo.Channel
+}
+
+func (p SharedProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	return p.ch, nil
+}
+
+func TestCopyOnInsert(t *testing.T) {
+	p := SharedProvider{ch: &discordgo.Channel{ID: "1234", Name: "Original"}}
+	c := NewCache(p)
+
+	ch, err := c.Channel("1234")
+	if err != nil {
+		t.Fatal("Unexpected error from channel retrieval:", err)
+	}
+	p.ch.Name = "Mutated"
+	ch.Name = "Mutated"
+
+	if ch, _ := c.Channel("1234"); ch.Name != "Original" {
+		t.Errorf("cached channel was mutated\nexpect: Original\ngot: %s", ch.Name)
+	}
+}
+
+// Concurrent lookups of the same url should cause exactly one download, and a
+// failed download should not prevent a later one.
+func TestAttachmentInFlight(t *testing.T) {
+	var hits int32
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 && r.URL.Path == "/a.png" {
+			close(started)
+			<-release
+		}
+		if r.URL.Path == "/missing.png" && atomic.LoadInt32(&hits) == 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{})
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.png", Filename: "a.png"}
+
+	var wg sync.WaitGroup
+	results := make([]Attachment, 2)
+	errs := make([]error, 2)
+	lookup := func(i int) {
+		defer wg.Done()
+		results[i], errs[i] = c.Attachment(at)
+	}
+	wg.Add(2)
+	go lookup(0)
+	<-started
+	go lookup(1)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] != nil || string(results[i].Content) != "content" {
+			t.Errorf("lookup %d: failed to retrieve attachment: %v", i, errs[i])
+		}
+	}
+	if hits != 1 {
+		t.Errorf("wrong number of downloads\nexpect: 1\ngot: %d", hits)
+	}
+
+	// The in-flight entry of a failed download is released
+	missing := &discordgo.MessageAttachment{URL: srv.URL + "/missing.png"}
+	if _, err := c.Attachment(missing); err == nil {
+		t.Error("expected error from failed download")
+	}
+	if a, err := c.Attachment(missing); err != nil || string(a.Content) != "content" {
+		t.Error("failed to retry download after failure:", err)
+	}
+	if hits != 3 {
+		t.Errorf("wrong number of downloads\nexpect: 3\ngot: %d", hits)
+	}
+}
+
+// With attachment caching disabled, every lookup must download the attachment
+// afresh without retaining it.
+func TestAttachmentCachingDisabled(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{}, WithAttachmentCaching(false), WithAttachmentDir(t.TempDir()))
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.png", Filename: "a.png"}
+	for i := 0; i < 2; i++ {
+		a, err := c.Attachment(at)
+		if err != nil || string(a.Content) != "content" || a.Path != "" {
+			t.Errorf("lookup %d: failed to download attachment: %v", i, err)
+		}
+		if a.Checksum != sha256.Sum256([]byte("content")) {
+			t.Errorf("lookup %d: wrong checksum", i)
+		}
+	}
+	c.AddAttachment("added", "added.png", "image/png", []byte("added"))
+	if err := c.PrefetchAttachments(context.Background(), []*discordgo.MessageAttachment{at}); err != nil {
+		t.Error("Unexpected error from prefetch:", err)
+	}
+
+	if hits != 2 {
+		t.Errorf("wrong number of downloads\nexpect: 2\ngot: %d", hits)
+	}
+	if n := c.AttachmentLen(); n != 0 {
+		t.Errorf("attachments were retained\nexpect: 0\ngot: %d", n)
+	}
+	if s := c.Stats().Attachment; s.Hits != 0 || s.Misses != 2 {
+		t.Errorf("wrong attachment stats\nexpect: 0 hits, 2 misses\ngot: %d hits, %d misses", s.Hits, s.Misses)
+	}
+}
+
+func TestAttachmentWithMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	clock := NewFakeClock()
+	c := NewCache(MockProvider{}, WithClock(clock))
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.png", Filename: "a.png"}
+
+	a, fresh, age, err := c.AttachmentWithMeta(at)
+	if err != nil || string(a.Content) != "content" {
+		t.Fatal("Unexpected error from attachment download:", err)
+	}
+	if !fresh || age != 0 {
+		t.Errorf("wrong meta for download\nexpect: fresh, age 0s\ngot: fresh %v, age %v", fresh, age)
+	}
+
+	// The age of a hit is the time since the previous reference
+	for i, expect := range []time.Duration{time.Minute, time.Second} {
+		clock.Advance(expect)
+		a, fresh, age, err = c.AttachmentWithMeta(at)
+		if err != nil || string(a.Content) != "content" {
+			t.Errorf("hit %d: unexpected error from attachment lookup: %v", i, err)
+		}
+		if fresh || age != expect {
+			t.Errorf("hit %d: wrong meta\nexpect: not fresh, age %v\ngot: fresh %v, age %v", i, expect, fresh, age)
+		}
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	for _, n := range []int{4, 0} {
+		tr := NewTransport(n)
+		if !tr.ForceAttemptHTTP2 {
+			t.Errorf("%d: transport does not attempt HTTP/2", n)
+		}
+		if tr.MaxConnsPerHost != n {
+			t.Errorf("%d: wrong connection limit\nexpect: %d\ngot: %d", n, n, tr.MaxConnsPerHost)
+		}
+		if tr.MaxIdleConnsPerHost <= 0 || tr.MaxIdleConns < tr.MaxIdleConnsPerHost {
+			t.Errorf("%d: idle connections not kept per host: %d of %d",
+				n, tr.MaxIdleConnsPerHost, tr.MaxIdleConns)
+		}
+		if tr.IdleConnTimeout != DefaultIdleConnTimeout {
+			t.Errorf("%d: wrong idle timeout\nexpect: %v\ngot: %v", n, DefaultIdleConnTimeout, tr.IdleConnTimeout)
+		}
+	}
+}
+
+// Downloads over a cold pool make a TLS handshake each, while downloads over a
+// warm pool reuse the same connection.
+func BenchmarkAttachmentDownload(b *testing.B) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	newClient := func() *http.Client {
+		tr := NewTransport(DefaultMaxConnsPerHost)
+		tr.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+		return &http.Client{Transport: tr, Timeout: DefaultHTTPTimeout}
+	}
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.png", Filename: "a.png"}
+	download := func(b *testing.B, c *Cache) {
+		if _, err := c.Attachment(at); err != nil {
+			b.Fatal("Unexpected error from attachment download:", err)
+		}
+	}
+
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			client := newClient()
+			download(b, NewCache(MockProvider{}, WithAttachmentCaching(false), WithHTTPClient(client)))
+			client.CloseIdleConnections()
+		}
+	})
+	b.Run("warm", func(b *testing.B) {
+		client := newClient()
+		defer client.CloseIdleConnections()
+		c := NewCache(MockProvider{}, WithAttachmentCaching(false), WithHTTPClient(client))
+		download(b, c)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			download(b, c)
+		}
+	})
 }
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ChannelCached is like Channel, but also returns whether the channel was
+// served from the cache rather than looked up with the provider, such that
+// callers may attribute latency or count hits themselves. A lookup of a
+// channel known not to exist (see WithNegativeTTL) is also served from the
+// cache.
+func (c *Cache) ChannelCached(ID string) (discordgo.Channel, bool, error) {
+	return c.ChannelCachedContext(context.Background(), ID)
+}
+
+// ChannelCachedContext is like ChannelCached, but with the context handling
+// of ChannelContext.
+func (c *Cache) ChannelCachedContext(ctx context.Context, ID string) (discordgo.Channel, bool, error) {
+	v, hit, err := c.channels.lookupCached(ctx, ID, func(ctx context.Context) (*discordgo.Channel, error) {
+		return fetchChannel(ctx, c.provider, ID)
+	})
+	if err != nil {
+		return discordgo.Channel{}, hit, err
+	}
+
+	return *v, hit, nil
+}
+
+// UserCached is like ChannelCached, but for users.
+func (c *Cache) UserCached(ID string) (discordgo.User, bool, error) {
+	return c.UserCachedContext(context.Background(), ID)
+}
+
+// UserCachedContext is like ChannelCachedContext, but for users.
+func (c *Cache) UserCachedContext(ctx context.Context, ID string) (discordgo.User, bool, error) {
+	v, hit, err := c.users.lookupCached(ctx, ID, func(ctx context.Context) (*discordgo.User, error) {
+		return fetchUser(ctx, c.provider, ID)
+	})
+	if err != nil {
+		return discordgo.User{}, hit, err
+	}
+
+	return *v, hit, nil
+}
+
+// GuildCached is like ChannelCached, but for guilds.
+func (c *Cache) GuildCached(ID string) (discordgo.Guild, bool, error) {
+	return c.GuildCachedContext(context.Background(), ID)
+}
+
+// GuildCachedContext is like ChannelCachedContext, but for guilds.
+func (c *Cache) GuildCachedContext(ctx context.Context, ID string) (discordgo.Guild, bool, error) {
+	v, hit, err := c.guilds.lookupCached(ctx, ID, func(ctx context.Context) (*discordgo.Guild, error) {
+		return fetchGuild(ctx, c.provider, ID)
+	})
+	if err != nil {
+		return discordgo.Guild{}, hit, err
+	}
+
+	return *v, hit, nil
+}
+
+// MemberCached is like ChannelCached, but for the member userID of guild
+// guildID.
+func (c *Cache) MemberCached(guildID, userID string) (discordgo.Member, bool, error) {
+	return c.MemberCachedContext(context.Background(), guildID, userID)
+}
+
+// MemberCachedContext is like ChannelCachedContext, but for the member userID
+// of guild guildID.
+func (c *Cache) MemberCachedContext(ctx context.Context, guildID, userID string) (discordgo.Member, bool, error) {
+	v, hit, err := c.members.lookupCached(ctx, memberKey(guildID, userID), func(ctx context.Context) (*discordgo.Member, error) {
+		return fetchMember(ctx, c.provider, guildID, userID)
+	})
+	if err != nil {
+		return discordgo.Member{}, hit, err
+	}
+
+	return *v, hit, nil
+}
@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCached(t *testing.T) {
+	c := NewCache(&ErrorProvider{Err: notFoundError(discordgo.ErrCodeUnknownUser)}, WithNegativeTTL(time.Minute))
+	if _, hit, err := c.UserCached("1234"); err == nil || hit {
+		t.Errorf("wrong result of failed lookup\nexpect hit: false\ngot: %t (%v)", hit, err)
+	}
+	if _, hit, err := c.UserCached("1234"); err == nil || !hit {
+		t.Errorf("wrong result of negatively cached lookup\nexpect hit: true\ngot: %t (%v)", hit, err)
+	}
+
+	c = NewCache(MockProvider{})
+	for i, expect := range []bool{false, true} {
+		ch, hit, err := c.ChannelCached("1234")
+		if err != nil || ch.Name != "Testing Channel" {
+			t.Fatal("Unexpected error from channel retrieval:", err)
+		}
+		if hit != expect {
+			t.Errorf("lookup %d: wrong cache hit flag\nexpect: %t\ngot: %t", i, expect, hit)
+		}
+	}
+	if _, hit, err := c.MemberCached("9101112", "5678"); err != nil || hit {
+		t.Errorf("wrong result of member lookup\nexpect hit: false\ngot: %t (%v)", hit, err)
+	}
+}
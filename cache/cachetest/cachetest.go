@@ -0,0 +1,357 @@
+// Package cachetest provides an in-memory provider for testing code built on
+// the cache, without making any calls to the Discord API.
+package cachetest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/ethanv2/disdup/cache"
+)
+
+// *Provider implements every provider interface but the context providers,
+// such as cache.ContextProvider, as it makes no calls which could be abandoned.
+var (
+	_ cache.Provider                = (*Provider)(nil)
+	_ cache.MemberProvider          = (*Provider)(nil)
+	_ cache.RoleProvider            = (*Provider)(nil)
+	_ cache.EmojiProvider           = (*Provider)(nil)
+	_ cache.GuildChannelsProvider   = (*Provider)(nil)
+	_ cache.StickerProvider         = (*Provider)(nil)
+	_ cache.MessageProvider         = (*Provider)(nil)
+	_ cache.ChannelMessagesProvider = (*Provider)(nil)
+)
+
+// Provider is a provider which serves objects from its maps and counts the
+// calls made to each of its methods, such that tests can check how often the
+// cache called the provider. Objects absent from the maps are reported with
+// the same error as the Discord API returns for unknown objects, which the
+// cache treats as the object not existing.
+//
+// The maps may be set directly before the provider is used, but must not be
+// modified while it may be called; use the Add methods to add objects
+// concurrently with lookups instead.
+type Provider struct {
+	mu sync.Mutex
+
+	Channels map[string]*discordgo.Channel
+	Users    map[string]*discordgo.User
+	Guilds   map[string]*discordgo.Guild
+	// Members of each guild, keyed by guild and then user ID.
+	Members map[string]map[string]*discordgo.Member
+	// Roles and emojis of each guild, keyed by guild ID.
+	Roles    map[string][]*discordgo.Role
+	Emojis   map[string][]*discordgo.Emoji
+	Stickers map[string]*discordgo.Sticker
+	// Messages of each channel, keyed by channel and then message ID.
+	Messages map[string]map[string]*discordgo.Message
+
+	// Err, if not nil, is returned by every call instead of an object.
+	Err error
+
+	calls map[string]int
+}
+
+// NewProvider returns a provider with empty maps.
+func NewProvider() *Provider {
+	return &Provider{
+		Channels: make(map[string]*discordgo.Channel),
+		Users:    make(map[string]*discordgo.User),
+		Guilds:   make(map[string]*discordgo.Guild),
+		Members:  make(map[string]map[string]*discordgo.Member),
+		Roles:    make(map[string][]*discordgo.Role),
+		Emojis:   make(map[string][]*discordgo.Emoji),
+		Stickers: make(map[string]*discordgo.Sticker),
+		Messages: make(map[string]map[string]*discordgo.Message),
+	}
+}
+
+// Calls returns the number of calls made to the method named method, such as
+// "Channel" or "GuildMember".
+func (p *Provider) Calls(method string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.calls[method]
+}
+
+// TotalCalls returns the number of calls made to every method.
+func (p *Provider) TotalCalls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, c := range p.calls {
+		n += c
+	}
+	return n
+}
+
+// ResetCalls forgets every call made so far.
+func (p *Provider) ResetCalls() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls = nil
+}
+
+// AddChannel adds ch, replacing any channel with the same ID.
+func (p *Provider) AddChannel(ch *discordgo.Channel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Channels == nil {
+		p.Channels = make(map[string]*discordgo.Channel)
+	}
+	p.Channels[ch.ID] = ch
+}
+
+// AddUser is like AddChannel, but for users.
+func (p *Provider) AddUser(u *discordgo.User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Users == nil {
+		p.Users = make(map[string]*discordgo.User)
+	}
+	p.Users[u.ID] = u
+}
+
+// AddGuild is like AddChannel, but for guilds.
+func (p *Provider) AddGuild(g *discordgo.Guild) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Guilds == nil {
+		p.Guilds = make(map[string]*discordgo.Guild)
+	}
+	p.Guilds[g.ID] = g
+}
+
+// AddMember is like AddChannel, but for the member m of guild guildID, which
+// must have a user.
+func (p *Provider) AddMember(guildID string, m *discordgo.Member) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Members == nil {
+		p.Members = make(map[string]map[string]*discordgo.Member)
+	}
+	if p.Members[guildID] == nil {
+		p.Members[guildID] = make(map[string]*discordgo.Member)
+	}
+	p.Members[guildID][m.User.ID] = m
+}
+
+// AddMessage is like AddChannel, but for messages.
+func (p *Provider) AddMessage(m *discordgo.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Messages == nil {
+		p.Messages = make(map[string]map[string]*discordgo.Message)
+	}
+	if p.Messages[m.ChannelID] == nil {
+		p.Messages[m.ChannelID] = make(map[string]*discordgo.Message)
+	}
+	p.Messages[m.ChannelID][m.ID] = m
+}
+
+// call records a call to method, returning p.Err.
+func (p *Provider) call(method string) error {
+	if p.calls == nil {
+		p.calls = make(map[string]int)
+	}
+	p.calls[method]++
+
+	return p.Err
+}
+
+// unknown returns the error returned by the Discord API for an unknown object,
+// given by its JSON error code.
+func unknown(code int, what, id string) error {
+	msg := &discordgo.APIErrorMessage{Code: code, Message: fmt.Sprintf("Unknown %s %s", what, id)}
+	return &discordgo.RESTError{
+		Response:     &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found"},
+		ResponseBody: []byte(fmt.Sprintf(`{"code":%d,"message":%q}`, msg.Code, msg.Message)),
+		Message:      msg,
+	}
+}
+
+// find returns a copy of the object under key in m, or the error for an
+// unknown object with code.
+func find[T any](m map[string]*T, key string, code int, what string) (*T, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, unknown(code, what, key)
+	}
+
+	cp := *v
+	return &cp, nil
+}
+
+// copyAll returns a copy of each element of s.
+func copyAll[T any](s []*T) []*T {
+	cp := make([]*T, len(s))
+	for i, v := range s {
+		val := *v
+		cp[i] = &val
+	}
+
+	return cp
+}
+
+func (p *Provider) Channel(channelID string) (*discordgo.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("Channel"); err != nil {
+		return nil, err
+	}
+
+	return find(p.Channels, channelID, discordgo.ErrCodeUnknownChannel, "Channel")
+}
+
+func (p *Provider) User(userID string) (*discordgo.User, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("User"); err != nil {
+		return nil, err
+	}
+
+	return find(p.Users, userID, discordgo.ErrCodeUnknownUser, "User")
+}
+
+func (p *Provider) Guild(guildID string) (*discordgo.Guild, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("Guild"); err != nil {
+		return nil, err
+	}
+
+	return find(p.Guilds, guildID, discordgo.ErrCodeUnknownGuild, "Guild")
+}
+
+func (p *Provider) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("GuildMember"); err != nil {
+		return nil, err
+	}
+
+	return find(p.Members[guildID], userID, discordgo.ErrCodeUnknownMember, "Member")
+}
+
+func (p *Provider) GuildRoles(guildID string) ([]*discordgo.Role, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("GuildRoles"); err != nil {
+		return nil, err
+	}
+
+	roles, ok := p.Roles[guildID]
+	if !ok {
+		return nil, unknown(discordgo.ErrCodeUnknownGuild, "Guild", guildID)
+	}
+	return copyAll(roles), nil
+}
+
+func (p *Provider) GuildEmojis(guildID string) ([]*discordgo.Emoji, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("GuildEmojis"); err != nil {
+		return nil, err
+	}
+
+	emojis, ok := p.Emojis[guildID]
+	if !ok {
+		return nil, unknown(discordgo.ErrCodeUnknownGuild, "Guild", guildID)
+	}
+	return copyAll(emojis), nil
+}
+
+// GuildChannels returns every channel in Channels of guild guildID.
+func (p *Provider) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("GuildChannels"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.Guilds[guildID]; !ok {
+		return nil, unknown(discordgo.ErrCodeUnknownGuild, "Guild", guildID)
+	}
+	var channels []*discordgo.Channel
+	for _, ch := range p.Channels {
+		if ch.GuildID == guildID {
+			cp := *ch
+			channels = append(channels, &cp)
+		}
+	}
+	return channels, nil
+}
+
+func (p *Provider) Sticker(stickerID string) (*discordgo.Sticker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("Sticker"); err != nil {
+		return nil, err
+	}
+
+	return find(p.Stickers, stickerID, discordgo.ErrCodeUnknownSticker, "Sticker")
+}
+
+func (p *Provider) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("ChannelMessage"); err != nil {
+		return nil, err
+	}
+
+	return find(p.Messages[channelID], messageID, discordgo.ErrCodeUnknownMessage, "Message")
+}
+
+// ChannelMessages pages the messages of channel channelID as the Discord API
+// does, newest first, comparing message IDs as snowflakes. Paging around a
+// message is not supported.
+func (p *Provider) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.call("ChannelMessages"); err != nil {
+		return nil, err
+	}
+	if aroundID != "" {
+		return nil, fmt.Errorf("cachetest: paging around a message is not supported")
+	}
+	if _, ok := p.Channels[channelID]; !ok && p.Messages[channelID] == nil {
+		return nil, unknown(discordgo.ErrCodeUnknownChannel, "Channel", channelID)
+	}
+
+	var page []*discordgo.Message
+	for id, m := range p.Messages[channelID] {
+		if (beforeID == "" || older(id, beforeID)) && (afterID == "" || older(afterID, id)) {
+			page = append(page, m)
+		}
+	}
+	sort.Slice(page, func(i, j int) bool { return older(page[j].ID, page[i].ID) })
+	if limit > 0 && len(page) > limit {
+		if afterID != "" {
+			page = page[len(page)-limit:]
+		} else {
+			page = page[:limit]
+		}
+	}
+
+	return copyAll(page), nil
+}
+
+// older returns true if the snowflake a was created before the snowflake b.
+func older(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
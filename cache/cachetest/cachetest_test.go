@@ -0,0 +1,55 @@
+package cachetest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/ethanv2/disdup/cache"
+)
+
+func TestProvider(t *testing.T) {
+	p := NewProvider()
+	p.AddChannel(&discordgo.Channel{ID: "1", GuildID: "2", Name: "general"})
+	p.AddGuild(&discordgo.Guild{ID: "2", Name: "Guild"})
+	p.AddMember("2", &discordgo.Member{User: &discordgo.User{ID: "3"}, Nick: "Nick"})
+	p.Roles["2"] = []*discordgo.Role{{ID: "4", Name: "Role"}}
+	p.AddMessage(&discordgo.Message{ID: "5", ChannelID: "1", Content: "Hello"})
+	c := cache.NewCache(p, cache.WithNegativeTTL(cache.DefaultTTL))
+
+	for i := 0; i < 2; i++ {
+		if ch, err := c.Channel("1"); err != nil || ch.Name != "general" {
+			t.Error("failed to retrieve channel:", err)
+		}
+		if m, err := c.Member("2", "3"); err != nil || m.Nick != "Nick" {
+			t.Error("failed to retrieve member:", err)
+		}
+		if r, err := c.Role("2", "4"); err != nil || r.Name != "Role" {
+			t.Error("failed to retrieve role:", err)
+		}
+		if m, err := c.Message("1", "5"); err != nil || m.Content != "Hello" {
+			t.Error("failed to retrieve message:", err)
+		}
+		if _, err := c.User("6"); !errors.Is(err, cache.ErrNotFound) {
+			t.Errorf("wrong error for unknown user\nexpect: %v\ngot: %v", cache.ErrNotFound, err)
+		}
+	}
+
+	for _, method := range []string{"Channel", "GuildMember", "GuildRoles", "ChannelMessage", "User"} {
+		if n := p.Calls(method); n != 1 {
+			t.Errorf("%s: wrong number of calls\nexpect: 1\ngot: %d", method, n)
+		}
+	}
+	if n := p.TotalCalls(); n != 5 {
+		t.Errorf("wrong total number of calls\nexpect: 5\ngot: %d", n)
+	}
+
+	p.ResetCalls()
+	p.Err = errors.New("unavailable")
+	if _, err := c.Guild("2"); !errors.Is(err, p.Err) {
+		t.Errorf("wrong error from failing provider\nexpect: %v\ngot: %v", p.Err, err)
+	}
+	if n := p.Calls("Guild"); n != 1 {
+		t.Errorf("wrong number of calls after reset\nexpect: 1\ngot: %d", n)
+	}
+}
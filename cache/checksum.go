@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+)
+
+// AttachmentByChecksum returns a cached attachment whose content has the
+// SHA-256 checksum sum, such that attachments with identical content under
+// different urls can be detected. If several cached attachments have the same
+// content, any one of them is returned. Nothing is downloaded; if no cached
+// attachment matches, ErrMissing is returned. As with a lookup, the reference
+// time of the attachment returned is updated.
+func (c *Cache) AttachmentByChecksum(sum [sha256.Size]byte) (Attachment, error) {
+	if c.closed.Load() {
+		return Attachment{}, ErrClosed
+	}
+
+	for {
+		c.mu.RLock()
+		var key string
+		for k := range c.checksums[sum] {
+			key = k
+			break
+		}
+		c.mu.RUnlock()
+		if key == "" {
+			return Attachment{}, ErrMissing
+		}
+
+		a, ok := c.cachedAttachment(key)
+		if !ok {
+			// Evicted in the meantime
+			continue
+		}
+		err := loadAttachment(&a)
+		if err == nil {
+			return a, nil
+		}
+		// Its backing file has been lost or corrupted
+		c.discardAttachment(key, err)
+	}
+}
+
+// indexChecksum records that the attachment under key has checksum sum.
+// Attachments without a checksum are not indexed. c.mu must be held.
+func (c *Cache) indexChecksum(key string, sum [sha256.Size]byte) {
+	if sum == [sha256.Size]byte{} {
+		return
+	}
+
+	keys, ok := c.checksums[sum]
+	if !ok {
+		keys = make(map[string]bool)
+		c.checksums[sum] = keys
+	}
+	keys[key] = true
+}
+
+// unindexChecksum removes the record that the attachment under key has
+// checksum sum. c.mu must be held.
+func (c *Cache) unindexChecksum(key string, sum [sha256.Size]byte) {
+	keys, ok := c.checksums[sum]
+	if !ok {
+		return
+	}
+
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(c.checksums, sum)
+	}
+}
+
+// matchesChecksum returns true if buf has the checksum sum, or if sum is zero,
+// as attachments without a checksum cannot be verified.
+func matchesChecksum(buf []byte, sum [sha256.Size]byte) bool {
+	return sum == [sha256.Size]byte{} || sha256.Sum256(buf) == sum
+}
+
+// verifyFile returns ErrCorrupt if the content of f does not have the checksum
+// sum, leaving f at its start.
+func verifyFile(f *os.File, sum [sha256.Size]byte) error {
+	if sum == [sha256.Size]byte{} {
+		return nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), sum[:]) {
+		return ErrCorrupt
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// checkedReader is a stream which verifies its content against the checksum
+// sum as it is read. If the content does not match, corrupt is called and
+// ErrCorrupt is returned in place of io.EOF.
+type checkedReader struct {
+	io.ReadCloser
+	hash    hash.Hash
+	sum     [sha256.Size]byte
+	corrupt func()
+	err     error
+}
+
+func (r *checkedReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(r.hash.Sum(nil), r.sum[:]) {
+		r.corrupt()
+		r.err = ErrCorrupt
+		return n, r.err
+	}
+
+	return n, err
+}
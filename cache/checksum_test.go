@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAttachmentChecksum(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("same bytes"))
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{})
+	sum := sha256.Sum256([]byte("same bytes"))
+	if _, err := c.AttachmentByChecksum(sum); err != ErrMissing {
+		t.Error("Expected ErrMissing from empty cache, got:", err)
+	}
+
+	for _, path := range []string{"/a.png", "/b.png"} {
+		a, err := c.Attachment(&discordgo.MessageAttachment{URL: srv.URL + path})
+		if err != nil {
+			t.Fatal("Unexpected error from attachment retrieval:", err)
+		}
+		if a.Checksum != sum {
+			t.Errorf("wrong checksum for %s\nexpect: %x\ngot: %x", path, sum, a.Checksum)
+		}
+	}
+
+	a, err := c.AttachmentByChecksum(sum)
+	if err != nil || string(a.Content) != "same bytes" {
+		t.Error("failed to find attachment by checksum:", err)
+	}
+
+	// Identical content remains indexed while either url is cached
+	c.mu.Lock()
+	c.removeAttachment(srv.URL + "/a.png")
+	c.mu.Unlock()
+	if _, err := c.AttachmentByChecksum(sum); err != nil {
+		t.Error("lost checksum of remaining attachment:", err)
+	}
+
+	c.InvalidateAllAttachments()
+	if _, err := c.AttachmentByChecksum(sum); err != ErrMissing {
+		t.Error("Expected ErrMissing after invalidation, got:", err)
+	}
+}
+
+func TestAttachmentCorruption(t *testing.T) {
+	content := strings.Repeat("original content ", 8)
+	var downloads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.txt", Filename: "a.txt"}
+	c := NewCache(MockProvider{}, WithAttachmentDir(t.TempDir()))
+	a, err := c.Attachment(at)
+	if err != nil {
+		t.Fatal("Unexpected error from attachment retrieval:", err)
+	}
+	path := a.Path
+
+	// Corrupt content on disk is downloaded again rather than returned
+	for i, corrupt := range []string{"corrupted", content[:len(content)/2]} {
+		os.WriteFile(path, []byte(corrupt), 0o644)
+		if a, err := c.Attachment(at); err != nil || string(a.Content) != content {
+			t.Errorf("corrupt attachment returned\nexpect: %q\ngot: %q (%v)", content, a.Content, err)
+		}
+		if n := atomic.LoadInt32(&downloads); n != int32(i+2) {
+			t.Errorf("corrupt attachment not downloaded again\nexpect downloads: %d\ngot: %d", i+2, n)
+		}
+	}
+	if n := c.Stats().Attachment.Corrupt; n != 2 {
+		t.Errorf("wrong corruption count\nexpect: 2\ngot: %d", n)
+	}
+
+	// Streams fail once read to the end, discarding the attachment
+	os.WriteFile(path, []byte("corrupted"), 0o644)
+	rc, _, err := c.AttachmentStream(at)
+	if err != nil {
+		t.Fatal("Unexpected error from attachment stream:", err)
+	}
+	if _, err := io.ReadAll(rc); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("wrong error from corrupt stream\nexpect: %v\ngot: %v", ErrCorrupt, err)
+	}
+	rc.Close()
+	if c.HasAttachment(at.URL) {
+		t.Error("corrupt attachment was not discarded after streaming")
+	}
+
+	// So are cached attachments served by the handler
+	c.Attachment(at)
+	os.WriteFile(path, []byte("corrupted"), 0o644)
+	w := httptest.NewRecorder()
+	NewAttachmentHandler(c, strings.TrimPrefix(srv.URL, "http://")).ServeHTTP(w, httptest.NewRequest("GET", "/?url="+at.URL, nil))
+	if w.Body.String() != content {
+		t.Errorf("corrupt attachment served\nexpect: %q\ngot: %q", content, w.Body.String())
+	}
+	if n := c.Stats().Attachment.Corrupt; n != 4 {
+		t.Errorf("wrong corruption count\nexpect: 4\ngot: %d", n)
+	}
+
+	// Compressed content held in memory is verified as it is decompressed
+	c = NewCache(MockProvider{}, WithCompression(1))
+	c.Attachment(at)
+	other, _ := compress(bytes.Repeat([]byte("x"), 100))
+	c.mu.Lock()
+	cached := c.attachmentCache[c.keyOf(at)]
+	if !cached.compressed {
+		t.Fatal("attachment content was not compressed")
+	}
+	cached.Content = other
+	c.mu.Unlock()
+	if a, err := c.Attachment(at); err != nil || string(a.Content) != content {
+		t.Errorf("corrupt compressed attachment returned\nexpect: %q\ngot: %q (%v)", content, a.Content, err)
+	}
+	if n := c.Stats().Attachment.Corrupt; n != 1 {
+		t.Errorf("wrong corruption count\nexpect: 1\ngot: %d", n)
+	}
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// An ErrorClass is the kind of failure an error from a provider represents,
+// used to decide whether and when to retry.
+type ErrorClass int
+
+// Provider error classes.
+const (
+	// ErrorOther is any error not in another class, including a nil error.
+	ErrorOther ErrorClass = iota
+	// ErrorNotFound is an object which genuinely does not exist.
+	ErrorNotFound
+	// ErrorRateLimited is a request rejected by a rate limit, which may be
+	// retried once the limit resets.
+	ErrorRateLimited
+	// ErrorTransient is a failure of the network or of Discord itself, which
+	// may be retried at once or with backoff.
+	ErrorTransient
+	// ErrorUnauthorized is a request rejected for lack of access, which fails
+	// again until the credentials or permissions of the session change.
+	ErrorUnauthorized
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorOther:
+		return "other"
+	case ErrorNotFound:
+		return "not found"
+	case ErrorRateLimited:
+		return "rate limited"
+	case ErrorTransient:
+		return "transient"
+	case ErrorUnauthorized:
+		return "unauthorized"
+	default:
+		return "unknown"
+	}
+}
+
+// notFoundCodes are the Discord JSON error codes which denote that the object
+// looked up does not exist.
+var notFoundCodes = map[int]bool{
+	discordgo.ErrCodeUnknownAccount: true,
+	discordgo.ErrCodeUnknownChannel: true,
+	discordgo.ErrCodeUnknownGuild:   true,
+	discordgo.ErrCodeUnknownMember:  true,
+	discordgo.ErrCodeUnknownMessage: true,
+	discordgo.ErrCodeUnknownRole:    true,
+	discordgo.ErrCodeUnknownUser:    true,
+	discordgo.ErrCodeUnknownEmoji:   true,
+}
+
+// unauthorizedCodes are the Discord JSON error codes which denote that the
+// session may not access the object looked up.
+var unauthorizedCodes = map[int]bool{
+	discordgo.ErrCodeUnauthorized:       true,
+	discordgo.ErrCodeMissingAccess:      true,
+	discordgo.ErrCodeMissingPermissions: true,
+}
+
+// ClassifyError returns the class of err, an error returned by a provider or by
+// a lookup through the cache. Discord API errors are classified by their JSON
+// error code, falling back to their HTTP status, and rate limits reported by
+// discordgo are classified as ErrorRateLimited. Failed attachment downloads
+// (see ErrGetFailed) are classified by their HTTP status. Network errors and
+// deadlines are classified as ErrorTransient, but cancellation of the lookup is
+// not. A ProviderError is classified as ErrorNotFound only if every provider
+// reported that the object does not exist. The cache itself uses the same
+// classification, such that only ErrorNotFound errors are wrapped as
+// ErrNotFound and negatively cached.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorOther
+	}
+
+	var perr ProviderError
+	if errors.As(err, &perr) {
+		return perr.class()
+	}
+
+	var rerr *discordgo.RESTError
+	if errors.As(err, &rerr) {
+		return classifyREST(rerr)
+	}
+
+	var serr statusError
+	if errors.As(err, &serr) {
+		return classifyStatus(int(serr))
+	}
+
+	var rlerr *discordgo.RateLimitError
+	if errors.As(err, &rlerr) {
+		return ErrorRateLimited
+	}
+	var rlval discordgo.RateLimitError
+	if errors.As(err, &rlval) {
+		return ErrorRateLimited
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTransient
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorOther
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return ErrorTransient
+	}
+
+	return ErrorOther
+}
+
+// classifyREST returns the class of the Discord API error err.
+func classifyREST(err *discordgo.RESTError) ErrorClass {
+	if err.Message != nil {
+		switch code := err.Message.Code; {
+		case notFoundCodes[code]:
+			return ErrorNotFound
+		case unauthorizedCodes[code]:
+			return ErrorUnauthorized
+		}
+	}
+	if err.Response == nil {
+		return ErrorOther
+	}
+
+	return classifyStatus(err.Response.StatusCode)
+}
+
+// classifyStatus returns the class of a request which failed with the HTTP
+// status status.
+func classifyStatus(status int) ErrorClass {
+	switch {
+	case status == http.StatusNotFound:
+		return ErrorNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrorRateLimited
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrorUnauthorized
+	case status >= 500:
+		return ErrorTransient
+	default:
+		return ErrorOther
+	}
+}
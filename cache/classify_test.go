@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestClassifyError(t *testing.T) {
+	status := func(code int) error {
+		return &discordgo.RESTError{Response: &http.Response{StatusCode: code}}
+	}
+	cases := []struct {
+		Name   string
+		Err    error
+		Expect ErrorClass
+	}{
+		{"Nil", nil, ErrorOther},
+		{"UnknownChannel", notFoundError(discordgo.ErrCodeUnknownChannel), ErrorNotFound},
+		{"StatusNotFound", status(http.StatusNotFound), ErrorNotFound},
+		{"MissingAccess", &discordgo.RESTError{
+			Response: &http.Response{StatusCode: http.StatusForbidden},
+			Message:  &discordgo.APIErrorMessage{Code: discordgo.ErrCodeMissingAccess},
+		}, ErrorUnauthorized},
+		{"StatusUnauthorized", status(http.StatusUnauthorized), ErrorUnauthorized},
+		{"StatusTooManyRequests", status(http.StatusTooManyRequests), ErrorRateLimited},
+		{"RateLimit", &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{}}, ErrorRateLimited},
+		{"StatusBadGateway", status(http.StatusBadGateway), ErrorTransient},
+		{"StatusBadRequest", status(http.StatusBadRequest), ErrorOther},
+		{"Network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorTransient},
+		{"Deadline", context.DeadlineExceeded, ErrorTransient},
+		{"Canceled", context.Canceled, ErrorOther},
+		{"Wrapped", fmt.Errorf("lookup: %w", status(http.StatusNotFound)), ErrorNotFound},
+		{"Cache", wrapError{ErrNotFound, status(http.StatusNotFound)}, ErrorNotFound},
+		{"DownloadNotFound", wrapError{ErrGetFailed, statusError(http.StatusNotFound)}, ErrorNotFound},
+		{"DownloadFailed", wrapError{ErrGetFailed, statusError(http.StatusBadGateway)}, ErrorTransient},
+		{"Unknown", errors.New("something else"), ErrorOther},
+	}
+
+	for _, tc := range cases {
+		if got := ClassifyError(tc.Err); got != tc.Expect {
+			t.Errorf("%s: wrong error class\nexpect: %v\ngot: %v", tc.Name, tc.Expect, got)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package cache
+
+import "time"
+
+// A Clock tells the cache the current time (see WithClock), from which the age
+// of every entry and attachment is measured.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the Clock of the system.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// now returns the current time of the clock of c.
+func (c *Cache) now() time.Time {
+	return c.clock.Now()
+}
+
+// since returns the time elapsed since t on the clock of c.
+func (c *Cache) since(t time.Time) time.Duration {
+	return c.now().Sub(t)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeClock is a Clock which only moves when advanced.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock() *FakeClock {
+	return &FakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestClock(t *testing.T) {
+	clk := NewFakeClock()
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p, WithClock(clk), WithTTL(TypeChannel, time.Minute),
+		WithAttachmentLifetime(time.Hour))
+
+	c.Channel("1234")
+	c.AddAttachment("a", "", "", []byte("a"))
+
+	// Entries expire exactly once their TTL has passed
+	clk.Advance(time.Minute)
+	if !c.HasChannel("1234") {
+		t.Error("channel expired before its TTL")
+	}
+	clk.Advance(time.Nanosecond)
+	if c.HasChannel("1234") {
+		t.Error("channel outlived its TTL")
+	}
+	c.Channel("1234")
+	if p.calls != 2 {
+		t.Errorf("wrong number of provider calls\nexpect: 2\ngot: %d", p.calls)
+	}
+
+	// References and Clean use the clock too
+	clk.Advance(30 * time.Minute)
+	c.cachedAttachment("a")
+	clk.Advance(time.Hour)
+	if plan := c.CleanPlan(); len(plan) != 0 {
+		t.Errorf("attachment referenced within its lifetime planned for eviction: %v", plan)
+	}
+	clk.Advance(time.Nanosecond)
+	c.Clean()
+	if c.HasAttachment("a") {
+		t.Error("attachment outlived its lifetime")
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"os"
+	"time"
+)
+
+// Clone returns a new cache with the same provider and options as c, holding
+// a copy of every entry of c, such that later changes to either cache do not
+// affect the other. This allows, for example, a consistent point-in-time view
+// of the cache to be served or compared against while c is being invalidated.
+// Entries keep their insertion time and TTL, so expire in the clone when they
+// would have in c.
+//
+// The clone always holds its entries in memory, even if c uses a Store (see
+// WithStore) or an attachment directory (see WithAttachmentDir). Cached objects
+// are shared between the two caches rather than copied, which is safe as
+// cached objects are never modified, and attachment content held in memory is
+// likewise shared by reference. The content of attachments backed by disk is
+// read into memory, skipping any whose backing file cannot be read, so that
+// evictions from the clone never delete the files of c. The statistics of the
+// clone start from zero, and a janitor running for c is not started for the
+// clone.
+func (c *Cache) Clone() *Cache {
+	opts := make([]Option, 0, len(c.opts)+2)
+	opts = append(opts, c.opts...)
+	opts = append(opts, WithStore(nil), WithAttachmentDir(""))
+	d := NewCache(c.provider, opts...)
+
+	c.channels.copyTo(d.channels)
+	c.users.copyTo(d.users)
+	c.guilds.copyTo(d.guilds)
+	c.members.copyTo(d.members)
+	c.roles.copyTo(d.roles)
+	c.emojis.copyTo(d.emojis)
+	c.stickers.copyTo(d.stickers)
+	c.messages.copyTo(d.messages)
+	c.histories.copyTo(d.histories)
+	c.missing.walk(func(key string, t *time.Time) bool {
+		when := *t
+		d.missing.set(key, &when)
+		return true
+	})
+
+	c.mu.Lock()
+	atts := make(map[string]Attachment, len(c.attachmentCache))
+	for key, a := range c.attachmentCache {
+		atts[key] = *a
+	}
+	c.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, a := range atts {
+		a := a
+		if a.Path != "" {
+			buf, err := os.ReadFile(a.Path)
+			if err != nil {
+				continue
+			}
+			a.Content, a.Path, a.size = buf, "", 0
+		}
+		d.insertAttachment(key, &a)
+	}
+
+	return d
+}
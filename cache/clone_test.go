@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestClone(t *testing.T) {
+	dir := t.TempDir()
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p, WithAttachmentDir(dir))
+	c.Channel("1234")
+	c.Role("9101112", "1")
+	c.AddAttachment("http://invalid.invalid/a.png", "a.png", "image/png", []byte("content"))
+
+	d := c.Clone()
+	c.InvalidateChannel("1234")
+	c.SeedUsers([]*discordgo.User{{ID: "1"}})
+
+	if ch, err := d.Channel("1234"); err != nil || ch.Name != "Testing Channel" {
+		t.Error("clone lost channel invalidated in original:", err)
+	}
+	if _, err := d.Role("9101112", "2"); err != nil {
+		t.Error("failed to retrieve role from clone:", err)
+	}
+	if d.HasUser("1") {
+		t.Error("clone gained user seeded into original")
+	}
+	if p.calls != 2 {
+		t.Errorf("clone lookups caused provider calls\nexpect: 2\ngot: %d", p.calls)
+	}
+
+	// Disk-backed attachments are read into memory
+	d.InvalidateAllAttachments()
+	a, ok := c.cachedAttachment("http://invalid.invalid/a.png")
+	if !ok || a.Path == "" {
+		t.Fatal("attachment was not cached on disk")
+	}
+	if _, err := os.Stat(a.Path); err != nil {
+		t.Error("evicting attachment from clone deleted file of original")
+	}
+}
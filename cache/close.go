@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrClosed is returned by lookups on a Cache which has been closed.
+var ErrClosed = errors.New("cache: cache is closed")
+
+// Close releases the background resources of the cache: it stops the janitor
+// (see StartJanitor), closes the idle connections of the HTTP client used for
+// attachment downloads, and closes the Store of the cache (see WithStore) if
+// it implements io.Closer, returning any error from doing so. Attachments
+// written to disk (see WithAttachmentDir) are left in place, such that they
+// may be reused by the next cache.
+//
+// Once closed, lookups return ErrClosed, including lookups which would have
+// been hits, AttachmentInfo reports nothing as cached, an AttachmentHandler
+// answers with 503 Service Unavailable, and the janitor cannot be started
+// again. Invalidation and event handlers may still be called, but have no
+// lasting effect worth relying on. Closing a cache again returns ErrClosed.
+func (c *Cache) Close() error {
+	if c.closed.Swap(true) {
+		return ErrClosed
+	}
+
+	c.StopJanitor()
+	c.httpClient.CloseIdleConnections()
+	if cl, ok := c.store.(io.Closer); ok {
+		return cl.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ClosingStore is a MapStore which records being closed.
+type ClosingStore struct {
+	MapStore
+	closed int
+}
+
+func (s *ClosingStore) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	store := &ClosingStore{}
+	c := NewCache(MockProvider{}, WithStore(store))
+	c.Channel("1234")
+	c.AddAttachment("a", "a.png", "image/png", []byte("content"))
+	c.StartJanitor(time.Hour)
+
+	if err := c.Close(); err != nil {
+		t.Fatal("Unexpected error from close:", err)
+	}
+	if store.closed != 1 {
+		t.Errorf("wrong number of store closes\nexpect: 1\ngot: %d", store.closed)
+	}
+	if c.janitorStop != nil {
+		t.Error("janitor still running after close")
+	}
+	c.StartJanitor(time.Hour)
+	if c.janitorStop != nil {
+		t.Error("janitor started on closed cache")
+	}
+
+	// Lookups fail, hits included
+	if _, err := c.Channel("1234"); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error from channel lookup\nexpect: %v\ngot: %v", ErrClosed, err)
+	}
+	if _, err := c.Attachment(&discordgo.MessageAttachment{URL: "a"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error from attachment lookup\nexpect: %v\ngot: %v", ErrClosed, err)
+	}
+	if _, err := c.Role("9101112", "1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error from role lookup\nexpect: %v\ngot: %v", ErrClosed, err)
+	}
+	var buf bytes.Buffer
+	if _, err := c.WriteAttachmentTo(&buf, "a"); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error from attachment write\nexpect: %v\ngot: %v", ErrClosed, err)
+	}
+	if _, err := c.CopyAttachment(context.Background(), &buf, &discordgo.MessageAttachment{URL: "a"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error from attachment copy\nexpect: %v\ngot: %v", ErrClosed, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("attachment written after close: %q", buf.String())
+	}
+	if _, err := c.AttachmentByChecksum(sha256.Sum256([]byte("content"))); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error from checksum lookup\nexpect: %v\ngot: %v", ErrClosed, err)
+	}
+	if _, ok := c.AttachmentInfo("a"); ok {
+		t.Error("attachment info returned after close")
+	}
+	rec := httptest.NewRecorder()
+	NewAttachmentHandler(c).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape("a"), nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("wrong status from handler\nexpect: %d\ngot: %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	if err := c.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("wrong error from second close\nexpect: %v\ngot: %v", ErrClosed, err)
+	}
+	if store.closed != 1 {
+		t.Errorf("store closed again\nexpect: 1\ngot: %d", store.closed)
+	}
+}
@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// compress returns buf compressed with gzip, or false if compressing buf does
+// not make it any smaller.
+func compress(buf []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	zw := gzip.NewWriter(&out)
+	if _, err := zw.Write(buf); err != nil {
+		return nil, false
+	}
+	if err := zw.Close(); err != nil || out.Len() >= len(buf) {
+		return nil, false
+	}
+
+	return out.Bytes(), true
+}
+
+// decompress returns buf, compressed by compress, decompressed.
+func decompress(buf []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCompression(t *testing.T) {
+	text := bytes.Repeat([]byte("a line of a log file\n"), 1000)
+	random := make([]byte, len(text))
+	rand.Read(random)
+	small := []byte("too small")
+
+	c := NewCache(MockProvider{}, WithCompression(100))
+	cases := []struct {
+		Name       string
+		Content    []byte
+		Compressed bool
+	}{
+		{"Text", text, true},
+		{"Random", random, false},
+		{"Small", small, false},
+	}
+	for _, tc := range cases {
+		c.AddAttachment(tc.Name, tc.Name, "", tc.Content)
+
+		c.mu.Lock()
+		cached := c.attachmentCache[tc.Name]
+		if cached.compressed != tc.Compressed {
+			t.Errorf("%s: wrong compression state\nexpect: %t\ngot: %t", tc.Name, tc.Compressed, cached.compressed)
+		}
+		if tc.Compressed && len(cached.Content) >= len(tc.Content) {
+			t.Errorf("%s: content was not shrunk by compression", tc.Name)
+		}
+		c.mu.Unlock()
+
+		// Every read returns the original content
+		at := &discordgo.MessageAttachment{URL: tc.Name}
+		if a, err := c.Attachment(at); err != nil || !bytes.Equal(a.Content, tc.Content) || a.compressed {
+			t.Errorf("%s: wrong content from lookup: %v", tc.Name, err)
+		}
+		if a, err := c.AttachmentByChecksum(sha256.Sum256(tc.Content)); err != nil || !bytes.Equal(a.Content, tc.Content) {
+			t.Errorf("%s: wrong content from checksum lookup: %v", tc.Name, err)
+		}
+		rc, _, err := c.AttachmentStream(at)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error from attachment stream: %v", tc.Name, err)
+		}
+		if buf, _ := io.ReadAll(rc); !bytes.Equal(buf, tc.Content) {
+			t.Errorf("%s: wrong content from stream", tc.Name)
+		}
+		rc.Close()
+	}
+
+	if u := c.MemoryUsage(); u.Attachments >= int64(len(text)+len(random)) {
+		t.Errorf("compression did not reduce memory usage: %d bytes", u.Attachments)
+	}
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DiffChannel fetches the channel ID from the provider and compares it with
+// the cached channel, such as to find whether and how the cache has gone
+// stale, returning whether they differ and the names of the fields which
+// differ. Fields of nested structs are named by their path, such as
+// "Recipients" or "ThreadMetadata.Archived"; slices and maps are compared as a
+// whole. Unexported fields, and fields which are never sent by the API (those
+// omitted from JSON), are skipped. The cached channel is compared even if it
+// has outlived its TTL, and is left in place (but see RefreshChannelDiff). If
+// the channel is not cached, ErrMissing is returned without calling the
+// provider, and errors from the provider are wrapped as by Channel.
+func (c *Cache) DiffChannel(ID string) (changed bool, fields []string, err error) {
+	return diffObject(c.channels, ID, false, func(ctx context.Context) (*discordgo.Channel, error) {
+		return fetchChannel(ctx, c.provider, ID)
+	})
+}
+
+// RefreshChannelDiff is like DiffChannel, but replaces the cached channel with
+// the fresh channel, as by RefreshChannel.
+func (c *Cache) RefreshChannelDiff(ID string) (changed bool, fields []string, err error) {
+	return diffObject(c.channels, ID, true, func(ctx context.Context) (*discordgo.Channel, error) {
+		return fetchChannel(ctx, c.provider, ID)
+	})
+}
+
+// DiffUser is like DiffChannel, but for users.
+func (c *Cache) DiffUser(ID string) (changed bool, fields []string, err error) {
+	return diffObject(c.users, ID, false, func(ctx context.Context) (*discordgo.User, error) {
+		return fetchUser(ctx, c.provider, ID)
+	})
+}
+
+// RefreshUserDiff is like RefreshChannelDiff, but for users.
+func (c *Cache) RefreshUserDiff(ID string) (changed bool, fields []string, err error) {
+	return diffObject(c.users, ID, true, func(ctx context.Context) (*discordgo.User, error) {
+		return fetchUser(ctx, c.provider, ID)
+	})
+}
+
+// DiffGuild is like DiffChannel, but for guilds. Guilds fetched from the API
+// carry none of the channels, members and other state sent over the gateway,
+// so those fields differ from a guild seeded from the gateway.
+func (c *Cache) DiffGuild(ID string) (changed bool, fields []string, err error) {
+	return diffObject(c.guilds, ID, false, func(ctx context.Context) (*discordgo.Guild, error) {
+		return fetchGuild(ctx, c.provider, ID)
+	})
+}
+
+// RefreshGuildDiff is like RefreshChannelDiff, but for guilds.
+func (c *Cache) RefreshGuildDiff(ID string) (changed bool, fields []string, err error) {
+	return diffObject(c.guilds, ID, true, func(ctx context.Context) (*discordgo.Guild, error) {
+		return fetchGuild(ctx, c.provider, ID)
+	})
+}
+
+// diffObject compares the object cached under key in o with the object
+// fetched by load, replacing the cached object with it if replace is set.
+func diffObject[T any](o *objectCache[T], key string, replace bool, load func(ctx context.Context) (*T, error)) (bool, []string, error) {
+	e, ok := o.peek(key)
+	if !ok {
+		return false, nil, ErrMissing
+	}
+	cached := e.val
+
+	var (
+		fresh *T
+		err   error
+	)
+	if replace {
+		fresh, err = o.refresh(context.Background(), key, load)
+	} else if fresh, err = load(context.Background()); isNotFound(err) {
+		err = wrapError{ErrNotFound, err}
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	fields := diffFields(reflect.ValueOf(cached).Elem(), reflect.ValueOf(fresh).Elem(), "", nil)
+	return len(fields) > 0, fields, nil
+}
+
+// timeType is the type of time.Time, which has no exported fields, so is
+// compared with its Equal method.
+var timeType = reflect.TypeOf(time.Time{})
+
+// diffFields appends to fields the names of the fields of the structs a and b
+// which differ, each prefixed by prefix, and returns fields.
+func diffFields(a, b reflect.Value, prefix string, fields []string) []string {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("json") == "-" {
+			continue
+		}
+
+		name := prefix + f.Name
+		if !equalField(a.Field(i), b.Field(i), name, &fields) {
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+// equalField returns whether the values a and b of the field name are equal.
+// Differing structs, and pointers to structs, are instead descended into,
+// appending the names of their differing fields to fields and returning true.
+func equalField(a, b reflect.Value, name string, fields *[]string) bool {
+	switch {
+	case a.Type() == timeType:
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	case a.Kind() == reflect.Pointer && a.Type().Elem().Kind() == reflect.Struct:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equalField(a.Elem(), b.Elem(), name, fields)
+	case a.Kind() == reflect.Struct:
+		*fields = diffFields(a, b, name+".", *fields)
+		return true
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ChannelProvider is a provider which serves its current channel, such that
+// tests can change it behind the cache.
+type ChannelProvider struct {
+	MockProvider
+	mu sync.Mutex
+	ch discordgo.Channel
+}
+
+func (p *ChannelProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if channelID != p.ch.ID {
+		return nil, notFoundError(discordgo.ErrCodeUnknownChannel)
+	}
+	ch := p.ch
+	return &ch, nil
+}
+
+func TestDiff(t *testing.T) {
+	archived := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &ChannelProvider{ch: discordgo.Channel{
+		ID:             "1234",
+		Name:           "general",
+		Topic:          "chat",
+		ThreadMetadata: &discordgo.ThreadMetadata{ArchiveTimestamp: archived},
+	}}
+	c := NewCache(p)
+
+	if _, _, err := c.DiffChannel("1234"); err != ErrMissing {
+		t.Errorf("wrong error diffing uncached channel\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+	c.Channel("1234")
+	if changed, fields, err := c.DiffChannel("1234"); err != nil || changed || len(fields) != 0 {
+		t.Errorf("unchanged channel reported as changed: %v (%v)", fields, err)
+	}
+
+	// Changes are reported by field, without replacing the cached channel
+	p.mu.Lock()
+	p.ch.Name = "renamed"
+	p.ch.PermissionOverwrites = []*discordgo.PermissionOverwrite{{ID: "1"}}
+	p.ch.ThreadMetadata = &discordgo.ThreadMetadata{Archived: true, ArchiveTimestamp: archived.In(time.Local)}
+	p.ch.Messages = []*discordgo.Message{{ID: "1"}}
+	p.mu.Unlock()
+	expect := []string{"Name", "PermissionOverwrites", "ThreadMetadata.Archived"}
+	changed, fields, err := c.DiffChannel("1234")
+	if err != nil || !changed || !reflect.DeepEqual(fields, expect) {
+		t.Errorf("wrong fields reported\nexpect: %v\ngot: %v (%v)", expect, fields, err)
+	}
+	if ch, _ := c.Channel("1234"); ch.Name != "general" {
+		t.Error("diff replaced the cached channel")
+	}
+
+	// Unless asked to
+	if changed, fields, err := c.RefreshChannelDiff("1234"); err != nil || !changed || !reflect.DeepEqual(fields, expect) {
+		t.Errorf("wrong fields reported by refresh\nexpect: %v\ngot: %v (%v)", expect, fields, err)
+	}
+	if ch, _ := c.Channel("1234"); ch.Name != "renamed" {
+		t.Error("refreshing diff did not replace the cached channel")
+	}
+
+	// Deleted channels are reported as not found
+	p.mu.Lock()
+	p.ch.ID = "5678"
+	p.mu.Unlock()
+	if _, _, err := c.DiffChannel("1234"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error diffing deleted channel\nexpect: %v\ngot: %v", ErrNotFound, err)
+	}
+	if _, ok := c.channels.peek("1234"); !ok {
+		t.Error("failed diff removed the cached channel")
+	}
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// attachmentPath returns the path of the backing file of the attachment at
+// url within the attachment directory. Files are named by the hex SHA-256 of
+// the url, such that any url maps to a valid and unique file name.
+func (c *Cache) attachmentPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.attachmentDir, hex.EncodeToString(sum[:]))
+}
+
+// isAttachmentFile returns true if name could be the name of a backing file
+// written by attachmentPath.
+func isAttachmentFile(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// writeAttachment writes content to the backing file of the attachment at url,
+// returning its path. The content is written to a temporary file first and
+// then renamed into place, such that readers never see a partial file.
+func (c *Cache) writeAttachment(url string, content []byte) (string, error) {
+	if err := os.MkdirAll(c.attachmentDir, 0o755); err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp(c.attachmentDir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	path := c.attachmentPath(url)
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return path, nil
+}
+
+// loadAttachment reads the content of a into a.Content from its backing file,
+// if it has one and the content is not already loaded, or decompresses it if
+// it is compressed. Content which is read or decompressed is verified against
+// the checksum of a, returning ErrCorrupt if it does not match.
+func loadAttachment(a *Attachment) error {
+	if a.compressed {
+		buf, err := decompress(a.Content)
+		if err != nil {
+			return err
+		}
+		if !matchesChecksum(buf, a.Checksum) {
+			return ErrCorrupt
+		}
+		a.Content, a.compressed = buf, false
+		return nil
+	}
+	if a.Path == "" || a.Content != nil {
+		return nil
+	}
+
+	buf, err := os.ReadFile(a.Path)
+	if err != nil {
+		return err
+	}
+	if !matchesChecksum(buf, a.Checksum) {
+		return ErrCorrupt
+	}
+	a.Content = buf
+	return nil
+}
+
+// openCached returns a stream of the content of a, the cached attachment under
+// key, reading from its backing file if it has one and decompressing it if it
+// is compressed. Content which is read or decompressed is verified against the
+// checksum of a as it is read, and if it does not match, the stream fails with
+// ErrCorrupt once read to the end and the attachment is discarded.
+func (c *Cache) openCached(key string, a Attachment) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	switch {
+	case a.compressed:
+		zr, err := gzip.NewReader(bytes.NewReader(a.Content))
+		if err != nil {
+			return nil, err
+		}
+		rc = zr
+	case a.Path == "" || a.Content != nil:
+		return io.NopCloser(bytes.NewReader(a.Content)), nil
+	default:
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
+	}
+	if a.Checksum == [sha256.Size]byte{} {
+		return rc, nil
+	}
+
+	return &checkedReader{
+		ReadCloser: rc,
+		hash:       sha256.New(),
+		sum:        a.Checksum,
+		corrupt:    func() { c.discardAttachment(key, ErrCorrupt) },
+	}, nil
+}
+
+// sweepAttachmentDir removes backing files in the attachment directory which
+// are not in tracked and have not been modified for the attachment lifetime,
+// such as those left behind by a previous process. Files not named like backing
+// files are left alone.
+func (c *Cache) sweepAttachmentDir(tracked map[string]bool) {
+	ents, err := os.ReadDir(c.attachmentDir)
+	if err != nil {
+		return
+	}
+
+	for _, ent := range ents {
+		path := filepath.Join(c.attachmentDir, ent.Name())
+		if !ent.Type().IsRegular() || !isAttachmentFile(ent.Name()) || tracked[path] {
+			continue
+		}
+		info, err := ent.Info()
+		if err != nil || c.since(info.ModTime()) <= c.attachmentLifetime {
+			continue
+		}
+
+		os.Remove(path)
+	}
+}
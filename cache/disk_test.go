@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAttachmentDir(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("on disk"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.png", Filename: "a.png"}
+	c := NewCache(MockProvider{}, WithAttachmentDir(dir))
+
+	a, err := c.Attachment(at)
+	if err != nil {
+		t.Fatal("Unexpected error from attachment retrieval:", err)
+	}
+	if string(a.Content) != "on disk" || filepath.Dir(a.Path) != dir {
+		t.Fatalf("wrong attachment returned\ncontent: %s\npath: %s", a.Content, a.Path)
+	}
+	if buf, err := os.ReadFile(a.Path); err != nil || string(buf) != "on disk" {
+		t.Error("attachment content was not written to disk")
+	}
+	c.mu.Lock()
+	if c.attachmentCache[at.URL].Content != nil {
+		t.Error("attachment content was held in memory")
+	}
+	if c.attachmentBytes != int64(len("on disk")) {
+		t.Errorf("wrong byte accounting\nexpect: %d\ngot: %d", len("on disk"), c.attachmentBytes)
+	}
+	c.mu.Unlock()
+
+	// Hits are lazily read back from disk
+	if a, err := c.Attachment(at); err != nil || string(a.Content) != "on disk" {
+		t.Error("failed to read cached attachment from disk:", err)
+	}
+	rc, _, err := c.AttachmentStream(at)
+	if err != nil {
+		t.Fatal("Unexpected error from attachment stream:", err)
+	}
+	if buf, _ := io.ReadAll(rc); string(buf) != "on disk" {
+		t.Error("failed to stream cached attachment from disk")
+	}
+	rc.Close()
+
+	// A new cache on the same directory reuses the file
+	c = NewCache(MockProvider{}, WithAttachmentDir(dir))
+	if a, err := c.Attachment(at); err != nil || string(a.Content) != "on disk" {
+		t.Error("failed to reuse attachment left on disk:", err)
+	}
+	if hits != 1 {
+		t.Errorf("wrong number of downloads\nexpect: 1\ngot: %d", hits)
+	}
+
+	// A lost file is downloaded again
+	os.Remove(a.Path)
+	if a, err := c.Attachment(at); err != nil || string(a.Content) != "on disk" {
+		t.Error("failed to download attachment after losing its file:", err)
+	}
+	if hits != 2 {
+		t.Errorf("wrong number of downloads\nexpect: 2\ngot: %d", hits)
+	}
+}
+
+func TestAttachmentDirClean(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(MockProvider{}, WithAttachmentDir(dir))
+
+	old := time.Now().Add(-2 * AttachmentLifetime)
+	evicted, _ := c.writeAttachment("evicted", []byte("evicted"))
+	c.mu.Lock()
+	c.insertAttachment("evicted", &Attachment{Path: evicted, LastReference: old})
+	c.mu.Unlock()
+
+	kept, _ := c.writeAttachment("kept", []byte("kept"))
+	c.mu.Lock()
+	c.insertAttachment("kept", &Attachment{Path: kept, LastReference: time.Now()})
+	c.mu.Unlock()
+	os.Chtimes(kept, old, old)
+
+	stale, _ := c.writeAttachment("stale", []byte("stale"))
+	os.Chtimes(stale, old, old)
+	fresh, _ := c.writeAttachment("fresh", []byte("fresh"))
+	other := filepath.Join(dir, "other.txt")
+	os.WriteFile(other, []byte("other"), 0o644)
+	os.Chtimes(other, old, old)
+
+	c.Clean()
+
+	cases := []struct {
+		Name   string
+		Path   string
+		Expect bool
+	}{
+		{"Evicted", evicted, false},
+		{"Tracked", kept, true},
+		{"Stale", stale, false},
+		{"Fresh", fresh, true},
+		{"Other", other, true},
+	}
+	for _, tc := range cases {
+		_, err := os.Stat(tc.Path)
+		if exists := err == nil; exists != tc.Expect {
+			t.Errorf("%s: wrong file state after clean\nexpect exists: %t\ngot: %t", tc.Name, tc.Expect, exists)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// emojiSet is the full set of emojis of a guild, keyed by emoji ID.
+type emojiSet map[string]*discordgo.Emoji
+
+// Emoji looks up and returns the emoji emojiID of guild guildID. The first
+// lookup of any emoji in a guild fetches and caches every emoji of that guild,
+// such that subsequent lookups of any emoji in the guild are served from the
+// cache until the guild's emojis are older than the emoji TTL (see WithTTL) or
+// are invalidated with InvalidateGuildEmojis. If the guild's emojis could not
+// be fetched, error is returned from the discord API. If the emojis were
+// fetched but contain no emoji emojiID, ErrMissing is returned. If the provider
+// cannot look up emojis (see EmojiProvider), ErrUnsupported is returned. The
+// emoji is returned exactly as provided, so Animated may be used to choose
+// between the static and animated CDN URLs.
+func (c *Cache) Emoji(guildID, emojiID string) (discordgo.Emoji, error) {
+	return c.EmojiContext(context.Background(), guildID, emojiID)
+}
+
+// EmojiContext is like Emoji, but stops waiting for the provider and returns
+// the context's error if ctx is done before the lookup completes.
+func (c *Cache) EmojiContext(ctx context.Context, guildID, emojiID string) (discordgo.Emoji, error) {
+	emojis, err := c.guildEmojis(ctx, guildID)
+	if err != nil {
+		return discordgo.Emoji{}, err
+	}
+
+	em, ok := emojis[emojiID]
+	if !ok {
+		return discordgo.Emoji{}, ErrMissing
+	}
+
+	return *em, nil
+}
+
+// guildEmojis returns the cached emoji set of guild guildID, fetching it from
+// the provider on a miss.
+func (c *Cache) guildEmojis(ctx context.Context, guildID string) (emojiSet, error) {
+	v, err := c.emojis.lookup(ctx, guildID, func(ctx context.Context) (*emojiSet, error) {
+		emojis, err := fetchEmojis(ctx, c.provider, guildID)
+		if err != nil {
+			return nil, err
+		}
+
+		set := make(emojiSet, len(emojis))
+		for _, em := range emojis {
+			set[em.ID] = em
+		}
+		return &set, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return *v, nil
+}
+
+// InvalidateGuildEmojis invalidates the cached emojis of guild guildID, such
+// that the next emoji lookup in the guild re-fetches all of them. This should
+// be called on every GuildEmojisUpdate event for the guild.
+func (c *Cache) InvalidateGuildEmojis(guildID string) error {
+	return c.emojis.invalidate(guildID)
+}
+
+// InvalidateAllEmojis invalidates the cached emojis of every guild.
+func (c *Cache) InvalidateAllEmojis() {
+	c.emojis.invalidateAll()
+}
@@ -0,0 +1,193 @@
+package cache
+
+import "github.com/bwmarrin/discordgo"
+
+// The Handle methods keep the cache coherent with gateway events, such that
+// cached objects are not served stale until their TTL expires. Creations and
+// updates replace the cached object with the one carried by the event,
+// avoiding a refetch, while deletions invalidate it and leave a tombstone (see
+// WithTombstoneTTL). Each may be called directly with an event, or
+// all of them registered on a session with RegisterHandlers.
+
+// HandleChannelCreate caches the created channel.
+func (c *Cache) HandleChannelCreate(e *discordgo.ChannelCreate) {
+	if e.Channel != nil {
+		c.channels.replace(e.ID, e.Channel)
+	}
+}
+
+// HandleChannelUpdate replaces the cached channel with the updated channel.
+func (c *Cache) HandleChannelUpdate(e *discordgo.ChannelUpdate) {
+	if e.Channel != nil {
+		c.channels.replace(e.ID, e.Channel)
+	}
+}
+
+// HandleChannelDelete invalidates the cached channel and its history.
+func (c *Cache) HandleChannelDelete(e *discordgo.ChannelDelete) {
+	if e.Channel != nil {
+		c.channels.tombstone(e.ID)
+		c.histories.invalidate(e.ID)
+	}
+}
+
+// HandleReady warms the cache with the objects carried by the READY payload
+// (see SeedFromReady). If the session has started afresh after disconnecting
+// (see HandleDisconnect), the object types set with WithReadyFlush are first
+// invalidated.
+func (c *Cache) HandleReady(e *discordgo.Ready) {
+	c.flushAfterReady()
+	c.SeedFromReady(e)
+}
+
+// HandleGuildCreate caches the created or newly available guild, along with the
+// objects it carries (see SeedGuild).
+func (c *Cache) HandleGuildCreate(e *discordgo.GuildCreate) {
+	c.SeedGuild(e.Guild)
+}
+
+// HandleGuildUpdate replaces the cached guild with the updated guild.
+func (c *Cache) HandleGuildUpdate(e *discordgo.GuildUpdate) {
+	if e.Guild != nil {
+		c.guilds.replace(e.ID, e.Guild)
+	}
+}
+
+// HandleGuildDelete invalidates the cached guild, along with its roles and
+// emojis. A guild which has only become unavailable, such as during an outage,
+// is not left a tombstone.
+func (c *Cache) HandleGuildDelete(e *discordgo.GuildDelete) {
+	if e.Guild != nil {
+		if e.Unavailable {
+			c.guilds.invalidate(e.ID)
+		} else {
+			c.guilds.tombstone(e.ID)
+		}
+		c.roles.invalidate(e.ID)
+		c.emojis.invalidate(e.ID)
+	}
+}
+
+// HandleUserUpdate replaces the cached user with the updated user.
+func (c *Cache) HandleUserUpdate(e *discordgo.UserUpdate) {
+	if e.User != nil {
+		c.users.replace(e.ID, e.User)
+	}
+}
+
+// HandleGuildMemberAdd caches the member which joined.
+func (c *Cache) HandleGuildMemberAdd(e *discordgo.GuildMemberAdd) {
+	if e.Member != nil && e.User != nil {
+		c.members.replace(memberKey(e.GuildID, e.User.ID), e.Member)
+	}
+}
+
+// HandleGuildMemberUpdate replaces the cached member with the updated member.
+func (c *Cache) HandleGuildMemberUpdate(e *discordgo.GuildMemberUpdate) {
+	if e.Member != nil && e.User != nil {
+		c.members.replace(memberKey(e.GuildID, e.User.ID), e.Member)
+	}
+}
+
+// HandleGuildMemberRemove invalidates the cached member.
+func (c *Cache) HandleGuildMemberRemove(e *discordgo.GuildMemberRemove) {
+	if e.Member != nil && e.User != nil {
+		c.members.tombstone(memberKey(e.GuildID, e.User.ID))
+	}
+}
+
+// HandleGuildRoleCreate invalidates the cached roles of the guild.
+func (c *Cache) HandleGuildRoleCreate(e *discordgo.GuildRoleCreate) {
+	if e.GuildRole != nil {
+		c.roles.invalidate(e.GuildID)
+	}
+}
+
+// HandleGuildRoleUpdate invalidates the cached roles of the guild.
+func (c *Cache) HandleGuildRoleUpdate(e *discordgo.GuildRoleUpdate) {
+	if e.GuildRole != nil {
+		c.roles.invalidate(e.GuildID)
+	}
+}
+
+// HandleGuildRoleDelete invalidates the cached roles of the guild.
+func (c *Cache) HandleGuildRoleDelete(e *discordgo.GuildRoleDelete) {
+	c.roles.invalidate(e.GuildID)
+}
+
+// HandleGuildEmojisUpdate replaces the cached emojis of the guild with the
+// full set of emojis carried by the event.
+func (c *Cache) HandleGuildEmojisUpdate(e *discordgo.GuildEmojisUpdate) {
+	set := make(emojiSet, len(e.Emojis))
+	for _, em := range e.Emojis {
+		set[em.ID] = em
+	}
+	c.emojis.replace(e.GuildID, &set)
+}
+
+// HandleMessageCreate adds the new message to the cached history of its
+// channel, if any (see RecentMessages).
+func (c *Cache) HandleMessageCreate(e *discordgo.MessageCreate) {
+	if e.Message != nil {
+		c.historyCreate(e.Message)
+	}
+}
+
+// HandleMessageUpdate replaces the cached message with the edited message.
+// Updates which only carry part of a message, such as those adding embeds to
+// it, carry no author, so the cached message is invalidated instead, as is the
+// cached history of its channel if it holds the message.
+func (c *Cache) HandleMessageUpdate(e *discordgo.MessageUpdate) {
+	if e.Message == nil {
+		return
+	}
+
+	if e.Author != nil {
+		c.messages.replace(messageKey(e.ChannelID, e.ID), e.Message)
+	} else {
+		c.messages.invalidate(messageKey(e.ChannelID, e.ID))
+	}
+	c.historyUpdate(e.Message)
+}
+
+// HandleMessageDelete invalidates the cached message, and removes it from the
+// cached history of its channel.
+func (c *Cache) HandleMessageDelete(e *discordgo.MessageDelete) {
+	if e.Message != nil {
+		c.messages.tombstone(messageKey(e.ChannelID, e.ID))
+		c.historyDelete(e.ChannelID, e.ID)
+	}
+}
+
+// RegisterHandlers registers every Handle method of the cache as a handler on
+// s, returning a function which removes them all again.
+func (c *Cache) RegisterHandlers(s *discordgo.Session) (remove func()) {
+	removers := []func(){
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.ChannelCreate) { c.HandleChannelCreate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.ChannelUpdate) { c.HandleChannelUpdate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.ChannelDelete) { c.HandleChannelDelete(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.Disconnect) { c.HandleDisconnect(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.Resumed) { c.HandleResumed(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.Ready) { c.HandleReady(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildCreate) { c.HandleGuildCreate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildUpdate) { c.HandleGuildUpdate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildDelete) { c.HandleGuildDelete(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.UserUpdate) { c.HandleUserUpdate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildMemberAdd) { c.HandleGuildMemberAdd(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildMemberUpdate) { c.HandleGuildMemberUpdate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildMemberRemove) { c.HandleGuildMemberRemove(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildRoleCreate) { c.HandleGuildRoleCreate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildRoleUpdate) { c.HandleGuildRoleUpdate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildRoleDelete) { c.HandleGuildRoleDelete(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildEmojisUpdate) { c.HandleGuildEmojisUpdate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageCreate) { c.HandleMessageCreate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageUpdate) { c.HandleMessageUpdate(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.MessageDelete) { c.HandleMessageDelete(e) }),
+	}
+
+	return func() {
+		for _, r := range removers {
+			r()
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestEvents(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p)
+	c.Channel("1234")
+	c.Role("9101112", "1")
+	c.Emoji("9101112", "1")
+
+	// Updates replace the cached object without a refetch
+	c.HandleChannelUpdate(&discordgo.ChannelUpdate{Channel: &discordgo.Channel{ID: "1234", Name: "Renamed"}})
+	if ch, err := c.Channel("1234"); err != nil || ch.Name != "Renamed" {
+		t.Error("channel was not replaced by update:", ch.Name, err)
+	}
+	c.HandleUserUpdate(&discordgo.UserUpdate{User: &discordgo.User{ID: "5678", Username: "Renamed"}})
+	if u, err := c.User("5678"); err != nil || u.Username != "Renamed" {
+		t.Error("user was not inserted by update:", u.Username, err)
+	}
+	c.HandleGuildEmojisUpdate(&discordgo.GuildEmojisUpdate{
+		GuildID: "9101112",
+		Emojis:  []*discordgo.Emoji{{ID: "3", Name: "new"}},
+	})
+	if _, err := c.Emoji("9101112", "1"); err != ErrMissing {
+		t.Errorf("removed emoji still cached\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+	if em, err := c.Emoji("9101112", "3"); err != nil || em.Name != "new" {
+		t.Error("emojis were not replaced by update:", err)
+	}
+	if p.calls != 3 {
+		t.Errorf("updates caused provider calls\nexpect: 3\ngot: %d", p.calls)
+	}
+
+	// Deletions invalidate
+	c.HandleChannelDelete(&discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "1234"}})
+	if c.HasChannel("1234") {
+		t.Error("channel was not invalidated by delete")
+	}
+	c.HandleGuildRoleDelete(&discordgo.GuildRoleDelete{GuildID: "9101112", RoleID: "1"})
+	if _, ok := c.roles.get("9101112"); ok {
+		t.Error("roles were not invalidated by role delete")
+	}
+
+	// Deleting objects which are not cached is harmless
+	c.HandleGuildDelete(&discordgo.GuildDelete{Guild: &discordgo.Guild{ID: "missing"}})
+	c.HandleGuildMemberRemove(&discordgo.GuildMemberRemove{Member: &discordgo.Member{GuildID: "missing"}})
+}
+
+func TestRegisterHandlers(t *testing.T) {
+	s, _ := discordgo.New("")
+	c := NewCache(MockProvider{})
+	remove := c.RegisterHandlers(s)
+	remove()
+}
+
+func TestTombstone(t *testing.T) {
+	clk := NewFakeClock()
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p, WithClock(clk), WithTombstoneTTL(time.Minute))
+	c.Channel("1234")
+
+	// Lookups of a deleted channel are not sent to the provider
+	c.HandleChannelDelete(&discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "1234"}})
+	for i := 0; i < 3; i++ {
+		if _, err := c.Channel("1234"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("wrong error for deleted channel\nexpect: %v\ngot: %v", ErrNotFound, err)
+		}
+	}
+	if p.calls != 1 {
+		t.Errorf("lookups of deleted channel called provider\nexpect: 1\ngot: %d", p.calls)
+	}
+
+	// The tombstone expires after its window
+	clk.Advance(time.Minute + time.Nanosecond)
+	if _, err := c.Channel("1234"); err != nil {
+		t.Error("tombstone outlived its window:", err)
+	}
+
+	// Seeing the object again clears the tombstone
+	c.HandleChannelDelete(&discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "1234"}})
+	c.HandleChannelCreate(&discordgo.ChannelCreate{Channel: &discordgo.Channel{ID: "1234", Name: "Recreated"}})
+	if ch, err := c.Channel("1234"); err != nil || ch.Name != "Recreated" {
+		t.Error("tombstone was not cleared by creation:", err)
+	}
+
+	// Unavailable guilds are not tombstoned
+	c.Guild("9101112")
+	c.HandleGuildDelete(&discordgo.GuildDelete{Guild: &discordgo.Guild{ID: "9101112", Unavailable: true}})
+	if _, err := c.Guild("9101112"); err != nil {
+		t.Error("unavailable guild was tombstoned:", err)
+	}
+
+	// Without a tombstone window, deletions only invalidate
+	c = NewCache(p)
+	c.HandleChannelDelete(&discordgo.ChannelDelete{Channel: &discordgo.Channel{ID: "1234"}})
+	if _, err := c.Channel("1234"); err != nil {
+		t.Error("deletion left a tombstone by default:", err)
+	}
+}
+
+func TestReconnectFlush(t *testing.T) {
+	c := NewCache(MockProvider{}, WithResumeFlush(TypeMember), WithReadyFlush(TypeChannel, TypeMember))
+	seed := func() {
+		c.SeedChannels([]*discordgo.Channel{{ID: "1"}})
+		c.SeedUsers([]*discordgo.User{{ID: "2"}})
+		c.members.replace(memberKey("3", "2"), &discordgo.Member{})
+	}
+	cached := func() (channel, user, member bool) {
+		return c.channels.has("1"), c.users.has("2"), c.members.has(memberKey("3", "2"))
+	}
+
+	// Connecting for the first time flushes nothing
+	seed()
+	c.HandleReady(&discordgo.Ready{})
+	c.HandleResumed(&discordgo.Resumed{})
+	if ch, u, m := cached(); !ch || !u || !m {
+		t.Errorf("cache flushed without a disconnect: channel %t, user %t, member %t", ch, u, m)
+	}
+
+	c.HandleDisconnect(&discordgo.Disconnect{})
+	c.HandleResumed(&discordgo.Resumed{})
+	if ch, u, m := cached(); !ch || !u || m {
+		t.Errorf("wrong flush on resume: channel %t, user %t, member %t", ch, u, m)
+	}
+
+	seed()
+	c.HandleDisconnect(&discordgo.Disconnect{})
+	c.HandleReady(&discordgo.Ready{User: &discordgo.User{ID: "4"}})
+	if ch, u, m := cached(); ch || !u || m {
+		t.Errorf("wrong flush on fresh start: channel %t, user %t, member %t", ch, u, m)
+	}
+	if !c.users.has("4") {
+		t.Error("READY payload was not seeded after flush")
+	}
+
+	// Each disconnect flushes at most once
+	seed()
+	c.HandleReady(&discordgo.Ready{})
+	if ch, u, m := cached(); !ch || !u || !m {
+		t.Errorf("cache flushed twice for one disconnect: channel %t, user %t, member %t", ch, u, m)
+	}
+}
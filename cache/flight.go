@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flightGroup collapses concurrent calls for the same key into a single call,
+// like singleflight.Group. The call is given a context of its own, carrying
+// the values of the context of the caller which started it, which is cancelled
+// only once every caller waiting on the call has given up, so that a call
+// abandoned by all is cancelled while one still awaited by any is not.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is a call in flight, or completed once done is closed.
+type flightCall struct {
+	done    chan struct{}
+	val     interface{}
+	err     error
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// do runs fn under key, or joins the call already in flight under key, and
+// returns its result. If ctx is done first, ctx.Err() is returned, and if no
+// other callers are left waiting, the context given to fn is cancelled.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(detachedContext{ctx})
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go g.run(fctx, key, call, fn)
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Later callers start a new call rather than joining one
+			// which has been cancelled
+			g.forget(key, call)
+			call.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run makes call, then releases its waiters.
+func (g *flightGroup) run(ctx context.Context, key string, call *flightCall, fn func(ctx context.Context) (interface{}, error)) {
+	defer call.cancel()
+	val, err := fn(ctx)
+
+	g.mu.Lock()
+	g.forget(key, call)
+	g.mu.Unlock()
+
+	call.val, call.err = val, err
+	close(call.done)
+}
+
+// forget removes call from key, if it is still the call in flight for key.
+// g.mu must be held.
+func (g *flightGroup) forget(key string, call *flightCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// detachedContext carries the values of its parent, such as the span of a
+// lookup, without its deadline or cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
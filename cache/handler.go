@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DefaultAttachmentHosts are the hosts of the Discord CDN, from which an
+// AttachmentHandler downloads attachments if no other hosts are given.
+var DefaultAttachmentHosts = []string{"cdn.discordapp.com", "media.discordapp.net"}
+
+// AttachmentHandler is an http.Handler which serves attachments from a Cache,
+// acting as a read-through proxy of the Discord CDN. The url of the attachment
+// is given by the url query parameter of each GET or HEAD request, such as
+//
+//	/attachments?url=https%3A%2F%2Fcdn.discordapp.com%2Fattachments%2F...
+//
+// Cached attachments are served from the cache, and attachments which are not
+// cached are downloaded and cached as by Cache.Attachment, although only from
+// the hosts the handler was created with, so that the handler cannot be used
+// to make requests on behalf of its clients to arbitrary hosts. Attachments on
+// other hosts which are not cached are reported as not found. Responses carry
+// the Content-Type and Content-Length of the attachment, and support range and
+// conditional requests against the cached content, such that browsers can seek
+// within videos.
+//
+// Attachments which do not exist, or whose download is refused with 404, are
+// answered with 404 Not Found, and other download failures with 502 Bad
+// Gateway. Once the cache is closed (see Close), every request is answered
+// with 503 Service Unavailable.
+type AttachmentHandler struct {
+	c     *Cache
+	hosts map[string]bool
+}
+
+// NewAttachmentHandler returns a handler serving attachments from c, which
+// downloads attachments which are not cached from hosts, or from
+// DefaultAttachmentHosts if no hosts are given.
+func NewAttachmentHandler(c *Cache, hosts ...string) *AttachmentHandler {
+	if len(hosts) == 0 {
+		hosts = DefaultAttachmentHosts
+	}
+
+	h := &AttachmentHandler{c: c, hosts: make(map[string]bool, len(hosts))}
+	for _, host := range hosts {
+		h.hosts[host] = true
+	}
+	return h
+}
+
+func (h *AttachmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw := r.URL.Query().Get("url")
+	u, err := url.Parse(raw)
+	if raw == "" || err != nil {
+		http.Error(w, "missing or invalid url", http.StatusBadRequest)
+		return
+	}
+	at := &discordgo.MessageAttachment{URL: raw, Filename: path.Base(u.Path)}
+	if h.c.closed.Load() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	key := h.c.keyOf(at)
+	if a, ok := h.c.cachedAttachment(key); ok {
+		a = h.c.revalidate(r.Context(), at, a)
+		rs, err := seekAttachment(a)
+		if err == nil {
+			defer rs.Close()
+			h.c.noteHit(TypeAttachment, key)
+			serveAttachment(w, r, a, rs)
+			return
+		}
+		// The backing file has been lost or corrupted, so download it
+		// again
+		h.c.discardAttachment(key, err)
+	}
+
+	if (u.Scheme != "https" && u.Scheme != "http") || !h.hosts[u.Host] {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	a, err := h.c.AttachmentContext(r.Context(), at)
+	switch {
+	case err == nil:
+		serveAttachment(w, r, a, bytes.NewReader(a.Content))
+	case ClassifyError(err) == ErrorNotFound:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		// The client has gone away, so there is no one to answer
+	default:
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	}
+}
+
+// serveAttachment serves the content of a, read from rs, in response to r.
+func serveAttachment(w http.ResponseWriter, r *http.Request, a Attachment, rs io.ReadSeeker) {
+	if a.Type != "" {
+		w.Header().Set("Content-Type", a.Type)
+	}
+	if a.ETag != "" {
+		w.Header().Set("ETag", a.ETag)
+	}
+	modified, _ := http.ParseTime(a.LastModified)
+	http.ServeContent(w, r, a.Name, modified, rs)
+}
+
+// seekAttachment is like openCached, but returns a stream which can also
+// seek. Compressed content is decompressed into memory first, and a backing
+// file is verified against the checksum of a before the stream is returned,
+// as a stream which can seek cannot be verified as it is read.
+func seekAttachment(a Attachment) (io.ReadSeekCloser, error) {
+	if a.Path != "" && a.Content == nil {
+		f, err := os.Open(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyFile(f, a.Checksum); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	if err := loadAttachment(&a); err != nil {
+		return nil, err
+	}
+
+	return nopSeekCloser{bytes.NewReader(a.Content)}, nil
+}
+
+// nopSeekCloser is a seekable stream with a no-op Close method.
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
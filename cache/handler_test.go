@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAttachmentHandler(t *testing.T) {
+	var hits int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path != "/video.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer cdn.Close()
+	host, _ := url.Parse(cdn.URL)
+
+	c := NewCache(MockProvider{})
+	c.AddAttachment("https://elsewhere.example/cached.png", "cached.png", "image/png", []byte("png"))
+	srv := httptest.NewServer(NewAttachmentHandler(c, host.Host))
+	defer srv.Close()
+
+	cases := []struct {
+		Name    string
+		Method  string
+		URL     string
+		Range   string
+		Status  int
+		Body    string
+		Type    string
+		Fetches int32
+	}{
+		{"Miss", http.MethodGet, cdn.URL + "/video.txt", "", http.StatusOK, "hello world", "text/plain; charset=utf-8", 1},
+		{"Hit", http.MethodGet, cdn.URL + "/video.txt", "", http.StatusOK, "hello world", "text/plain; charset=utf-8", 1},
+		{"Range", http.MethodGet, cdn.URL + "/video.txt", "bytes=6-", http.StatusPartialContent, "world", "text/plain; charset=utf-8", 1},
+		{"Head", http.MethodHead, cdn.URL + "/video.txt", "", http.StatusOK, "", "text/plain; charset=utf-8", 1},
+		{"Cached", http.MethodGet, "https://elsewhere.example/cached.png", "", http.StatusOK, "png", "image/png", 1},
+		{"NotFound", http.MethodGet, cdn.URL + "/notexist.png", "", http.StatusNotFound, "", "", 2},
+		{"Disallowed", http.MethodGet, "https://elsewhere.example/notexist.png", "", http.StatusNotFound, "", "", 2},
+		{"NoURL", http.MethodGet, "", "", http.StatusBadRequest, "", "", 2},
+		{"Method", http.MethodPost, cdn.URL + "/video.txt", "", http.StatusMethodNotAllowed, "", "", 2},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.Method, srv.URL+"/?url="+url.QueryEscape(tc.URL), nil)
+		if tc.Range != "" {
+			req.Header.Set("Range", tc.Range)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error from request: %v", tc.Name, err)
+		}
+		buf, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.Status {
+			t.Errorf("%s: wrong status\nexpect: %d\ngot: %d", tc.Name, tc.Status, resp.StatusCode)
+		}
+		if tc.Status < 300 {
+			if string(buf) != tc.Body {
+				t.Errorf("%s: wrong body\nexpect: %q\ngot: %q", tc.Name, tc.Body, buf)
+			}
+			if typ := resp.Header.Get("Content-Type"); typ != tc.Type {
+				t.Errorf("%s: wrong content type\nexpect: %s\ngot: %s", tc.Name, tc.Type, typ)
+			}
+		}
+		if n := atomic.LoadInt32(&hits); n != tc.Fetches {
+			t.Errorf("%s: wrong number of downloads\nexpect: %d\ngot: %d", tc.Name, tc.Fetches, n)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DefaultHistoryLimit is the number of recent messages cached for each channel
+// by RecentMessages if no other limit is configured.
+const DefaultHistoryLimit = 50
+
+// DefaultMaxHistories is the number of channels whose recent messages are
+// cached if no other bound is configured (see WithMaxEntries).
+const DefaultMaxHistories = 1000
+
+// maxPageSize is the most messages the Discord API returns for a single
+// request of a channel's history.
+const maxPageSize = 100
+
+// history is the recent history of a channel, newest message first.
+type history []*discordgo.Message
+
+// RecentMessages returns the most recent messages of channel channelID, newest
+// first, up to the history limit (see WithHistoryLimit). The first lookup of a
+// channel pages its history from the provider, and the history is then kept
+// up to date by HandleMessageCreate, HandleMessageUpdate and
+// HandleMessageDelete (see RegisterHandlers) until it is older than the
+// history TTL (see WithTTL) or is invalidated with InvalidateChannelHistory.
+// Histories are evicted whole, least recently used first, once more than
+// DefaultMaxHistories channels have their history cached (but see
+// WithMaxEntries). If the provider cannot look up channel histories (see
+// ChannelMessagesProvider), ErrUnsupported is returned.
+func (c *Cache) RecentMessages(channelID string) ([]discordgo.Message, error) {
+	return c.RecentMessagesContext(context.Background(), channelID)
+}
+
+// RecentMessagesContext is like RecentMessages, but stops waiting for the
+// provider and returns the context's error if ctx is done before the lookup
+// completes.
+func (c *Cache) RecentMessagesContext(ctx context.Context, channelID string) ([]discordgo.Message, error) {
+	v, err := c.histories.lookup(ctx, channelID, func(ctx context.Context) (*history, error) {
+		h, err := c.fetchHistory(ctx, channelID)
+		if err != nil {
+			return nil, err
+		}
+		return &h, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]discordgo.Message, len(*v))
+	for i, m := range *v {
+		msgs[i] = *m
+	}
+	return msgs, nil
+}
+
+// fetchHistory pages the most recent messages of channel channelID from the
+// provider with ctx, up to the history limit.
+func (c *Cache) fetchHistory(ctx context.Context, channelID string) (history, error) {
+	var (
+		h      history
+		before string
+	)
+	for len(h) < c.historyLimit {
+		n := c.historyLimit - len(h)
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+
+		page, err := fetchChannelMessages(ctx, c.provider, channelID, n, before, "", "")
+		if err != nil {
+			return nil, err
+		}
+		h = append(h, page...)
+		if len(page) < n {
+			break
+		}
+		before = page[len(page)-1].ID
+	}
+
+	return h, nil
+}
+
+// InvalidateChannelHistory invalidates the cached recent messages of channel
+// channelID, such that the next lookup pages them from the provider again.
+func (c *Cache) InvalidateChannelHistory(channelID string) error {
+	return c.histories.invalidate(channelID)
+}
+
+// InvalidateAllHistories invalidates the cached recent messages of every
+// channel.
+func (c *Cache) InvalidateAllHistories() {
+	c.histories.invalidateAll()
+}
+
+// updateHistory replaces the cached history of channel channelID, if any, by
+// a copy changed by update, keeping its insertion time, such that it expires
+// no later than the history it replaces. Updates are serialised against each
+// other, so that concurrent events are not lost, and against the insertion of
+// histories fetched by lookups, so that a fresher history is never replaced by
+// an update of the history it replaced.
+func (c *Cache) updateHistory(channelID string, update func(h history) history) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	e, ok := c.histories.peek(channelID)
+	if !ok {
+		return
+	}
+
+	h := update(append(history(nil), *e.val...))
+	if len(h) > c.historyLimit {
+		h = h[:c.historyLimit]
+	}
+	cp := *e
+	cp.val = &h
+	c.histories.insert(channelID, &cp)
+}
+
+// historyCreate adds a copy of the new message m to the history of its
+// channel.
+func (c *Cache) historyCreate(m *discordgo.Message) {
+	cp := *m
+	c.updateHistory(m.ChannelID, func(h history) history {
+		for _, old := range h {
+			if old.ID == m.ID {
+				return h
+			}
+		}
+		return append(history{&cp}, h...)
+	})
+}
+
+// historyUpdate replaces the edited message m in the history of its channel by
+// a copy. A partial update, which lacks the author, cannot replace the message,
+// so invalidates the whole history if the message is in it.
+func (c *Cache) historyUpdate(m *discordgo.Message) {
+	cp, stale := *m, false
+	c.updateHistory(m.ChannelID, func(h history) history {
+		for i, old := range h {
+			if old.ID != m.ID {
+				continue
+			}
+			if m.Author == nil {
+				stale = true
+			} else {
+				h[i] = &cp
+			}
+			break
+		}
+		return h
+	})
+	if stale {
+		c.histories.invalidate(m.ChannelID)
+	}
+}
+
+// historyDelete removes the message messageID from the history of channel
+// channelID.
+func (c *Cache) historyDelete(channelID, messageID string) {
+	c.updateHistory(channelID, func(h history) history {
+		for i, old := range h {
+			if old.ID == messageID {
+				return append(h[:i], h[i+1:]...)
+			}
+		}
+		return h
+	})
+}
+
+// olderID returns true if the snowflake a was created before the snowflake b.
+// Snowflakes grow over time, so compare as numbers rather than strings.
+func olderID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+
+	return a < b
+}
+
+// pageMessages returns up to limit copies of the messages of msgs, in any
+// order, which are older than beforeID and newer than afterID, if set, newest
+// first. Without afterID, the newest such messages are returned, and with it,
+// the oldest, as by the Discord API.
+func pageMessages(msgs []*discordgo.Message, limit int, beforeID, afterID string) []*discordgo.Message {
+	var page []*discordgo.Message
+	for _, m := range msgs {
+		if (beforeID == "" || olderID(m.ID, beforeID)) && (afterID == "" || olderID(afterID, m.ID)) {
+			page = append(page, m)
+		}
+	}
+	sort.Slice(page, func(i, j int) bool { return olderID(page[j].ID, page[i].ID) })
+	if limit > 0 && len(page) > limit {
+		if afterID != "" {
+			page = page[len(page)-limit:]
+		} else {
+			page = page[:limit]
+		}
+	}
+
+	return copyAll(page)
+}
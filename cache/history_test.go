@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// HistoryProvider is a MockProvider which also pages channel histories of
+// messages with IDs 1 to n.
+type HistoryProvider struct {
+	MockProvider
+
+	mu    sync.Mutex
+	n     int
+	pages int
+}
+
+func (p *HistoryProvider) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pages++
+
+	msgs := make([]*discordgo.Message, p.n)
+	for i := range msgs {
+		msgs[i] = &discordgo.Message{ID: strconv.Itoa(i + 1), ChannelID: channelID}
+	}
+	return pageMessages(msgs, limit, beforeID, afterID), nil
+}
+
+// ids returns the IDs of msgs in order.
+func ids(msgs []discordgo.Message) []string {
+	ret := make([]string, len(msgs))
+	for i, m := range msgs {
+		ret[i] = m.ID
+	}
+	return ret
+}
+
+func TestRecentMessages(t *testing.T) {
+	p := &HistoryProvider{n: 250}
+	c := NewCache(p, WithHistoryLimit(150))
+
+	// Histories longer than a page are paged from the newest message back
+	for i := 0; i < 2; i++ {
+		msgs, err := c.RecentMessages("1")
+		if err != nil {
+			t.Fatal("Unexpected error from history lookup:", err)
+		}
+		if len(msgs) != 150 || msgs[0].ID != "250" || msgs[149].ID != "101" {
+			t.Errorf("lookup %d: wrong history\nexpect: 150 messages from 250 to 101\ngot: %d messages from %s to %s",
+				i, len(msgs), msgs[0].ID, msgs[len(msgs)-1].ID)
+		}
+	}
+	if p.pages != 2 {
+		t.Errorf("wrong number of pages fetched\nexpect: 2\ngot: %d", p.pages)
+	}
+
+	// Histories are kept up to date by events, within the limit, although
+	// deleted messages are not backfilled
+	author := &discordgo.User{ID: "5678"}
+	c.HandleMessageCreate(&discordgo.MessageCreate{Message: &discordgo.Message{ID: "251", ChannelID: "1", Author: author}})
+	c.HandleMessageUpdate(&discordgo.MessageUpdate{Message: &discordgo.Message{ID: "250", ChannelID: "1", Author: author, Content: "edited"}})
+	c.HandleMessageDelete(&discordgo.MessageDelete{Message: &discordgo.Message{ID: "249", ChannelID: "1"}})
+	msgs, _ := c.RecentMessages("1")
+	if got := ids(msgs[:3]); len(msgs) != 149 || got[0] != "251" || got[1] != "250" || got[2] != "248" {
+		t.Errorf("wrong history after events\nexpect: 149 messages from [251 250 248]\ngot: %d messages from %v", len(msgs), got)
+	}
+	if msgs[1].Content != "edited" {
+		t.Errorf("edit not applied to history\nexpect: edited\ngot: %q", msgs[1].Content)
+	}
+	if p.pages != 2 {
+		t.Errorf("events caused pages to be fetched\nexpect: 2\ngot: %d", p.pages)
+	}
+
+	// Partial updates invalidate the history
+	c.HandleMessageUpdate(&discordgo.MessageUpdate{Message: &discordgo.Message{ID: "251", ChannelID: "1"}})
+	if _, ok := c.histories.get("1"); ok {
+		t.Error("history not invalidated by partial update")
+	}
+
+	// Histories of channels not cached are left alone
+	c.HandleMessageCreate(&discordgo.MessageCreate{Message: &discordgo.Message{ID: "1", ChannelID: "2"}})
+	if _, ok := c.histories.get("2"); ok {
+		t.Error("history cached for channel not looked up")
+	}
+
+	// Whole histories are evicted beyond the bound
+	c = NewCache(p, WithShards(1), WithMaxEntries(TypeHistory, 1))
+	c.RecentMessages("1")
+	c.RecentMessages("2")
+	if n := c.Stats().History; n.Entries != 1 || n.Evictions != 1 {
+		t.Errorf("wrong history stats\nexpect: 1 entry, 1 eviction\ngot: %+v", n)
+	}
+
+	if _, err := NewCache(MockProvider{}).RecentMessages("1"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("wrong error from unsupported provider\nexpect: %v\ngot: %v", ErrUnsupported, err)
+	}
+}
+
+func TestHistoryRefetchDuringEvent(t *testing.T) {
+	clk := NewFakeClock()
+	p := &HistoryProvider{n: 5}
+	c := NewCache(p, WithClock(clk), WithTTL(TypeHistory, time.Minute))
+	c.RecentMessages("1")
+
+	// The history expires and grows, so the next lookup fetches it again
+	clk.Advance(2 * time.Minute)
+	p.mu.Lock()
+	p.n = 10
+	p.mu.Unlock()
+
+	// Refetch while a MESSAGE_CREATE is updating the stale history
+	done := make(chan error)
+	c.updateHistory("1", func(h history) history {
+		go func() {
+			_, err := c.RecentMessages("1")
+			done <- err
+		}()
+		for {
+			p.mu.Lock()
+			pages := p.pages
+			p.mu.Unlock()
+			if pages == 2 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		return append(history{{ID: "6", ChannelID: "1"}}, h...)
+	})
+	if err := <-done; err != nil {
+		t.Fatal("Unexpected error from history lookup:", err)
+	}
+
+	e, ok := c.histories.peek("1")
+	if !ok || len(*e.val) != 10 || (*e.val)[0].ID != "10" {
+		t.Errorf("refetched history overwritten by update of stale history: %v", *e.val)
+	}
+	if e.expired(c.now(), time.Minute) {
+		t.Error("refetched history was given the insertion time of the stale history")
+	}
+}
+
+func TestStateChannelMessages(t *testing.T) {
+	s := newTestState()
+	s.MaxMessageCount = 10
+	for i := 1; i <= 5; i++ {
+		s.MessageAdd(&discordgo.Message{ID: strconv.Itoa(i), ChannelID: "2000"})
+	}
+
+	c := NewCache(NewStateProvider(s), WithHistoryLimit(3))
+	msgs, err := c.RecentMessages("2000")
+	if got := ids(msgs); err != nil || len(got) != 3 || got[0] != "5" || got[2] != "3" {
+		t.Errorf("wrong history from state\nexpect: [5 4 3]\ngot: %v (%v)", got, err)
+	}
+
+	p := NewStateProvider(s)
+	page, err := p.ChannelMessages("2000", 2, "", "1", "")
+	if err != nil || len(page) != 2 || page[0].ID != "3" || page[1].ID != "2" {
+		t.Errorf("wrong page after message from state: %v", err)
+	}
+	if _, err := p.ChannelMessages("2000", 2, "", "", "3"); !errors.Is(err, discordgo.ErrStateNotFound) {
+		t.Errorf("wrong error paging around message\nexpect: %v\ngot: %v", discordgo.ErrStateNotFound, err)
+	}
+}
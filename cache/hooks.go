@@ -0,0 +1,82 @@
+package cache
+
+// A Hook is a callback invoked with the type and ID of a cached object when
+// the cache acts upon it (see WithOnHit). For channels, users, guilds and
+// stickers, the ID is that of the object. For roles and emojis, which are
+// cached per guild, the ID is the guild ID, and for histories, which are cached
+// per channel, the channel ID. For members and messages, the ID is the guild
+// and user IDs, or the channel and message IDs, joined by a colon, with any
+// colon or backslash within either ID escaped by a backslash. For attachments,
+// the ID is the key the attachment is cached under, which is its url unless
+// another key is configured (see WithAttachmentKey).
+//
+// Hooks are invoked synchronously by the goroutine which performed the
+// action, after the action is complete and without any locks of the cache
+// held, so a hook may safely call back into the cache. Within a single lookup,
+// hooks are invoked in the order of the actions: a miss is followed by the
+// insertion of the fetched object, which is followed by the eviction of any
+// entries it displaced. There is no ordering between hooks invoked by
+// concurrent operations, so, for example, a hook may observe an eviction of an
+// entry before the insertion which caused it if the two happen concurrently.
+type Hook func(t ObjectType, id string)
+
+// statsFor returns the counters of objects of type t.
+func (c *Cache) statsFor(t ObjectType) *counters {
+	switch t {
+	case TypeChannel:
+		return &c.channelStats
+	case TypeUser:
+		return &c.userStats
+	case TypeGuild:
+		return &c.guildStats
+	case TypeMember:
+		return &c.memberStats
+	case TypeRole:
+		return &c.roleStats
+	case TypeEmoji:
+		return &c.emojiStats
+	case TypeSticker:
+		return &c.stickerStats
+	case TypeMessage:
+		return &c.messageStats
+	case TypeHistory:
+		return &c.historyStats
+	default:
+		return &c.attachmentStats
+	}
+}
+
+// noteHit records a lookup of id served from the cache.
+func (c *Cache) noteHit(t ObjectType, id string) {
+	c.statsFor(t).hits.Add(1)
+	if c.onHit != nil {
+		c.onHit(t, id)
+	}
+}
+
+// noteMiss records a lookup of id which was not present in the cache.
+func (c *Cache) noteMiss(t ObjectType, id string) {
+	c.statsFor(t).misses.Add(1)
+	if c.onMiss != nil {
+		c.onMiss(t, id)
+	}
+}
+
+// noteInsert records the insertion of id into the cache, along with the keys
+// of any entries evicted to make room for it.
+func (c *Cache) noteInsert(t ObjectType, id string, evicted []string) {
+	if c.onInsert != nil {
+		c.onInsert(t, id)
+	}
+	c.noteEvict(t, evicted...)
+}
+
+// noteEvict records the removal of ids from the cache.
+func (c *Cache) noteEvict(t ObjectType, ids ...string) {
+	c.statsFor(t).evictions.Add(uint64(len(ids)))
+	if c.onEvict != nil {
+		for _, id := range ids {
+			c.onEvict(t, id)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// hookRecorder records the hooks invoked on a cache.
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *hookRecorder) hook(kind string) Hook {
+	return func(t ObjectType, id string) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.events = append(h.events, fmt.Sprintf("%s %s %s", kind, t, id))
+	}
+}
+
+func (h *hookRecorder) options() []Option {
+	return []Option{
+		WithOnHit(h.hook("hit")),
+		WithOnMiss(h.hook("miss")),
+		WithOnInsert(h.hook("insert")),
+		WithOnEvict(h.hook("evict")),
+	}
+}
+
+func TestHooks(t *testing.T) {
+	h := &hookRecorder{}
+	c := NewCache(MockProvider{}, append(h.options(), WithShards(1), WithMaxEntries(TypeUser, 1))...)
+
+	olduser := discordgo.User{ID: "old"}
+	c.users.set("old", newEntry(&olduser, time.Now()))
+
+	c.Channel("1234")
+	c.Channel("1234")
+	c.User("5678")
+	c.mu.Lock()
+	c.insertAttachment("a", &Attachment{LastReference: time.Now().Add(-2 * AttachmentLifetime)})
+	c.mu.Unlock()
+	c.Clean()
+	c.InvalidateChannel("1234")
+
+	expect := []string{
+		"miss channel 1234",
+		"insert channel 1234",
+		"hit channel 1234",
+		"miss user 5678",
+		"insert user 5678",
+		"evict user old",
+		"evict attachment a",
+		"evict channel 1234",
+	}
+	if !reflect.DeepEqual(h.events, expect) {
+		t.Errorf("wrong hook events\nexpect: %q\ngot: %q", expect, h.events)
+	}
+}
+
+// Hooks must not be invoked with the cache locked, so may call back into it.
+func TestHooksReentrant(t *testing.T) {
+	var c *Cache
+	reenter := func(t ObjectType, id string) {
+		c.Stats()
+		c.InvalidateAllChannels()
+	}
+	c = NewCache(MockProvider{}, WithOnHit(reenter), WithOnInsert(reenter), WithOnEvict(reenter))
+
+	c.mu.Lock()
+	c.insertAttachment("a", &Attachment{LastReference: time.Now().Add(-2 * AttachmentLifetime)})
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Channel("1234")
+		c.Clean()
+		c.InvalidateAllAttachments()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("hook deadlocked calling back into cache")
+	}
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// groupIndex is a secondary index of the keys of an objectCache by group, such
+// as the guild of each channel, so that every entry of a group can be found
+// without walking the whole table. The keys of each group are kept in order of
+// use, so that a group may be bounded by evicting its least recently used keys.
+type groupIndex struct {
+	mu sync.Mutex
+	// Keys of each group, most recently used first. Element values are
+	// always keys.
+	keys map[string]*list.List
+	// Group and element of each key.
+	groups map[string]groupElem
+}
+
+type groupElem struct {
+	group string
+	elem  *list.Element
+}
+
+func newGroupIndex() *groupIndex {
+	return &groupIndex{
+		keys:   make(map[string]*list.List),
+		groups: make(map[string]groupElem),
+	}
+}
+
+// add records key as the most recently used member of group, replacing any
+// previous group of key.
+func (g *groupIndex) add(group, key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.removeLocked(key)
+	if group == "" {
+		return
+	}
+	if g.keys[group] == nil {
+		g.keys[group] = list.New()
+	}
+	g.groups[key] = groupElem{group, g.keys[group].PushFront(key)}
+}
+
+// touch records a use of key, if indexed.
+func (g *groupIndex) touch(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ge, ok := g.groups[key]; ok {
+		g.keys[ge.group].MoveToFront(ge.elem)
+	}
+}
+
+// overflow forgets and returns the least recently used keys of group beyond
+// the first limit.
+func (g *groupIndex) overflow(group string, limit int) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var keys []string
+	for l := g.keys[group]; l != nil && l.Len() > limit; l = g.keys[group] {
+		key := l.Back().Value.(string)
+		g.removeLocked(key)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// remove forgets each of keys.
+func (g *groupIndex) remove(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys {
+		g.removeLocked(key)
+	}
+}
+
+func (g *groupIndex) removeLocked(key string) {
+	ge, ok := g.groups[key]
+	if !ok {
+		return
+	}
+
+	delete(g.groups, key)
+	l := g.keys[ge.group]
+	l.Remove(ge.elem)
+	if l.Len() == 0 {
+		delete(g.keys, ge.group)
+	}
+}
+
+// members returns the keys of group.
+func (g *groupIndex) members(group string) []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	l := g.keys[group]
+	if l == nil {
+		return nil
+	}
+	keys := make([]string, 0, l.Len())
+	for e := l.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	return keys
+}
+
+// clear forgets every key.
+func (g *groupIndex) clear() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.keys = make(map[string]*list.List)
+	g.groups = make(map[string]groupElem)
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"time"
+)
+
+// AttachmentMeta is the metadata of a cached attachment, without its content.
+type AttachmentMeta struct {
+	Name, Type, DeclaredType string
+	// Size is the size of the content in bytes, as downloaded.
+	Size int64
+	// Checksum is the SHA-256 of the content.
+	Checksum      [sha256.Size]byte
+	LastReference time.Time
+}
+
+// AttachmentInfo returns the metadata of the cached attachment at url, or false
+// if it is not cached. Unlike Attachment, the content is neither copied nor
+// read from disk, and nothing is downloaded on a miss. Like HasAttachment, the
+// reference time of the attachment is not updated. A closed cache (see Close)
+// reports every attachment as not cached.
+func (c *Cache) AttachmentInfo(url string) (AttachmentMeta, bool) {
+	if c.closed.Load() {
+		return AttachmentMeta{}, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	a, ok := c.attachmentCache[c.keyOfURL(url)]
+	if !ok {
+		return AttachmentMeta{}, false
+	}
+	return AttachmentMeta{
+		Name:          a.Name,
+		Type:          a.Type,
+		DeclaredType:  a.DeclaredType,
+		Size:          a.contentSize(),
+		Checksum:      a.Checksum,
+		LastReference: a.LastReference,
+	}, true
+}
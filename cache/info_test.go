@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestAttachmentInfo(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible "), 100)
+	cases := []struct {
+		Name string
+		Opts []Option
+	}{
+		{"Memory", nil},
+		{"Compressed", []Option{WithCompression(100)}},
+		{"Disk", []Option{WithAttachmentDir(t.TempDir())}},
+	}
+
+	for _, tc := range cases {
+		c := NewCache(MockProvider{}, tc.Opts...)
+		c.AddAttachment("https://example.com/a.txt", "a.txt", "text/plain", content)
+
+		info, ok := c.AttachmentInfo("https://example.com/a.txt")
+		if !ok {
+			t.Fatalf("%s: cached attachment info not found", tc.Name)
+		}
+		expect := AttachmentMeta{
+			Name:          "a.txt",
+			Type:          "text/plain",
+			Size:          int64(len(content)),
+			Checksum:      sha256.Sum256(content),
+			LastReference: info.LastReference,
+		}
+		if info != expect || info.LastReference.IsZero() {
+			t.Errorf("%s: wrong attachment info\nexpect: %+v\ngot: %+v", tc.Name, expect, info)
+		}
+
+		if _, ok := c.AttachmentInfo("https://example.com/missing.txt"); ok {
+			t.Errorf("%s: info found for missing attachment", tc.Name)
+		}
+		if s := c.Stats().Attachment; s.Hits != 0 || s.Misses != 0 {
+			t.Errorf("%s: info lookups were counted: %+v", tc.Name, s)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import "time"
+
+// StartJanitor starts a background goroutine which calls Clean every interval
+// until StopJanitor is called, such that embedders need not schedule cleaning
+// themselves. If the janitor is already running, StartJanitor does nothing, so
+// the interval of the running janitor is kept. An interval of zero or less
+// also does nothing, as does starting the janitor of a closed cache (see
+// Close).
+func (c *Cache) StartJanitor(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	c.janitorMu.Lock()
+	defer c.janitorMu.Unlock()
+	if c.janitorStop != nil || c.closed.Load() {
+		return
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	c.janitorStop, c.janitorDone = stop, done
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				c.Clean()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopJanitor stops the janitor started by StartJanitor, waiting for any Clean
+// in progress to complete. It is safe to call StopJanitor if no janitor is
+// running. After StopJanitor returns, the janitor may be started again.
+func (c *Cache) StopJanitor() {
+	c.janitorMu.Lock()
+	defer c.janitorMu.Unlock()
+	if c.janitorStop == nil {
+		return
+	}
+
+	close(c.janitorStop)
+	<-c.janitorDone
+	c.janitorStop, c.janitorDone = nil, nil
+}
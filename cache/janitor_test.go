@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestJanitor(t *testing.T) {
+	c := NewCache(MockProvider{}, WithTTL(TypeChannel, time.Millisecond))
+	testchan := discordgo.Channel{ID: "testchan"}
+	c.channels.set("testchan", newEntry(&testchan, time.Now()))
+
+	// Stopping with no janitor running is harmless
+	c.StopJanitor()
+
+	c.StartJanitor(time.Millisecond * 5)
+	first := c.janitorStop
+	c.StartJanitor(time.Millisecond * 5)
+	if c.janitorStop != first {
+		t.Error("second StartJanitor started another janitor")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for c.channels.len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	if c.channels.len() != 0 {
+		t.Error("janitor did not clean expired channel")
+	}
+
+	c.StopJanitor()
+	c.StopJanitor()
+	if c.janitorStop != nil {
+		t.Error("janitor still registered after StopJanitor")
+	}
+
+	// Restarting after a stop works
+	c.StartJanitor(time.Millisecond * 5)
+	c.StopJanitor()
+}
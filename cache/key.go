@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// An AttachmentKeyFunc returns the key under which the attachment at is cached
+// (see WithAttachmentKey). Attachments with the same key are treated as the
+// same attachment.
+type AttachmentKeyFunc func(at *discordgo.MessageAttachment) string
+
+// keyOf returns the key under which at is cached.
+func (c *Cache) keyOf(at *discordgo.MessageAttachment) string {
+	if c.attachmentKey == nil {
+		return at.URL
+	}
+
+	return c.attachmentKey(at)
+}
+
+// keyOfURL returns the key under which the attachment at url is cached, for
+// the methods which are given only the url of an attachment.
+func (c *Cache) keyOfURL(url string) string {
+	return c.keyOf(&discordgo.MessageAttachment{URL: url})
+}
+
+// keySep separates the parts of a composite key, and keyEscape escapes any
+// occurrence of either within a part.
+const (
+	keySep    = ':'
+	keyEscape = '\\'
+)
+
+// compositeKey is the key of an object identified by two IDs, such as a member
+// by its guild and user. Tables are keyed by string rather than by
+// compositeKey, as the key of every entry also leaves the cache as a string:
+// to a Store (see WithStore), to the hit and miss hooks (see WithOnHit), as the
+// key of its flight and negative cache entry, and to the group index. A
+// compositeKey is therefore stored in its encoded form (see String), which
+// escapes the separator within each part rather than assuming IDs never
+// contain it, so distinct keys never share an encoding.
+type compositeKey struct {
+	parent, id string
+}
+
+// String returns the encoding of k: its parts joined by keySep, with each
+// keySep and keyEscape within a part preceded by keyEscape. Parts without
+// either, such as snowflakes, are left unchanged, so keys of numeric IDs are
+// encoded as parent:id.
+func (k compositeKey) String() string {
+	return escapeKeyPart(k.parent) + string(keySep) + escapeKeyPart(k.id)
+}
+
+// escapeKeyPart returns s with each keySep and keyEscape escaped.
+func escapeKeyPart(s string) string {
+	if !strings.ContainsAny(s, string(keySep)+string(keyEscape)) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == keySep || s[i] == keyEscape {
+			b.WriteByte(keyEscape)
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseCompositeKey decodes a key encoded by compositeKey.String, returning
+// false if s is not such an encoding.
+func parseCompositeKey(s string) (compositeKey, bool) {
+	var (
+		parts [2]strings.Builder
+		n     int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == keyEscape:
+			i++
+			if i == len(s) {
+				return compositeKey{}, false
+			}
+		case s[i] == keySep:
+			n++
+			if n == len(parts) {
+				return compositeKey{}, false
+			}
+			continue
+		}
+		parts[n].WriteByte(s[i])
+	}
+	if n != 1 {
+		return compositeKey{}, false
+	}
+
+	return compositeKey{parts[0].String(), parts[1].String()}, true
+}
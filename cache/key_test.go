@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pathKey keys attachments by the path of their url, ignoring its query.
+func pathKey(at *discordgo.MessageAttachment) string {
+	u, err := url.Parse(at.URL)
+	if err != nil {
+		return at.URL
+	}
+	return u.Path
+}
+
+func TestAttachmentKey(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{}, WithAttachmentKey(pathKey))
+	for _, sig := range []string{"?ex=1&hm=a", "?ex=2&hm=b"} {
+		at := &discordgo.MessageAttachment{URL: srv.URL + "/a.png" + sig}
+		if a, err := c.Attachment(at); err != nil || string(a.Content) != "content" {
+			t.Error("failed to retrieve attachment:", err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("wrong number of downloads\nexpect: 1\ngot: %d", hits)
+	}
+
+	// Methods given a url use the same key
+	if !c.HasAttachment(srv.URL + "/a.png?ex=3") {
+		t.Error("attachment was not found by url with another query")
+	}
+	var buf bytes.Buffer
+	if _, err := c.WriteAttachmentTo(&buf, "http://proxy.invalid/a.png"); err != nil || buf.String() != "content" {
+		t.Error("failed to write attachment by url on another host:", err)
+	}
+	c.AddAttachment("http://proxy.invalid/b.png?ex=4", "", "", []byte("added"))
+	if _, ok := c.attachmentCache["/b.png"]; !ok {
+		t.Error("added attachment was not cached under its key")
+	}
+}
+
+// EchoProvider returns members and messages identified by the IDs they were
+// looked up with.
+type EchoProvider struct {
+	MockProvider
+}
+
+func (EchoProvider) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	return &discordgo.Member{GuildID: guildID, User: &discordgo.User{ID: userID}}, nil
+}
+
+func (EchoProvider) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	return &discordgo.Message{ChannelID: channelID, ID: messageID}, nil
+}
+
+func TestCompositeKey(t *testing.T) {
+	// IDs containing the separator, which would collide if simply joined
+	pairs := [][2]compositeKey{
+		{{"1:2", "3"}, {"1", "2:3"}},
+		{{"1\\", ":2"}, {"1\\:", "2"}},
+		{{"", ":"}, {":", ""}},
+		{{"1\\", "2"}, {"1", "\\2"}},
+	}
+	for _, p := range pairs {
+		a, b := p[0].String(), p[1].String()
+		if a == b {
+			t.Errorf("keys %q and %q share encoding %q", p[0], p[1], a)
+		}
+		for _, k := range p {
+			if got, ok := parseCompositeKey(k.String()); !ok || got != k {
+				t.Errorf("key did not round trip\nexpect: %+v\ngot: %+v (%t)", k, got, ok)
+			}
+		}
+	}
+	if k := (compositeKey{"9101112", "5678"}).String(); k != "9101112:5678" {
+		t.Errorf("wrong encoding of snowflake key\nexpect: 9101112:5678\ngot: %s", k)
+	}
+	for _, s := range []string{"1", "1:2:3", "1\\", "1:2\\"} {
+		if k, ok := parseCompositeKey(s); ok {
+			t.Errorf("invalid key %q parsed as %+v", s, k)
+		}
+	}
+
+	// Lookups of colliding IDs are kept apart
+	c := NewCache(EchoProvider{})
+	for _, p := range pairs {
+		for _, k := range p {
+			m, err := c.Member(k.parent, k.id)
+			if err != nil || m.GuildID != k.parent || m.User.ID != k.id {
+				t.Errorf("wrong member for %+v: %+v (%v)", k, m, err)
+			}
+			msg, err := c.Message(k.parent, k.id)
+			if err != nil || msg.ChannelID != k.parent || msg.ID != k.id {
+				t.Errorf("wrong message for %+v: %+v (%v)", k, msg, err)
+			}
+		}
+	}
+	if n := c.Stats().Member.Entries; n != 8 {
+		t.Errorf("wrong member entry count\nexpect: 8\ngot: %d", n)
+	}
+
+	// Members are indexed by their own guild
+	if n := c.InvalidateGuildCascade("1:2"); n != 1 {
+		t.Errorf("wrong number of entries invalidated\nexpect: 1\ngot: %d", n)
+	}
+	if _, ok := c.members.get(compositeKey{"1", "2:3"}.String()); !ok {
+		t.Error("member of another guild invalidated by cascade")
+	}
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the buckets of the provider call
+// latency histograms, spanning a fast local provider to a throttled API.
+var latencyBounds = [...]time.Duration{
+	time.Millisecond,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 2,
+	time.Second * 5,
+	time.Second * 10,
+}
+
+// A LatencyBucket is a bucket of a LatencyStats histogram.
+type LatencyBucket struct {
+	// UpperBound is the longest latency counted by the bucket.
+	UpperBound time.Duration
+	// Count is the number of calls which took no longer than UpperBound,
+	// including those counted by the buckets before.
+	Count uint64
+}
+
+// LatencyStats is a histogram of the latency of the provider calls made for
+// the lookups of one object type which missed the cache, from just before
+// each call to just after it returns.
+type LatencyStats struct {
+	// Count is the number of calls made, and Sum their total latency.
+	Count uint64
+	Sum   time.Duration
+	// Buckets are the cumulative buckets of the histogram, in ascending
+	// order. Calls longer than the last bound are only counted by Count.
+	Buckets []LatencyBucket
+}
+
+// Mean returns the mean latency of the calls, or zero if none were made.
+func (s LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Quantile returns an estimate of the q-quantile of the latency of the calls,
+// such that Quantile(0.99) is the 99th percentile, interpolated linearly
+// within the bucket in which it falls. Quantiles beyond the last bucket are
+// reported as its upper bound. If no calls were made, zero is returned.
+func (s LatencyStats) Quantile(q float64) time.Duration {
+	if s.Count == 0 || len(s.Buckets) == 0 {
+		return 0
+	}
+	switch {
+	case q < 0:
+		q = 0
+	case q > 1:
+		q = 1
+	}
+
+	rank := q * float64(s.Count)
+	var lower time.Duration
+	var below uint64
+	for _, b := range s.Buckets {
+		if float64(b.Count) >= rank && b.Count > below {
+			frac := (rank - float64(below)) / float64(b.Count-below)
+			return lower + time.Duration(frac*float64(b.UpperBound-lower))
+		}
+		lower, below = b.UpperBound, b.Count
+	}
+
+	return s.Buckets[len(s.Buckets)-1].UpperBound
+}
+
+// ProviderLatency returns the histogram of the latency of the provider calls
+// made by lookups of type t which missed the cache, including calls which
+// failed. Calls shared by concurrent lookups are counted once. Attachment
+// downloads are not provider calls, so are not counted. Like Stats, the
+// histogram is kept for the lifetime of the cache.
+func (c *Cache) ProviderLatency(t ObjectType) LatencyStats {
+	return c.statsFor(t).latency.snapshot()
+}
+
+// latency is the live histogram of provider call latencies of one object type.
+type latency struct {
+	// Counts of the calls within each bucket, not cumulatively, and beyond
+	// the last bucket.
+	counts [len(latencyBounds) + 1]atomic.Uint64
+	sum    atomic.Int64
+}
+
+// observe records a call which took d.
+func (l *latency) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	l.counts[i].Add(1)
+	l.sum.Add(int64(d))
+}
+
+func (l *latency) snapshot() LatencyStats {
+	s := LatencyStats{
+		Sum:     time.Duration(l.sum.Load()),
+		Buckets: make([]LatencyBucket, len(latencyBounds)),
+	}
+	for i, bound := range latencyBounds {
+		s.Count += l.counts[i].Load()
+		s.Buckets[i] = LatencyBucket{UpperBound: bound, Count: s.Count}
+	}
+	s.Count += l.counts[len(latencyBounds)].Load()
+
+	return s
+}
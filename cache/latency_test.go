@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DelayingProvider is a MockProvider whose channel lookups take delay on clock.
+type DelayingProvider struct {
+	MockProvider
+	clock *FakeClock
+	delay time.Duration
+}
+
+func (p DelayingProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	p.clock.Advance(p.delay)
+	return p.MockProvider.Channel(channelID)
+}
+
+func TestProviderLatency(t *testing.T) {
+	clock := NewFakeClock()
+	c := NewCache(DelayingProvider{clock: clock, delay: 30 * time.Millisecond}, WithClock(clock))
+
+	c.Channel("1234") // Miss
+	c.Channel("1234") // Hit
+	c.Channel("abcd") // Miss (error)
+	c.User("5678")
+
+	l := c.ProviderLatency(TypeChannel)
+	if l.Count != 2 || l.Sum != 60*time.Millisecond || l.Mean() != 30*time.Millisecond {
+		t.Errorf("wrong channel latency\nexpect: 2 calls totalling 60ms\ngot: %d calls totalling %v", l.Count, l.Sum)
+	}
+	for _, b := range l.Buckets {
+		expect := uint64(0)
+		if b.UpperBound >= 50*time.Millisecond {
+			expect = 2
+		}
+		if b.Count != expect {
+			t.Errorf("wrong count of bucket %v\nexpect: %d\ngot: %d", b.UpperBound, expect, b.Count)
+		}
+	}
+	if q := l.Quantile(0.5); q <= 25*time.Millisecond || q > 50*time.Millisecond {
+		t.Errorf("wrong median latency\nexpect: within (25ms, 50ms]\ngot: %v", q)
+	}
+	if l := c.ProviderLatency(TypeUser); l.Count != 1 || l.Sum != 0 {
+		t.Errorf("wrong user latency\nexpect: 1 call totalling 0s\ngot: %d calls totalling %v", l.Count, l.Sum)
+	}
+	if l := c.ProviderLatency(TypeGuild); l.Count != 0 || l.Quantile(0.99) != 0 {
+		t.Errorf("latency recorded without calls: %+v", l)
+	}
+}
+
+func TestLatencyQuantile(t *testing.T) {
+	l := LatencyStats{
+		Count: 10,
+		Buckets: []LatencyBucket{
+			{UpperBound: 10 * time.Millisecond, Count: 5},
+			{UpperBound: 20 * time.Millisecond, Count: 5},
+			{UpperBound: 100 * time.Millisecond, Count: 9},
+		},
+	}
+
+	cases := []struct {
+		Q      float64
+		Expect time.Duration
+	}{
+		{0, 0},
+		{0.25, 5 * time.Millisecond},
+		{0.5, 10 * time.Millisecond},
+		{0.7, 60 * time.Millisecond},
+		{0.99, 100 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		if got := l.Quantile(tc.Q); got != tc.Expect {
+			t.Errorf("%v: wrong quantile\nexpect: %v\ngot: %v", tc.Q, tc.Expect, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"math"
+	"time"
+)
+
+// An EvictionPolicy decides which attachments Clean evicts first once the
+// attachment cache is over its limits (see WithEvictionPolicy).
+type EvictionPolicy int
+
+// Attachment eviction policies.
+const (
+	// PolicyLRU evicts the least recently referenced attachments first.
+	PolicyLRU EvictionPolicy = iota
+	// PolicyLFU evicts the least frequently referenced attachments first.
+	// References are counted with exponential decay, such that an
+	// attachment referenced often in the past but not lately loses its
+	// value over time.
+	PolicyLFU
+	// PolicyWeightedLFU is like PolicyLFU, but the value of an attachment
+	// is also weighted by its size, such that large attachments, which cost
+	// the most to download again, are kept over small ones referenced as
+	// often.
+	PolicyWeightedLFU
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	case PolicyWeightedLFU:
+		return "weighted lfu"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultLFUHalfLife is the time over which the reference count of an
+// attachment decays by half under PolicyLFU if no other half-life is
+// configured.
+const DefaultLFUHalfLife = time.Hour
+
+// The decayed reference count of an attachment, n·2^(-t/h) at t half-lives h
+// after its last reference, shrinks at the same rate for every attachment, so
+// attachments are ordered by the logarithm of their count at a fixed time
+// instead: the epoch of the cache. Their order then never changes as time
+// passes, and they can be kept in a heap.
+
+// halfLives returns the number of LFU half-lives from the epoch of c to now.
+func (c *Cache) halfLives(now time.Time) float64 {
+	return float64(now.Sub(c.lfuEpoch)) / float64(c.lfuHalfLife)
+}
+
+// referenceScore records a reference of a at now in its score, the base 2
+// logarithm of its decayed reference count as of the epoch of c.
+func (c *Cache) referenceScore(a *Attachment, now time.Time) {
+	t := c.halfLives(now)
+	a.score = t + math.Log2(math.Exp2(a.score-t)+1)
+}
+
+// value returns the score by which a is ordered for eviction.
+func (a *Attachment) value(weighted bool) float64 {
+	if weighted {
+		return a.score + math.Log2(float64(a.contentSize()+1))
+	}
+
+	return a.score
+}
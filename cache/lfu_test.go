@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestEvictionPolicy(t *testing.T) {
+	cached := func(c *Cache) []string {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		var urls []string
+		for url := range c.attachmentCache {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		return urls
+	}
+	reference := func(c *Cache, url string, n int) {
+		for i := 0; i < n; i++ {
+			if _, err := c.Attachment(&discordgo.MessageAttachment{URL: url}); err != nil {
+				t.Fatalf("%s: unexpected error from attachment lookup: %v", url, err)
+			}
+		}
+	}
+
+	clock := NewFakeClock()
+	c := NewCache(MockProvider{}, WithClock(clock), WithAttachmentLifetime(24*time.Hour),
+		WithAttachmentPruneThreshold(2), WithEvictionPolicy(PolicyLFU, time.Minute))
+
+	// The most frequently referenced attachment is kept, although it is
+	// the least recently referenced
+	c.AddAttachment("hot", "hot", "", []byte("hot"))
+	reference(c, "hot", 4)
+	clock.Advance(time.Second)
+	c.AddAttachment("warm", "warm", "", []byte("warm"))
+	clock.Advance(time.Second)
+	c.AddAttachment("new", "new", "", []byte("new"))
+	c.Clean()
+	if got := cached(c); len(got) != 2 || got[0] != "hot" || got[1] != "new" {
+		t.Errorf("wrong attachments kept by lfu\nexpect: [hot new]\ngot: %v", got)
+	}
+
+	// Reference counts decay, so attachments which have gone cold are
+	// evicted in time
+	clock.Advance(10 * time.Minute)
+	reference(c, "new", 1)
+	c.AddAttachment("newer", "newer", "", []byte("newer"))
+	c.Clean()
+	if got := cached(c); len(got) != 2 || got[0] != "new" || got[1] != "newer" {
+		t.Errorf("wrong attachments kept after decay\nexpect: [new newer]\ngot: %v", got)
+	}
+
+	// Under weighted LFU, larger attachments are kept over smaller ones
+	// referenced as often
+	for _, p := range []EvictionPolicy{PolicyLFU, PolicyWeightedLFU} {
+		clock := NewFakeClock()
+		c := NewCache(MockProvider{}, WithClock(clock), WithAttachmentLifetime(24*time.Hour),
+			WithAttachmentPruneThreshold(1), WithEvictionPolicy(p, time.Minute))
+
+		c.AddAttachment("large", "large", "", bytes.Repeat([]byte("l"), 1000))
+		clock.Advance(time.Second)
+		c.AddAttachment("small", "small", "", []byte("s"))
+		c.Clean()
+
+		expect := "small"
+		if p == PolicyWeightedLFU {
+			expect = "large"
+		}
+		if got := cached(c); len(got) != 1 || got[0] != expect {
+			t.Errorf("%v: wrong attachment kept\nexpect: [%s]\ngot: %v", p, expect, got)
+		}
+	}
+
+	// The default policy remains LRU
+	clock = NewFakeClock()
+	c = NewCache(MockProvider{}, WithClock(clock), WithAttachmentPruneThreshold(1))
+	c.AddAttachment("hot", "hot", "", []byte("hot"))
+	reference(c, "hot", 4)
+	clock.Advance(time.Second)
+	c.AddAttachment("new", "new", "", []byte("new"))
+	c.Clean()
+	if got := cached(c); len(got) != 1 || got[0] != "new" {
+		t.Errorf("wrong attachment kept by lru\nexpect: [new]\ngot: %v", got)
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ChannelFunc is like Channel, but on a miss the channel is loaded by calling
+// load rather than the provider, such as to source it from a database. The
+// result of load is cached and its errors are handled as if from the provider,
+// so an error showing that the channel does not exist is wrapped as
+// ErrNotFound. A miss is only ever served by load: the call is not shared with
+// concurrent lookups of the same channel through the provider or through other
+// loaders, although it is shared with concurrent calls of ChannelFunc for the
+// same channel, such that a miss may be served by the load of another. Once
+// load completes, its result replaces any entry inserted by those lookups in
+// the meantime.
+func (c *Cache) ChannelFunc(ID string, load func() (*discordgo.Channel, error)) (discordgo.Channel, error) {
+	return c.ChannelFuncContext(context.Background(), ID, load)
+}
+
+// ChannelFuncContext is like ChannelFunc, but stops waiting for load and
+// returns the context's error if ctx is done before the lookup completes.
+func (c *Cache) ChannelFuncContext(ctx context.Context, ID string, load func() (*discordgo.Channel, error)) (discordgo.Channel, error) {
+	return lookupFunc(ctx, c.channels, ID, load)
+}
+
+// UserFunc is like ChannelFunc, but for users.
+func (c *Cache) UserFunc(ID string, load func() (*discordgo.User, error)) (discordgo.User, error) {
+	return c.UserFuncContext(context.Background(), ID, load)
+}
+
+// UserFuncContext is like ChannelFuncContext, but for users.
+func (c *Cache) UserFuncContext(ctx context.Context, ID string, load func() (*discordgo.User, error)) (discordgo.User, error) {
+	return lookupFunc(ctx, c.users, ID, load)
+}
+
+// GuildFunc is like ChannelFunc, but for guilds.
+func (c *Cache) GuildFunc(ID string, load func() (*discordgo.Guild, error)) (discordgo.Guild, error) {
+	return c.GuildFuncContext(context.Background(), ID, load)
+}
+
+// GuildFuncContext is like ChannelFuncContext, but for guilds.
+func (c *Cache) GuildFuncContext(ctx context.Context, ID string, load func() (*discordgo.Guild, error)) (discordgo.Guild, error) {
+	return lookupFunc(ctx, c.guilds, ID, load)
+}
+
+// MemberFunc is like ChannelFunc, but for the member userID of guild guildID.
+func (c *Cache) MemberFunc(guildID, userID string, load func() (*discordgo.Member, error)) (discordgo.Member, error) {
+	return c.MemberFuncContext(context.Background(), guildID, userID, load)
+}
+
+// MemberFuncContext is like ChannelFuncContext, but for the member userID of
+// guild guildID.
+func (c *Cache) MemberFuncContext(ctx context.Context, guildID, userID string, load func() (*discordgo.Member, error)) (discordgo.Member, error) {
+	return lookupFunc(ctx, c.members, memberKey(guildID, userID), load)
+}
+
+// StickerFunc is like ChannelFunc, but for stickers.
+func (c *Cache) StickerFunc(ID string, load func() (*discordgo.Sticker, error)) (discordgo.Sticker, error) {
+	return c.StickerFuncContext(context.Background(), ID, load)
+}
+
+// StickerFuncContext is like ChannelFuncContext, but for stickers.
+func (c *Cache) StickerFuncContext(ctx context.Context, ID string, load func() (*discordgo.Sticker, error)) (discordgo.Sticker, error) {
+	return lookupFunc(ctx, c.stickers, ID, load)
+}
+
+// MessageFunc is like ChannelFunc, but for the message messageID of channel
+// channelID.
+func (c *Cache) MessageFunc(channelID, messageID string, load func() (*discordgo.Message, error)) (discordgo.Message, error) {
+	return c.MessageFuncContext(context.Background(), channelID, messageID, load)
+}
+
+// MessageFuncContext is like ChannelFuncContext, but for the message
+// messageID of channel channelID.
+func (c *Cache) MessageFuncContext(ctx context.Context, channelID, messageID string, load func() (*discordgo.Message, error)) (discordgo.Message, error) {
+	return lookupFunc(ctx, c.messages, messageKey(channelID, messageID), load)
+}
+
+// lookupFunc looks up key in o, loading it with load on a miss, and returns
+// the object found by value. Loads are in their own flight, apart from lookups
+// through the provider.
+func lookupFunc[T any](ctx context.Context, o *objectCache[T], key string, load func() (*T, error)) (T, error) {
+	v, _, err := o.lookupFlight(ctx, "load:", key, func(context.Context) (*T, error) { return load() })
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return *v, nil
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLookupFunc(t *testing.T) {
+	p := &ErrorProvider{Err: errors.New("provider called")}
+	c := NewCache(p)
+
+	var calls int
+	load := func() (*discordgo.Channel, error) {
+		calls++
+		return &discordgo.Channel{ID: "1", Name: "From Loader"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		ch, err := c.ChannelFunc("1", load)
+		if err != nil || ch.Name != "From Loader" {
+			t.Errorf("lookup %d: wrong channel from loader: %v", i, err)
+		}
+	}
+	if calls != 1 || p.calls != 0 {
+		t.Errorf("wrong number of calls\nexpect: 1 loader, 0 provider\ngot: %d loader, %d provider", calls, p.calls)
+	}
+
+	// The cached result is served to ordinary lookups
+	if ch, err := c.Channel("1"); err != nil || ch.Name != "From Loader" {
+		t.Error("loaded channel was not cached:", err)
+	}
+
+	// Errors from the loader are handled as from the provider
+	_, err := c.MemberFunc("1", "2", func() (*discordgo.Member, error) {
+		return nil, notFoundError(discordgo.ErrCodeUnknownMember)
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error from loader\nexpect: %v\ngot: %v", ErrNotFound, err)
+	}
+}
+
+func TestLookupFuncFlight(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	c := NewCache(p)
+
+	done := make(chan discordgo.Channel)
+	go func() {
+		ch, _ := c.Channel("1234")
+		done <- ch
+	}()
+	for atomic.LoadInt32(&p.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The loader runs despite the provider lookup in flight, and its result
+	// is not shared with it
+	var calls int
+	ch, err := c.ChannelFunc("1234", func() (*discordgo.Channel, error) {
+		calls++
+		return &discordgo.Channel{ID: "1234", Name: "From Loader"}, nil
+	})
+	if err != nil || ch.Name != "From Loader" || calls != 1 {
+		t.Errorf("loader was not called during provider lookup: %v", err)
+	}
+
+	close(p.release)
+	if ch := <-done; ch.Name != "Testing Channel" {
+		t.Errorf("provider lookup served by loader\nexpect: %s\ngot: %s", "Testing Channel", ch.Name)
+	}
+	if n := atomic.LoadInt32(&p.calls); n != 1 {
+		t.Errorf("wrong number of provider calls\nexpect: 1\ngot: %d", n)
+	}
+}
@@ -0,0 +1,20 @@
+package cache
+
+// A Logger receives structured log events from the cache (see WithLogger).
+// Each event is a message followed by alternating keys and values, in the
+// style of log/slog, such that a *slog.Logger may be used directly.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+// logEvictions logs the removal of ids by Clean.
+func (c *Cache) logEvictions(t ObjectType, ids []string) {
+	if c.logger == nil {
+		return
+	}
+
+	for _, id := range ids {
+		c.logger.Debug("cache: evicted expired entry", "type", t.String(), "id", id)
+	}
+}
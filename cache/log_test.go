@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// RecordingLogger records the message and level of each event logged.
+type RecordingLogger struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *RecordingLogger) Debug(msg string, args ...interface{}) { l.record("debug " + msg) }
+func (l *RecordingLogger) Warn(msg string, args ...interface{})  { l.record("warn " + msg) }
+
+func (l *RecordingLogger) record(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, event)
+}
+
+func TestLogger(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	l := &RecordingLogger{}
+	c := NewCache(MockProvider{}, WithLogger(l), WithTTL(TypeChannel, time.Minute), WithRetry(1, 0))
+	c.Channel("1234")
+	c.Channel("1234")
+	c.Attachment(&discordgo.MessageAttachment{URL: srv.URL})
+
+	e, _ := c.channels.get("1234")
+	e.inserted = e.inserted.Add(-time.Hour)
+	c.Clean()
+
+	expect := []string{
+		"debug cache: fetched from provider",
+		"warn cache: attachment download failed",
+		"debug cache: evicted expired entry",
+	}
+	if len(l.events) != len(expect) {
+		t.Fatalf("wrong events logged\nexpect: %q\ngot: %q", expect, l.events)
+	}
+	for i := range expect {
+		if l.events[i] != expect[i] {
+			t.Errorf("wrong event logged\nexpect: %s\ngot: %s", expect[i], l.events[i])
+		}
+	}
+}
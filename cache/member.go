@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// memberKey returns the cache key for the member userID of guild guildID.
+func memberKey(guildID, userID string) string {
+	return compositeKey{guildID, userID}.String()
+}
+
+// Member looks up and returns the data of the member userID of guild guildID
+// from the discord API, or returns the cached value if already found and not
+// older than the member TTL (see WithTTL). If the member does not exist, an
+// error matching ErrNotFound and wrapping the error from the discord API is
+// returned, while other errors from the discord API are returned as is. Errors
+// are not cached (but see WithNegativeTTL) and failed lookups cause a new API
+// hit, although concurrent lookups of the same member share a single in-flight
+// request. If the provider cannot look up members (see MemberProvider),
+// ErrUnsupported is returned.
+func (c *Cache) Member(guildID, userID string) (discordgo.Member, error) {
+	return c.MemberContext(context.Background(), guildID, userID)
+}
+
+// MemberContext is like Member, but stops waiting for the provider and returns
+// the context's error if ctx is done before the lookup completes.
+func (c *Cache) MemberContext(ctx context.Context, guildID, userID string) (discordgo.Member, error) {
+	v, _, err := c.MemberCachedContext(ctx, guildID, userID)
+	return v, err
+}
+
+// InvalidateMember invalidates the cache entry for the member userID of guild
+// guildID.
+func (c *Cache) InvalidateMember(guildID, userID string) error {
+	return c.members.invalidate(memberKey(guildID, userID))
+}
+
+// InvalidateAllMembers invalidates every cached member of every guild.
+func (c *Cache) InvalidateAllMembers() {
+	c.members.invalidateAll()
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"time"
+	"unsafe"
+)
+
+// entryOverhead is a rough estimate, in bytes, of the memory used to hold
+// each entry of an objectCache besides the object itself: its key, its map
+// slot, its place in the recency order of its shard and the entry itself.
+const entryOverhead = 128
+
+// MemoryUsage is an estimate of the memory held by a Cache, in bytes.
+type MemoryUsage struct {
+	// Attachments is the exact size of the attachment content held in
+	// memory. Attachments backed by disk (see WithAttachmentDir) are not
+	// counted.
+	Attachments int64
+	// Metadata is a rough estimate of the memory held by the channel,
+	// user, guild, member, role, emoji, sticker and message caches and
+	// the negative cache. Each entry is counted as the fixed size of its
+	// object plus a fixed overhead, so memory referenced by the objects,
+	// such as their strings and slices, is not counted. Entries held in a
+	// Store (see WithStore) are not counted.
+	Metadata int64
+}
+
+// Total returns the total estimated memory usage.
+func (u MemoryUsage) Total() int64 {
+	return u.Attachments + u.Metadata
+}
+
+// MemoryUsage returns an estimate of the memory held by the cache. The size of
+// the attachment content is kept as attachments are inserted and evicted, so
+// is read in constant time, while the metadata estimate takes time
+// proportional to the number of shards.
+func (c *Cache) MemoryUsage() MemoryUsage {
+	c.mu.Lock()
+	u := MemoryUsage{Attachments: c.attachmentMemory}
+	c.mu.Unlock()
+
+	u.Metadata = c.channels.memory() + c.users.memory() + c.guilds.memory() +
+		c.members.memory() + c.roles.memory() + c.emojis.memory() + c.stickers.memory() +
+		c.messages.memory() + c.histories.memory() +
+		int64(c.missing.len())*int64(unsafe.Sizeof(time.Time{})+entryOverhead)
+	return u
+}
+
+// memory estimates the memory held by the entries of o (see MemoryUsage).
+func (o *objectCache[T]) memory() int64 {
+	if o.c.store != nil {
+		return 0
+	}
+
+	var zero T
+	return int64(o.len()) * int64(unsafe.Sizeof(zero)+entryOverhead)
+}
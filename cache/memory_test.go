@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(MockProvider{})
+	if u := c.MemoryUsage(); u.Total() != 0 {
+		t.Errorf("wrong usage of empty cache: %+v", u)
+	}
+
+	c.AddAttachment("a", "", "", make([]byte, 1000))
+	c.AddAttachment("b", "", "", make([]byte, 500))
+	c.Channel("1234")
+	u := c.MemoryUsage()
+	if u.Attachments != 1500 {
+		t.Errorf("wrong attachment usage\nexpect: %d\ngot: %d", 1500, u.Attachments)
+	}
+	if expect := int64(unsafe.Sizeof(discordgo.Channel{}) + entryOverhead); u.Metadata != expect {
+		t.Errorf("wrong metadata usage\nexpect: %d\ngot: %d", expect, u.Metadata)
+	}
+
+	// Replacing and evicting attachments is accounted for
+	c.AddAttachment("a", "", "", make([]byte, 200))
+	c.forgetAttachment("b")
+	if u := c.MemoryUsage(); u.Attachments != 200 {
+		t.Errorf("wrong attachment usage after eviction\nexpect: %d\ngot: %d", 200, u.Attachments)
+	}
+	c.InvalidateAll()
+	if u := c.MemoryUsage(); u.Total() != 0 {
+		t.Errorf("wrong usage after invalidation: %+v", u)
+	}
+
+	// Attachments backed by disk are not held in memory
+	c = NewCache(MockProvider{}, WithAttachmentDir(dir))
+	c.AddAttachment("a", "", "", make([]byte, 1000))
+	if u := c.MemoryUsage(); u.Attachments != 0 || c.AttachmentBytes() != 1000 {
+		t.Errorf("wrong usage of disk backed attachment: %+v", u)
+	}
+}
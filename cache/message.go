@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// messageKey returns the cache key for the message messageID of channel
+// channelID.
+func messageKey(channelID, messageID string) string {
+	return compositeKey{channelID, messageID}.String()
+}
+
+// Message looks up and returns the message messageID of channel channelID from
+// the discord API, or returns the cached value if already found and not older
+// than the message TTL (see WithTTL), in the same manner as Member. As messages
+// only change when edited, a long TTL may be set for them, provided edits are
+// kept coherent with HandleMessageUpdate (see RegisterHandlers). If the
+// provider cannot look up messages (see MessageProvider), ErrUnsupported is
+// returned.
+func (c *Cache) Message(channelID, messageID string) (discordgo.Message, error) {
+	return c.MessageContext(context.Background(), channelID, messageID)
+}
+
+// MessageContext is like Message, but stops waiting for the provider and
+// returns the context's error if ctx is done before the lookup completes.
+func (c *Cache) MessageContext(ctx context.Context, channelID, messageID string) (discordgo.Message, error) {
+	v, err := c.messages.lookup(ctx, messageKey(channelID, messageID), func(ctx context.Context) (*discordgo.Message, error) {
+		return fetchMessage(ctx, c.provider, channelID, messageID)
+	})
+	if err != nil {
+		return discordgo.Message{}, err
+	}
+
+	return *v, nil
+}
+
+// InvalidateMessage invalidates the cache entry for the message messageID of
+// channel channelID.
+func (c *Cache) InvalidateMessage(channelID, messageID string) error {
+	return c.messages.invalidate(messageKey(channelID, messageID))
+}
+
+// InvalidateAllMessages invalidates every cached message of every channel.
+func (c *Cache) InvalidateAllMessages() {
+	c.messages.invalidateAll()
+}
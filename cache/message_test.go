@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMessage(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p)
+
+	for i := 0; i < 2; i++ {
+		if m, err := c.Message("1234", "1516"); err != nil || m.Content != "Testing Message" {
+			t.Error("failed to retrieve message:", err)
+		}
+	}
+	if p.calls != 1 {
+		t.Errorf("wrong number of provider calls\nexpect: 1\ngot: %d", p.calls)
+	}
+	if _, err := c.Message("4321", "1516"); !errors.Is(err, ErrMissing) {
+		t.Errorf("wrong error for message of other channel\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+
+	// Edits replace the cached message
+	c.HandleMessageUpdate(&discordgo.MessageUpdate{Message: &discordgo.Message{
+		ID: "1516", ChannelID: "1234", Content: "Edited", Author: &discordgo.User{ID: "5678"},
+	}})
+	if m, _ := c.Message("1234", "1516"); m.Content != "Edited" {
+		t.Errorf("edit did not replace cached message\nexpect: %s\ngot: %s", "Edited", m.Content)
+	}
+
+	// Partial updates invalidate it instead
+	c.HandleMessageUpdate(&discordgo.MessageUpdate{Message: &discordgo.Message{ID: "1516", ChannelID: "1234"}})
+	if _, ok := c.messages.get(messageKey("1234", "1516")); ok {
+		t.Error("partial update did not invalidate cached message")
+	}
+
+	c.Message("1234", "1516")
+	c.HandleMessageDelete(&discordgo.MessageDelete{Message: &discordgo.Message{ID: "1516", ChannelID: "1234"}})
+	if err := c.InvalidateMessage("1234", "1516"); err != ErrMissing {
+		t.Errorf("deleted message was not invalidated\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+	if n := c.Stats().Message.Misses; n != 3 {
+		t.Errorf("wrong message miss count\nexpect: 3\ngot: %d", n)
+	}
+}
@@ -0,0 +1,108 @@
+// Package metrics exposes the statistics of a cache as Prometheus metrics.
+package metrics
+
+import (
+	"github.com/ethanv2/disdup/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	entriesDesc = prometheus.NewDesc(
+		"disdup_cache_entries",
+		"Number of entries currently cached.",
+		[]string{"type"}, nil,
+	)
+	hitsDesc = prometheus.NewDesc(
+		"disdup_cache_hits_total",
+		"Number of lookups served from the cache.",
+		[]string{"type"}, nil,
+	)
+	missesDesc = prometheus.NewDesc(
+		"disdup_cache_misses_total",
+		"Number of lookups which were not served from the cache.",
+		[]string{"type"}, nil,
+	)
+	evictionsDesc = prometheus.NewDesc(
+		"disdup_cache_evictions_total",
+		"Number of entries removed from the cache.",
+		[]string{"type"}, nil,
+	)
+	latencyDesc = prometheus.NewDesc(
+		"disdup_cache_provider_latency_seconds",
+		"Latency of the provider calls made by lookups which missed the cache.",
+		[]string{"type"}, nil,
+	)
+	attachmentBytesDesc = prometheus.NewDesc(
+		"disdup_cache_attachment_bytes",
+		"Total size of the cached attachments in bytes.",
+		nil, nil,
+	)
+	corruptDesc = prometheus.NewDesc(
+		"disdup_cache_corrupt_attachments_total",
+		"Number of cached attachments discarded as their content did not match its checksum.",
+		nil, nil,
+	)
+)
+
+// Collector is a prometheus.Collector reporting the statistics of a cache.
+// Statistics are read afresh from the cache on every scrape, so it is safe to
+// scrape concurrently with use of the cache.
+type Collector struct {
+	cache *cache.Cache
+}
+
+// NewCollector returns a collector for the statistics of c.
+func NewCollector(c *cache.Cache) *Collector {
+	return &Collector{cache: c}
+}
+
+// Describe implements prometheus.Collector.
+func (col *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- entriesDesc
+	ch <- hitsDesc
+	ch <- missesDesc
+	ch <- evictionsDesc
+	ch <- latencyDesc
+	ch <- attachmentBytesDesc
+	ch <- corruptDesc
+}
+
+// Collect implements prometheus.Collector.
+func (col *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := col.cache.Stats()
+	types := []struct {
+		typ   cache.ObjectType
+		stats cache.TypeStats
+	}{
+		{cache.TypeChannel, s.Channel},
+		{cache.TypeUser, s.User},
+		{cache.TypeGuild, s.Guild},
+		{cache.TypeMember, s.Member},
+		{cache.TypeRole, s.Role},
+		{cache.TypeEmoji, s.Emoji},
+		{cache.TypeSticker, s.Sticker},
+		{cache.TypeMessage, s.Message},
+		{cache.TypeHistory, s.History},
+		{cache.TypeAttachment, s.Attachment},
+	}
+
+	for _, t := range types {
+		label := t.typ.String()
+		ch <- prometheus.MustNewConstMetric(entriesDesc, prometheus.GaugeValue, float64(t.stats.Entries), label)
+		ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(t.stats.Hits), label)
+		ch <- prometheus.MustNewConstMetric(missesDesc, prometheus.CounterValue, float64(t.stats.Misses), label)
+		ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(t.stats.Evictions), label)
+
+		// Attachments are downloaded rather than provided
+		if t.typ != cache.TypeAttachment {
+			l := col.cache.ProviderLatency(t.typ)
+			buckets := make(map[float64]uint64, len(l.Buckets))
+			for _, b := range l.Buckets {
+				buckets[b.UpperBound.Seconds()] = b.Count
+			}
+			ch <- prometheus.MustNewConstHistogram(latencyDesc, l.Count, l.Sum.Seconds(), buckets, label)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(attachmentBytesDesc, prometheus.GaugeValue, float64(col.cache.AttachmentBytes()))
+	ch <- prometheus.MustNewConstMetric(corruptDesc, prometheus.CounterValue, float64(s.Attachment.Corrupt))
+}
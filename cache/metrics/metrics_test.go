@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/ethanv2/disdup/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// UserProvider knows about every user and nothing else.
+type UserProvider struct{}
+
+func (UserProvider) User(userID string) (*discordgo.User, error) {
+	return &discordgo.User{ID: userID}, nil
+}
+
+func (UserProvider) Channel(string) (*discordgo.Channel, error)         { return nil, cache.ErrMissing }
+func (UserProvider) Guild(string) (*discordgo.Guild, error)             { return nil, cache.ErrMissing }
+func (UserProvider) GuildMember(_, _ string) (*discordgo.Member, error) { return nil, cache.ErrMissing }
+func (UserProvider) GuildRoles(string) ([]*discordgo.Role, error)       { return nil, cache.ErrMissing }
+func (UserProvider) GuildEmojis(string) ([]*discordgo.Emoji, error)     { return nil, cache.ErrMissing }
+func (UserProvider) GuildChannels(string) ([]*discordgo.Channel, error) { return nil, cache.ErrMissing }
+
+func TestCollector(t *testing.T) {
+	c := cache.NewCache(UserProvider{})
+	c.User("1")
+	c.User("1")
+	c.User("2")
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(NewCollector(c)); err != nil {
+		t.Fatal("Unexpected error from registration:", err)
+	}
+
+	expect := `
+# HELP disdup_cache_hits_total Number of lookups served from the cache.
+# TYPE disdup_cache_hits_total counter
+disdup_cache_hits_total{type="attachment"} 0
+disdup_cache_hits_total{type="channel"} 0
+disdup_cache_hits_total{type="emoji"} 0
+disdup_cache_hits_total{type="guild"} 0
+disdup_cache_hits_total{type="history"} 0
+disdup_cache_hits_total{type="member"} 0
+disdup_cache_hits_total{type="message"} 0
+disdup_cache_hits_total{type="role"} 0
+disdup_cache_hits_total{type="sticker"} 0
+disdup_cache_hits_total{type="user"} 1
+# HELP disdup_cache_entries Number of entries currently cached.
+# TYPE disdup_cache_entries gauge
+disdup_cache_entries{type="attachment"} 0
+disdup_cache_entries{type="channel"} 0
+disdup_cache_entries{type="emoji"} 0
+disdup_cache_entries{type="guild"} 0
+disdup_cache_entries{type="history"} 0
+disdup_cache_entries{type="member"} 0
+disdup_cache_entries{type="message"} 0
+disdup_cache_entries{type="role"} 0
+disdup_cache_entries{type="sticker"} 0
+disdup_cache_entries{type="user"} 2
+`
+	err := testutil.GatherAndCompare(reg, strings.NewReader(expect), "disdup_cache_hits_total", "disdup_cache_entries")
+	if err != nil {
+		t.Error("wrong metrics collected:", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal("Unexpected error from gathering:", err)
+	}
+	calls := make(map[string]uint64)
+	for _, f := range families {
+		if f.GetName() != "disdup_cache_provider_latency_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			calls[m.GetLabel()[0].GetValue()] = m.GetHistogram().GetSampleCount()
+		}
+	}
+	if len(calls) != 9 || calls["user"] != 2 || calls["channel"] != 0 {
+		t.Errorf("wrong provider latency histograms\nexpect: 9 types, 2 user calls\ngot: %v", calls)
+	}
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A MirrorFunc returns the path, relative to the mirror directory, of the file
+// which may hold the content of the attachment at (see WithMirror), or an
+// empty path if the mirror cannot hold it.
+type MirrorFunc func(at *discordgo.MessageAttachment) string
+
+// MirrorByFilename is the default MirrorFunc, finding each attachment in the
+// mirror directory by its filename.
+func MirrorByFilename(at *discordgo.MessageAttachment) string {
+	return filepath.Base(at.Filename)
+}
+
+// readMirror returns the attachment at as read from the mirror directory,
+// and true, if the mirror holds a file for it. A file whose size differs from
+// that of the attachment, where known, is taken to be another attachment of
+// the same name. Files too large to download (see WithMaxAttachmentSize) or of
+// a type which is not allowed (see WithAllowedTypes) are ignored, as are files
+// which cannot be read.
+func (c *Cache) readMirror(at *discordgo.MessageAttachment) (Attachment, bool) {
+	rel := c.mirrorPath(at)
+	if rel == "" || rel == "." {
+		return Attachment{}, false
+	}
+	// Rooting the path before cleaning it keeps it within the mirror
+	path := filepath.Join(c.mirrorDir, filepath.Clean(string(filepath.Separator)+rel))
+
+	info, err := os.Stat(path)
+	switch {
+	case err != nil, !info.Mode().IsRegular():
+		return Attachment{}, false
+	case at.Size > 0 && info.Size() != int64(at.Size):
+		return Attachment{}, false
+	case c.maxAttachmentSize > 0 && info.Size() > c.maxAttachmentSize:
+		return Attachment{}, false
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, false
+	}
+
+	a := Attachment{Name: at.Filename, Type: at.ContentType, Content: buf}
+	detectType(&a, "")
+	if !c.allowedType(a.Type) {
+		return Attachment{}, false
+	}
+
+	return a, true
+}
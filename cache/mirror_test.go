@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMirror(t *testing.T) {
+	var downloads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		w.Write([]byte("from cdn"))
+	}))
+	defer srv.Close()
+
+	mirror := t.TempDir()
+	os.WriteFile(filepath.Join(mirror, "a.txt"), []byte("from mirror"), 0o644)
+	os.WriteFile(filepath.Join(mirror, "b.txt"), []byte("other attachment"), 0o644)
+	c := NewCache(MockProvider{}, WithMirror(mirror, nil))
+
+	cases := []struct {
+		Name   string
+		At     *discordgo.MessageAttachment
+		Expect string
+	}{
+		{"Mirrored", &discordgo.MessageAttachment{URL: srv.URL + "/1/a.txt", Filename: "a.txt", Size: 11}, "from mirror"},
+		{"SizeMismatch", &discordgo.MessageAttachment{URL: srv.URL + "/2/b.txt", Filename: "b.txt", Size: 5}, "from cdn"},
+		{"Missing", &discordgo.MessageAttachment{URL: srv.URL + "/3/c.txt", Filename: "c.txt"}, "from cdn"},
+		{"Traversal", &discordgo.MessageAttachment{URL: srv.URL + "/4/passwd", Filename: "../../etc/passwd"}, "from cdn"},
+	}
+	for _, tc := range cases {
+		a, err := c.Attachment(tc.At)
+		if err != nil || string(a.Content) != tc.Expect {
+			t.Errorf("%s: wrong content\nexpect: %q\ngot: %q (%v)", tc.Name, tc.Expect, a.Content, err)
+		}
+	}
+	if downloads != 3 {
+		t.Errorf("wrong number of downloads\nexpect: 3\ngot: %d", downloads)
+	}
+
+	// Mirrored attachments are cached like downloads, and the mirror is
+	// left alone on eviction
+	if a, _ := c.Attachment(cases[0].At); string(a.Content) != "from mirror" || a.Type != "text/plain; charset=utf-8" {
+		t.Errorf("mirrored attachment not cached: %+v", a)
+	}
+	c.InvalidateAllAttachments()
+	if _, err := os.Stat(filepath.Join(mirror, "a.txt")); err != nil {
+		t.Error("mirrored file removed on eviction:", err)
+	}
+
+	// Callers may choose how files are matched
+	c = NewCache(MockProvider{}, WithMirror(mirror, func(at *discordgo.MessageAttachment) string {
+		return "b.txt"
+	}))
+	if a, _ := c.Attachment(cases[2].At); string(a.Content) != "other attachment" {
+		t.Errorf("wrong content with custom mirror func\nexpect: %q\ngot: %q", "other attachment", a.Content)
+	}
+}
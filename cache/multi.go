@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// MultiProvider is a Provider which tries each of an ordered list of providers
+// in turn, returning the first successful result. This allows, for example,
+// the session of one shard to fall back to the sessions of other shards for
+// objects it does not know about. Only failures showing that a provider does
+// not know the object fall back to the next provider, so an error such as a
+// rate limit or a lack of access is returned as is.
+type MultiProvider []Provider
+
+// NewMultiProvider returns a provider which tries each of providers in order.
+// If no providers are given, NewMultiProvider panics with ErrNilProvider.
+func NewMultiProvider(providers ...Provider) MultiProvider {
+	if len(providers) == 0 {
+		panic(ErrNilProvider)
+	}
+
+	return MultiProvider(providers)
+}
+
+// A ProviderError is returned by a MultiProvider if no provider knew the
+// object, holding the error from each provider in order. It is classified as
+// ErrorNotFound (see ClassifyError) only if every provider reported that the
+// object does not exist.
+type ProviderError []error
+
+func (e ProviderError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("cache: all %d providers failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e ProviderError) Unwrap() []error {
+	return e
+}
+
+// Is returns true if the error from any provider matches target, such that
+// errors.Is(err, ErrMissing) reports whether any provider found the object
+// to be missing.
+func (e ProviderError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// class returns the class of e, which is ErrorNotFound only if the error from
+// every provider is, and ErrorOther otherwise.
+func (e ProviderError) class() ErrorClass {
+	if len(e) == 0 {
+		return ErrorOther
+	}
+	for _, err := range e {
+		if ClassifyError(err) != ErrorNotFound {
+			return ErrorOther
+		}
+	}
+
+	return ErrorNotFound
+}
+
+// As finds the first error from a provider, in order, which matches target,
+// as errors.As.
+func (e ProviderError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// first returns the first successful result of fn for each provider of m in
+// order. The next provider is tried only if the call fails because the
+// provider does not know the object (see fallThrough), so any other error, or
+// the cancellation of ctx, is returned at once. If no provider knows the
+// object, a ProviderError is returned.
+func first[T any](ctx context.Context, m MultiProvider, fn func(p Provider) (T, error)) (T, error) {
+	var (
+		zero T
+		errs ProviderError
+	)
+	for _, p := range m {
+		v, err := fn(p)
+		if err == nil {
+			return v, nil
+		}
+		if ctx.Err() != nil || !fallThrough(err) {
+			return zero, err
+		}
+		errs = append(errs, err)
+	}
+
+	return zero, errs
+}
+
+// fallThrough returns true if err, an error from a provider of a
+// MultiProvider, shows only that the provider does not know the object, such
+// that the next provider should be tried: the object does not exist, is
+// missing from a cache or the state tracked by discordgo, or cannot be looked
+// up by the provider at all.
+func fallThrough(err error) bool {
+	return ClassifyError(err) == ErrorNotFound ||
+		errors.Is(err, ErrMissing) ||
+		errors.Is(err, ErrUnsupported) ||
+		errors.Is(err, discordgo.ErrStateNotFound)
+}
+
+func (m MultiProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	return m.ChannelContext(context.Background(), channelID)
+}
+
+func (m MultiProvider) ChannelContext(ctx context.Context, channelID string) (*discordgo.Channel, error) {
+	return first(ctx, m, func(p Provider) (*discordgo.Channel, error) { return fetchChannel(ctx, p, channelID) })
+}
+
+func (m MultiProvider) User(userID string) (*discordgo.User, error) {
+	return m.UserContext(context.Background(), userID)
+}
+
+func (m MultiProvider) UserContext(ctx context.Context, userID string) (*discordgo.User, error) {
+	return first(ctx, m, func(p Provider) (*discordgo.User, error) { return fetchUser(ctx, p, userID) })
+}
+
+func (m MultiProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	return m.GuildContext(context.Background(), guildID)
+}
+
+func (m MultiProvider) GuildContext(ctx context.Context, guildID string) (*discordgo.Guild, error) {
+	return first(ctx, m, func(p Provider) (*discordgo.Guild, error) { return fetchGuild(ctx, p, guildID) })
+}
+
+func (m MultiProvider) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	return m.GuildMemberContext(context.Background(), guildID, userID)
+}
+
+func (m MultiProvider) GuildMemberContext(ctx context.Context, guildID, userID string) (*discordgo.Member, error) {
+	return first(ctx, m, func(p Provider) (*discordgo.Member, error) { return fetchMember(ctx, p, guildID, userID) })
+}
+
+func (m MultiProvider) GuildRoles(guildID string) ([]*discordgo.Role, error) {
+	return m.GuildRolesContext(context.Background(), guildID)
+}
+
+func (m MultiProvider) GuildRolesContext(ctx context.Context, guildID string) ([]*discordgo.Role, error) {
+	return first(ctx, m, func(p Provider) ([]*discordgo.Role, error) { return fetchRoles(ctx, p, guildID) })
+}
+
+func (m MultiProvider) GuildEmojis(guildID string) ([]*discordgo.Emoji, error) {
+	return m.GuildEmojisContext(context.Background(), guildID)
+}
+
+func (m MultiProvider) GuildEmojisContext(ctx context.Context, guildID string) ([]*discordgo.Emoji, error) {
+	return first(ctx, m, func(p Provider) ([]*discordgo.Emoji, error) { return fetchEmojis(ctx, p, guildID) })
+}
+
+func (m MultiProvider) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	return m.GuildChannelsContext(context.Background(), guildID)
+}
+
+func (m MultiProvider) GuildChannelsContext(ctx context.Context, guildID string) ([]*discordgo.Channel, error) {
+	return first(ctx, m, func(p Provider) ([]*discordgo.Channel, error) { return fetchGuildChannels(ctx, p, guildID) })
+}
+
+func (m MultiProvider) Sticker(stickerID string) (*discordgo.Sticker, error) {
+	return m.StickerContext(context.Background(), stickerID)
+}
+
+func (m MultiProvider) StickerContext(ctx context.Context, stickerID string) (*discordgo.Sticker, error) {
+	return first(ctx, m, func(p Provider) (*discordgo.Sticker, error) { return fetchSticker(ctx, p, stickerID) })
+}
+
+func (m MultiProvider) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	return m.ChannelMessageContext(context.Background(), channelID, messageID)
+}
+
+func (m MultiProvider) ChannelMessageContext(ctx context.Context, channelID, messageID string) (*discordgo.Message, error) {
+	return first(ctx, m, func(p Provider) (*discordgo.Message, error) { return fetchMessage(ctx, p, channelID, messageID) })
+}
+
+func (m MultiProvider) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	return m.ChannelMessagesContext(context.Background(), channelID, limit, beforeID, afterID, aroundID)
+}
+
+func (m MultiProvider) ChannelMessagesContext(ctx context.Context, channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	return first(ctx, m, func(p Provider) ([]*discordgo.Message, error) {
+		return fetchChannelMessages(ctx, p, channelID, limit, beforeID, afterID, aroundID)
+	})
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMultiProvider(t *testing.T) {
+	missing := &ErrorProvider{Err: ErrMissing}
+	notFound := &ErrorProvider{Err: notFoundError(discordgo.ErrCodeUnknownChannel)}
+	c := NewCache(NewMultiProvider(missing, notFound, MockProvider{}))
+
+	if ch, err := c.Channel("1234"); err != nil || ch.Name != "Testing Channel" {
+		t.Error("failed to fall back to last provider:", err)
+	}
+	if missing.calls != 1 || notFound.calls != 1 {
+		t.Errorf("wrong number of provider calls\nexpect: 1, 1\ngot: %d, %d", missing.calls, notFound.calls)
+	}
+
+	// Other errors are returned without trying the next provider
+	failing := &ErrorProvider{Err: errBroken}
+	last := &ErrorProvider{Err: ErrMissing}
+	_, err := NewMultiProvider(missing, failing, last).Channel("1234")
+	var perr ProviderError
+	if !errors.Is(err, errBroken) || errors.As(err, &perr) {
+		t.Errorf("wrong error from failing provider\nexpect: %v\ngot: %v", errBroken, err)
+	}
+	if last.calls != 0 {
+		t.Errorf("provider after failure was called\nexpect: 0\ngot: %d", last.calls)
+	}
+
+	// As is cancellation of the lookup
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewMultiProvider(missing, last).ChannelContext(ctx, "1234"); !errors.Is(err, ErrMissing) || errors.As(err, &perr) {
+		t.Errorf("wrong error from cancelled lookup\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+	if last.calls != 0 {
+		t.Errorf("provider after cancellation was called\nexpect: 0\ngot: %d", last.calls)
+	}
+
+	_, err = NewMultiProvider(missing, notFound, last).Channel("1234")
+	if !errors.As(err, &perr) || len(perr) != 3 {
+		t.Fatalf("wrong error when no provider knows object: %v", err)
+	}
+	if !errors.Is(err, ErrMissing) {
+		t.Error("provider errors were not aggregated:", err)
+	}
+	var rerr *discordgo.RESTError
+	if !errors.As(ProviderError{errBroken, notFoundError(10003)}, &rerr) {
+		t.Error("provider errors were not matched by errors.As")
+	}
+}
+
+func TestProviderErrorClass(t *testing.T) {
+	unavailable := &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}
+	cases := []struct {
+		Name   string
+		Err    ProviderError
+		Expect ErrorClass
+	}{
+		{"AllNotFound", ProviderError{notFoundError(10003), notFoundError(10003)}, ErrorNotFound},
+		{"NotFoundAndUnavailable", ProviderError{notFoundError(10003), unavailable}, ErrorOther},
+		{"NotFoundAndMissing", ProviderError{notFoundError(10003), ErrMissing}, ErrorOther},
+		{"Empty", ProviderError{}, ErrorOther},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if class := ClassifyError(tc.Err); class != tc.Expect {
+				t.Errorf("wrong class\nexpect: %v\ngot: %v", tc.Expect, class)
+			}
+		})
+	}
+
+	// Only objects no provider has are negatively cached
+	notFound := &ErrorProvider{Err: notFoundError(discordgo.ErrCodeUnknownChannel)}
+	missing := &ErrorProvider{Err: ErrMissing}
+	c := NewCache(NewMultiProvider(missing, notFound))
+	if _, err := c.Channel("1234"); errors.Is(err, ErrNotFound) {
+		t.Errorf("object missing from a provider was not found\nexpect: not %v\ngot: %v", ErrNotFound, err)
+	}
+	c = NewCache(NewMultiProvider(notFound, notFound))
+	if _, err := c.Channel("1234"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error when every provider finds no object\nexpect: %v\ngot: %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// nameGroup returns the group under which the user with username name is
+// indexed (see WithUserNameIndex). Usernames are matched regardless of case.
+func nameGroup(name string) string {
+	return strings.ToLower(name)
+}
+
+// splitUserName splits name, a username optionally followed by "#" and a
+// legacy discriminator, into the username and the discriminator, which is
+// empty if name has none.
+func splitUserName(name string) (username, discriminator string) {
+	i := strings.LastIndexByte(name, '#')
+	if i < 0 || len(name)-i != 5 {
+		return name, ""
+	}
+	for _, r := range name[i+1:] {
+		if r < '0' || r > '9' {
+			return name, ""
+		}
+	}
+
+	return name[:i], name[i+1:]
+}
+
+// UsersByName returns every cached user named name, most recently cached
+// first, without calling the provider. Names are matched regardless of case,
+// and may carry a legacy discriminator, such as "name#1234", to match only the
+// user with that discriminator. Users which have outlived their TTL are not
+// returned. The cache must be configured with WithUserNameIndex, as otherwise
+// no user is ever found, and as the index holds only the users inserted by
+// this cache, users inserted by other caches sharing a Store (see WithStore)
+// are not found either.
+func (c *Cache) UsersByName(name string) []discordgo.User {
+	if c.users.groups == nil {
+		return nil
+	}
+
+	username, discriminator := splitUserName(name)
+	var users []discordgo.User
+	for _, key := range c.users.groups.members(nameGroup(username)) {
+		e, ok := c.users.peek(key)
+		if !ok || e.expired(c.now(), c.users.ttl) {
+			continue
+		}
+		if discriminator != "" && e.val.Discriminator != discriminator {
+			continue
+		}
+		users = append(users, *e.val)
+	}
+
+	return users
+}
+
+// UserByName is like UsersByName, but returns only the most recently cached
+// user named name, as usernames were not unique before Discord retired
+// discriminators. If no cached user is named name, ErrMissing is returned.
+func (c *Cache) UserByName(name string) (discordgo.User, error) {
+	users := c.UsersByName(name)
+	if len(users) == 0 {
+		return discordgo.User{}, ErrMissing
+	}
+
+	return users[0], nil
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestUserByName(t *testing.T) {
+	clock := NewFakeClock()
+	c := NewCache(MockProvider{}, WithUserNameIndex(), WithClock(clock), WithTTL(TypeUser, time.Hour))
+
+	// Users looked up by ID are indexed by name
+	if _, err := c.User("5678"); err != nil {
+		t.Fatal("Unexpected error from user retrieval:", err)
+	}
+	if u, err := c.UserByName("testing user"); err != nil || u.ID != "5678" {
+		t.Error("failed to find user by name:", u.ID, err)
+	}
+
+	// Duplicate names are returned most recently cached first
+	c.SeedUsers([]*discordgo.User{
+		{ID: "1", Username: "Dup", Discriminator: "0001"},
+		{ID: "2", Username: "dup", Discriminator: "0002"},
+	})
+	users := c.UsersByName("DUP")
+	if len(users) != 2 || users[0].ID != "2" || users[1].ID != "1" {
+		t.Errorf("wrong users found by duplicate name\nexpect: [2 1]\ngot: %v", users)
+	}
+	if u, err := c.UserByName("dup#0001"); err != nil || u.ID != "1" {
+		t.Errorf("wrong user found by name and discriminator\nexpect: 1\ngot: %s (%v)", u.ID, err)
+	}
+	if _, err := c.UserByName("dup#0003"); !errors.Is(err, ErrMissing) {
+		t.Errorf("wrong error for unknown discriminator\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+
+	// Renamed and evicted users are no longer found under their old name
+	c.HandleUserUpdate(&discordgo.UserUpdate{User: &discordgo.User{ID: "2", Username: "renamed"}})
+	if u, err := c.UserByName("dup"); err != nil || u.ID != "1" {
+		t.Errorf("renamed user still found by old name\nexpect: 1\ngot: %s (%v)", u.ID, err)
+	}
+	if u, err := c.UserByName("renamed"); err != nil || u.ID != "2" {
+		t.Error("renamed user not found by new name:", u.ID, err)
+	}
+	c.InvalidateUser("1")
+	if _, err := c.UserByName("dup"); !errors.Is(err, ErrMissing) {
+		t.Errorf("wrong error for evicted user\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+
+	// Expired users are not found
+	clock.Advance(2 * time.Hour)
+	if _, err := c.UserByName("renamed"); !errors.Is(err, ErrMissing) {
+		t.Errorf("wrong error for expired user\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+
+	// Without the index, no user is found
+	c = NewCache(MockProvider{})
+	c.User("5678")
+	if users := c.UsersByName("testing user"); users != nil {
+		t.Errorf("users found without index\nexpect: []\ngot: %v", users)
+	}
+}
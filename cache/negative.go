@@ -0,0 +1,43 @@
+package cache
+
+import "time"
+
+// isNotFound returns true if err is a Discord API error showing that the
+// object looked up genuinely does not exist, as opposed to a transient
+// failure.
+func isNotFound(err error) bool {
+	return ClassifyError(err) == ErrorNotFound
+}
+
+// knownMissing returns true if the object with the flight key key was found
+// not to exist within the negative caching window, or was deleted within the
+// tombstone window (see WithTombstoneTTL).
+func (c *Cache) knownMissing(key string) bool {
+	t, ok := c.missing.get(key)
+	return ok && !c.now().After(*t)
+}
+
+// markMissing records that the object with the flight key key is known not to
+// exist for ttl, unless it is already known not to exist for longer.
+func (c *Cache) markMissing(key string, ttl time.Duration) {
+	until := c.now().Add(ttl)
+	if t, ok := c.missing.get(key); ok && t.After(until) {
+		return
+	}
+	c.missing.set(key, &until)
+}
+
+// noteLookup records the result of a provider lookup for the object with the
+// flight key key for negative caching. Only errors showing that the object
+// does not exist are recorded.
+func (c *Cache) noteLookup(key string, err error) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	if err == nil {
+		c.missing.delete(key)
+	} else if isNotFound(err) {
+		c.markMissing(key, c.negativeTTL)
+	}
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ErrorProvider fails every lookup with Err, counting calls.
+type ErrorProvider struct {
+	Err   error
+	calls int
+}
+
+func (p *ErrorProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	p.calls++
+	return nil, p.Err
+}
+
+func (p *ErrorProvider) User(userID string) (*discordgo.User, error) {
+	p.calls++
+	return nil, p.Err
+}
+
+func (p *ErrorProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	p.calls++
+	return nil, p.Err
+}
+
+func (p *ErrorProvider) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	p.calls++
+	return nil, p.Err
+}
+
+func (p *ErrorProvider) GuildRoles(guildID string) ([]*discordgo.Role, error) {
+	p.calls++
+	return nil, p.Err
+}
+
+func (p *ErrorProvider) GuildEmojis(guildID string) ([]*discordgo.Emoji, error) {
+	p.calls++
+	return nil, p.Err
+}
+
+func (p *ErrorProvider) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	p.calls++
+	return nil, p.Err
+}
+
+// notFoundError returns a discordgo error as returned for an unknown object.
+func notFoundError(code int) error {
+	return &discordgo.RESTError{
+		Response: &http.Response{StatusCode: http.StatusNotFound},
+		Message:  &discordgo.APIErrorMessage{Code: code, Message: "Unknown"},
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Err         error
+		NegativeTTL time.Duration
+		ExpectCalls int
+	}{
+		{"NotFound", notFoundError(discordgo.ErrCodeUnknownUser), time.Minute, 1},
+		{"StatusOnly", &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusNotFound}}, time.Minute, 1},
+		{"Transient", &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusBadGateway}}, time.Minute, 3},
+		{"Network", errors.New("connection reset"), time.Minute, 3},
+		{"Disabled", notFoundError(discordgo.ErrCodeUnknownUser), 0, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			p := &ErrorProvider{Err: tc.Err}
+			c := NewCache(p, WithNegativeTTL(tc.NegativeTTL))
+
+			for i := 0; i < 3; i++ {
+				if _, err := c.User("1234"); err == nil {
+					t.Fatal("unexpected success from failing provider")
+				}
+			}
+			if p.calls != tc.ExpectCalls {
+				t.Errorf("wrong number of provider calls\nexpect: %d\ngot: %d", tc.ExpectCalls, p.calls)
+			}
+		})
+	}
+}
+
+func TestNegativeCacheExpiry(t *testing.T) {
+	p := &ErrorProvider{Err: notFoundError(discordgo.ErrCodeUnknownChannel)}
+	c := NewCache(p, WithNegativeTTL(time.Minute))
+
+	c.Channel("1234")
+	if _, err := c.Channel("1234"); !errors.Is(err, ErrMissing) {
+		t.Errorf("wrong error within negative window\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+
+	when, _ := c.missing.get("channel:1234")
+	*when = when.Add(-2 * time.Minute)
+	c.Channel("1234")
+	if p.calls != 2 {
+		t.Errorf("wrong number of provider calls after expiry\nexpect: 2\ngot: %d", p.calls)
+	}
+
+	when, _ = c.missing.get("channel:1234")
+	*when = when.Add(-2 * time.Minute)
+	c.Clean()
+	if c.missing.len() != 0 {
+		t.Error("expired negative entry was not swept by Clean")
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Err    error
+		Expect bool
+	}{
+		{"NotFound", notFoundError(discordgo.ErrCodeUnknownChannel), true},
+		{"StatusOnly", &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusNotFound}}, true},
+		{"Transient", &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusBadGateway}}, false},
+		{"Network", errors.New("connection reset"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := NewCache(&ErrorProvider{Err: tc.Err}, WithNegativeTTL(time.Minute))
+
+			_, err := c.Channel("1234")
+			if errors.Is(err, ErrNotFound) != tc.Expect {
+				t.Errorf("wrong error classification\nexpect not found: %t\ngot: %v", tc.Expect, err)
+			}
+			if !errors.Is(err, tc.Err) {
+				t.Error("original error was not wrapped:", err)
+			}
+
+			// Negatively cached lookups are also not found
+			if _, err := c.Channel("1234"); tc.Expect && !errors.Is(err, ErrNotFound) {
+				t.Errorf("wrong error within negative window\nexpect: %v\ngot: %v", ErrNotFound, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// objectCache is the cache of objects of a single type fetched from the
+// provider, handling the hit, miss and insert logic common to every type. Its
+// table is embedded, so entries may also be manipulated directly.
+type objectCache[T any] struct {
+	table[entry[T]]
+
+	c   *Cache
+	typ ObjectType
+	// Whether the cache is disabled (see WithDisabledTypes), such that
+	// lookups always call the provider and nothing is inserted.
+	disabled bool
+	// Prefix of the key of each object in the table's Store, the flight
+	// group and the negative cache.
+	prefix string
+	ttl    time.Duration
+
+	// groupOf returns the group of each entry to index it by, such as the
+	// guild of a channel, or is nil if entries are not indexed.
+	groupOf func(key string, val *T) string
+	groups  *groupIndex
+	// Maximum number of entries of each group, or zero if unbounded.
+	groupMax int
+	// trim, if set, strips each object of what need not be cached before
+	// it is inserted (see WithMaxGuildBytes).
+	trim func(val *T)
+	// insertMu, if set, is held while inserting each object fetched by a
+	// lookup, such that the insertion is ordered against other writers
+	// holding it (see updateHistory).
+	insertMu sync.Locker
+}
+
+// newObjectCache returns the cache of objects of type typ, keyed under prefix,
+// whose entries expire after ttl and are bounded by limit.
+func newObjectCache[T any](c *Cache, typ ObjectType, prefix string, ttl time.Duration, limit int) *objectCache[T] {
+	o := &objectCache[T]{c: c, typ: typ, prefix: prefix, ttl: ttl, disabled: c.disabled[typ]}
+	if c.store != nil {
+		o.table = storeTable[entry[T]]{store: c.store, prefix: prefix + ":"}
+	} else {
+		o.table = newShardMap[entry[T]](c.shards, limit)
+	}
+	if c.deterministic {
+		o.table = sortedTable[entry[T]]{o.table}
+	}
+
+	return o
+}
+
+// lookup returns the cached object under key if present and unexpired.
+// Otherwise, the object is fetched with load, shared with any concurrent
+// lookups of the same key, and inserted on success. The context given to load
+// is cancelled only once every lookup sharing the call has given up. Errors
+// from load showing that the object does not exist are wrapped as ErrNotFound.
+// If key is known not to exist (see WithNegativeTTL), an error matching both
+// ErrNotFound and ErrMissing is returned without calling load.
+func (o *objectCache[T]) lookup(ctx context.Context, key string, load func(ctx context.Context) (*T, error)) (*T, error) {
+	v, _, err := o.lookupCached(ctx, key, load)
+	return v, err
+}
+
+// lookupCached is like lookup, but also returns whether the lookup was served
+// from the cache, including by the negative cache, rather than by load.
+func (o *objectCache[T]) lookupCached(ctx context.Context, key string, load func(ctx context.Context) (*T, error)) (*T, bool, error) {
+	return o.lookupFlight(ctx, "", key, load)
+}
+
+// lookupFlight is like lookupCached, but the call to load is shared only with
+// concurrent lookups of key in the same flight, such that lookups with their
+// own load, such as by ChannelFunc, are never served by the load of another.
+// Lookups of the provider are in the empty flight.
+func (o *objectCache[T]) lookupFlight(ctx context.Context, flight, key string, load func(ctx context.Context) (*T, error)) (*T, bool, error) {
+	if o.c.closed.Load() {
+		return nil, false, ErrClosed
+	}
+	if o.disabled {
+		return o.lookupDisabled(ctx, key, load)
+	}
+
+	if e, ok := o.get(key); ok && !e.expired(o.c.now(), o.ttl) {
+		if o.groupMax > 0 {
+			o.groups.touch(key)
+		}
+		o.c.noteHit(o.typ, key)
+		return e.val, true, nil
+	}
+
+	fkey := o.prefix + ":" + key
+	if o.c.knownMissing(fkey) {
+		o.c.noteHit(o.typ, key)
+		return nil, true, wrapError{ErrNotFound, ErrMissing}
+	}
+	o.c.noteMiss(o.typ, key)
+
+	ctx, span := startSpan(ctx, o.typ, key)
+	v, err := o.c.doContext(ctx, flight+fkey, func(ctx context.Context) (interface{}, error) {
+		start := o.c.now()
+		val, err := load(ctx)
+		elapsed := o.c.since(start)
+		o.c.statsFor(o.typ).latency.observe(elapsed)
+		if o.c.logger != nil {
+			o.c.logger.Debug("cache: fetched from provider", "type", o.typ.String(), "id", key,
+				"latency", elapsed, "error", err)
+		}
+		o.c.noteLookup(fkey, err)
+		if isNotFound(err) {
+			return nil, wrapError{ErrNotFound, err}
+		} else if err != nil {
+			return nil, err
+		}
+
+		e := o.newEntry(val)
+		if o.insertMu != nil {
+			o.insertMu.Lock()
+			defer o.insertMu.Unlock()
+		}
+		o.insert(key, e)
+		return e.val, nil
+	})
+	endSpan(span, err)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return v.(*T), false, nil
+}
+
+// lookupDisabled is lookupCached for a disabled cache, calling load with ctx
+// for every lookup without sharing the call with concurrent lookups or
+// negative caching. If ctx is done before load completes, ctx.Err() is
+// returned and load is left to complete in the background.
+func (o *objectCache[T]) lookupDisabled(ctx context.Context, key string, load func(ctx context.Context) (*T, error)) (*T, bool, error) {
+	o.c.noteMiss(o.typ, key)
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	type result struct {
+		val *T
+		err error
+	}
+	done := make(chan result, 1)
+	ctx, span := startSpan(ctx, o.typ, key)
+	go func() {
+		start := o.c.now()
+		val, err := load(ctx)
+		o.c.statsFor(o.typ).latency.observe(o.c.since(start))
+		if isNotFound(err) {
+			err = wrapError{ErrNotFound, err}
+		}
+		done <- result{val, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	endSpan(span, res.err)
+	if res.err != nil {
+		return nil, false, res.err
+	}
+
+	return res.val, false, nil
+}
+
+// refresh fetches the object under key with load regardless of whether it is
+// cached, shared only with concurrent refreshes of the same key, and replaces
+// any cached entry on success. On failure the cached entry is left in place,
+// and errors from load are wrapped as by lookup.
+func (o *objectCache[T]) refresh(ctx context.Context, key string, load func(ctx context.Context) (*T, error)) (*T, error) {
+	fkey := o.prefix + ":" + key
+	ctx, span := startSpan(ctx, o.typ, key)
+	v, err := o.c.doContext(ctx, "refresh:"+fkey, func(ctx context.Context) (interface{}, error) {
+		val, err := load(ctx)
+		if isNotFound(err) {
+			return nil, wrapError{ErrNotFound, err}
+		} else if err != nil {
+			return nil, err
+		}
+
+		o.replace(key, val)
+		return val, nil
+	})
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*T), nil
+}
+
+// newEntry returns an entry for a copy of val inserted now, with a random
+// jitter of its TTL if configured (see WithTTLJitter).
+func (o *objectCache[T]) newEntry(val *T) *entry[T] {
+	e := newEntry(val, o.c.now())
+	if o.c.ttlJitter > 0 {
+		e.jitter = (2*rand.Float64() - 1) * o.c.ttlJitter
+	}
+
+	return e
+}
+
+// indexBy indexes the entries of o by the group returned by groupOf, such that
+// they can be found with groups.members and removed by invalidateGroup. Only
+// entries inserted by o are indexed, so entries inserted by other caches
+// sharing a Store are not. If limit is greater than zero, each group is
+// bounded to limit entries by evicting its least recently used entries.
+func (o *objectCache[T]) indexBy(groupOf func(key string, val *T) string, limit int) {
+	o.groupOf = groupOf
+	o.groups = newGroupIndex()
+	o.groupMax = limit
+}
+
+// insert stores e under key, noting the insertion and any evictions. The
+// value of e is trimmed in place if o trims its objects, so must not be shared.
+// Nothing is stored if the cache is disabled.
+func (o *objectCache[T]) insert(key string, e *entry[T]) {
+	if o.disabled {
+		return
+	}
+	if o.trim != nil {
+		o.trim(e.val)
+	}
+	evicted := o.set(key, e)
+	if o.groups != nil {
+		o.groups.remove(evicted...)
+		group := o.groupOf(key, e.val)
+		o.groups.add(group, key)
+		if o.groupMax > 0 && group != "" {
+			for _, k := range o.groups.overflow(group, o.groupMax) {
+				if o.delete(k) {
+					evicted = append(evicted, k)
+				}
+			}
+		}
+	}
+	o.c.noteInsert(o.typ, key, evicted)
+}
+
+// evicted notes the removal of keys.
+func (o *objectCache[T]) evicted(keys ...string) {
+	if o.groups != nil {
+		o.groups.remove(keys...)
+	}
+	o.c.noteEvict(o.typ, keys...)
+}
+
+// replace stores val under key as a fresh entry, forgetting any record of key
+// being missing.
+func (o *objectCache[T]) replace(key string, val *T) {
+	o.replaceWithTTL(key, val, 0)
+}
+
+// replaceWithTTL is like replace, but the entry expires after ttl rather than
+// the TTL of the cache. A zero ttl uses the TTL of the cache.
+func (o *objectCache[T]) replaceWithTTL(key string, val *T, ttl time.Duration) {
+	e := o.newEntry(val)
+	e.ttl = ttl
+
+	o.c.missing.delete(o.prefix + ":" + key)
+	o.insert(key, e)
+}
+
+// tombstone removes key, as its object has been deleted, and if tombstones are
+// enabled (see WithTombstoneTTL), records that it does not exist so that it is
+// not looked up again within the tombstone window.
+func (o *objectCache[T]) tombstone(key string) {
+	o.invalidate(key)
+	if o.c.tombstoneTTL > 0 {
+		o.c.markMissing(o.prefix+":"+key, o.c.tombstoneTTL)
+	}
+}
+
+// has returns true if key is cached and unexpired, without recording a use.
+func (o *objectCache[T]) has(key string) bool {
+	e, ok := o.peek(key)
+	return ok && !e.expired(o.c.now(), o.ttl)
+}
+
+// invalidate removes key, returning ErrMissing if it was not cached.
+func (o *objectCache[T]) invalidate(key string) error {
+	if !o.delete(key) {
+		return ErrMissing
+	}
+	o.evicted(key)
+
+	return nil
+}
+
+// invalidateGroup removes every entry of group (see indexBy), returning the
+// number removed.
+func (o *objectCache[T]) invalidateGroup(group string) int {
+	var removed []string
+	for _, key := range o.groups.members(group) {
+		if o.delete(key) {
+			removed = append(removed, key)
+		}
+	}
+	o.evicted(removed...)
+
+	return len(removed)
+}
+
+// invalidateFunc removes every entry for which pred returns true, returning
+// the number removed.
+func (o *objectCache[T]) invalidateFunc(pred func(val T) bool) int {
+	removed := o.deleteFunc(func(_ string, e *entry[T]) bool {
+		return pred(*e.val)
+	})
+	o.evicted(removed...)
+
+	return len(removed)
+}
+
+// invalidateOlderThan removes every entry inserted longer than d ago, returning
+// the number removed.
+func (o *objectCache[T]) invalidateOlderThan(d time.Duration) int {
+	now := o.c.now()
+	removed := o.deleteFunc(func(_ string, e *entry[T]) bool {
+		return now.Sub(e.inserted) > d
+	})
+	o.evicted(removed...)
+
+	return len(removed)
+}
+
+// invalidateAll removes every entry.
+func (o *objectCache[T]) invalidateAll() {
+	o.evicted(o.clear()...)
+}
+
+// clean removes every expired entry.
+func (o *objectCache[T]) clean() {
+	evicted := o.deleteFunc(func(_ string, e *entry[T]) bool {
+		return e.expired(o.c.now(), o.ttl)
+	})
+	o.evicted(evicted...)
+	o.c.logEvictions(o.typ, evicted)
+}
+
+// rangeAll snapshots the unexpired entries, then calls fn for each one until
+// fn returns false.
+func (o *objectCache[T]) rangeAll(fn func(key string, val T) bool) {
+	type item struct {
+		key string
+		val *T
+	}
+
+	var items []item
+	o.walk(func(key string, e *entry[T]) bool {
+		if !e.expired(o.c.now(), o.ttl) {
+			items = append(items, item{key, e.val})
+		}
+		return true
+	})
+
+	for _, it := range items {
+		if !fn(it.key, *it.val) {
+			return
+		}
+	}
+}
+
+// copyTo inserts a copy of every entry of o into dst, sharing their values,
+// without noting the insertions.
+func (o *objectCache[T]) copyTo(dst *objectCache[T]) {
+	o.walk(func(key string, e *entry[T]) bool {
+		cp := *e
+		dst.set(key, &cp)
+		if dst.groups != nil {
+			dst.groups.add(dst.groupOf(key, cp.val), key)
+		}
+		return true
+	})
+}
+
+// save encodes every entry, skipping any which cannot be encoded.
+func (o *objectCache[T]) save() map[string]json.RawMessage {
+	m := make(map[string]json.RawMessage)
+	o.walk(func(key string, e *entry[T]) bool {
+		if buf, err := json.Marshal(e); err == nil {
+			m[key] = buf
+		}
+		return true
+	})
+
+	return m
+}
+
+// load decodes and merges the entries of m, skipping any which cannot be
+// decoded or have expired, and keeping existing entries which are newer.
+func (o *objectCache[T]) load(m map[string]json.RawMessage) {
+	for key, buf := range m {
+		e := new(entry[T])
+		if err := json.Unmarshal(buf, e); err != nil || e.expired(o.c.now(), o.ttl) {
+			continue
+		}
+		if old, ok := o.get(key); ok && !old.inserted.Before(e.inserted) {
+			continue
+		}
+
+		o.insert(key, e)
+	}
+}
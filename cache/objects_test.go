@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestObjectCache(t *testing.T) {
+	c := NewCache(MockProvider{}, WithNegativeTTL(time.Minute))
+	o := newObjectCache[string](c, TypeChannel, "test", time.Minute, 0)
+
+	calls := 0
+	load := func(val string, err error) func(context.Context) (*string, error) {
+		return func(context.Context) (*string, error) {
+			calls++
+			if err != nil {
+				return nil, err
+			}
+			return &val, nil
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := o.lookup(context.Background(), "a", load("first", nil))
+		if err != nil || *v != "first" {
+			t.Fatalf("wrong lookup result\nexpect: first\ngot: %v (%v)", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("hit called the loader\nexpect calls: 1\ngot: %d", calls)
+	}
+
+	// Expired entries are loaded again
+	o.set("a", &entry[string]{val: new(string), inserted: time.Now().Add(-time.Hour)})
+	if v, _ := o.lookup(context.Background(), "a", load("second", nil)); *v != "second" {
+		t.Error("expired entry was not loaded again")
+	}
+
+	// Not found errors are negatively cached under the prefixed key
+	for i := 0; i < 2; i++ {
+		if _, err := o.lookup(context.Background(), "b", load("", notFoundError(0))); err == nil {
+			t.Error("expected error from failed load")
+		}
+	}
+	if calls != 3 {
+		t.Errorf("wrong number of loader calls\nexpect: 3\ngot: %d", calls)
+	}
+	if !c.knownMissing("test:b") {
+		t.Error("failed load was not negatively cached under prefixed key")
+	}
+
+	if err := o.invalidate("a"); err != nil || o.has("a") {
+		t.Error("failed to invalidate entry:", err)
+	}
+	if err := o.invalidate("a"); err != ErrMissing {
+		t.Error("expected ErrMissing invalidating missing entry, got:", err)
+	}
+}
+
+func TestInvalidateFunc(t *testing.T) {
+	c := NewCache(MockProvider{})
+	c.SeedChannels([]*discordgo.Channel{
+		{ID: "1", GuildID: "left"},
+		{ID: "2", GuildID: "left"},
+		{ID: "3", GuildID: "kept"},
+	})
+
+	n := c.InvalidateChannelsFunc(func(ch discordgo.Channel) bool {
+		return ch.GuildID == "left"
+	})
+	if n != 2 {
+		t.Errorf("wrong number of channels invalidated\nexpect: 2\ngot: %d", n)
+	}
+	if c.HasChannel("1") || c.HasChannel("2") || !c.HasChannel("3") {
+		t.Error("wrong channels invalidated")
+	}
+	if e := c.Stats().Channel.Evictions; e != 2 {
+		t.Errorf("wrong eviction count\nexpect: 2\ngot: %d", e)
+	}
+}
+
+func TestInvalidateGuildCascade(t *testing.T) {
+	c := NewCache(MockProvider{})
+	c.Guild("9101112")
+	c.Member("9101112", "5678")
+	c.Role("9101112", "1")
+	c.SeedChannels([]*discordgo.Channel{
+		{ID: "1", GuildID: "9101112"},
+		{ID: "2", GuildID: "9101112"},
+		{ID: "3", GuildID: "other"},
+	})
+	c.InvalidateChannel("2")
+
+	if n := c.InvalidateGuildCascade("9101112"); n != 4 {
+		t.Errorf("wrong number of entries invalidated\nexpect: 4\ngot: %d", n)
+	}
+	if c.HasGuild("9101112") || c.HasChannel("1") || !c.HasChannel("3") {
+		t.Error("wrong guilds or channels invalidated")
+	}
+	if _, ok := c.members.get(memberKey("9101112", "5678")); ok {
+		t.Error("member of guild was not invalidated")
+	}
+	if _, ok := c.roles.get("9101112"); ok {
+		t.Error("roles of guild were not invalidated")
+	}
+	if n := len(c.channels.groups.members("9101112")); n != 0 {
+		t.Errorf("index still holds %d channels of invalidated guild", n)
+	}
+}
+
+func TestMaxMembersPerGuild(t *testing.T) {
+	c := NewCache(MockProvider{}, WithMaxMembersPerGuild(2))
+	load := func(context.Context) (*discordgo.Member, error) { return &discordgo.Member{}, nil }
+	lookup := func(guildID, userID string) {
+		if _, err := c.members.lookup(context.Background(), memberKey(guildID, userID), load); err != nil {
+			t.Fatal("Unexpected error from member lookup:", err)
+		}
+	}
+
+	lookup("1", "a")
+	lookup("1", "b")
+	lookup("2", "a")
+	lookup("2", "b")
+	// A hit makes a the most recently used member of guild 1
+	lookup("1", "a")
+	lookup("1", "c")
+
+	for _, key := range []string{"1:a", "1:c", "2:a", "2:b"} {
+		if !c.members.has(key) {
+			t.Errorf("%s: hot member was evicted", key)
+		}
+	}
+	if c.members.has("1:b") {
+		t.Error("least recently used member of full guild was not evicted")
+	}
+	if n := c.Stats().Member.Evictions; n != 1 {
+		t.Errorf("wrong number of evictions\nexpect: 1\ngot: %d", n)
+	}
+	if n := len(c.members.groups.members("1")); n != 2 {
+		t.Errorf("wrong number of indexed members\nexpect: 2\ngot: %d", n)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	clock := NewFakeClock()
+	c := NewCache(MockProvider{}, WithClock(clock), WithTTL(TypeChannel, 100*time.Second), WithTTLJitter(0.5))
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		c.SeedChannels([]*discordgo.Channel{{ID: strconv.Itoa(i)}})
+	}
+	c.SetChannelWithTTL(&discordgo.Channel{ID: "own"}, 200*time.Second)
+
+	cached := func() int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if c.channels.has(strconv.Itoa(i)) {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Entries expire spread out between 50% and 150% of the TTL
+	clock.Advance(49 * time.Second)
+	if got := cached(); got != n {
+		t.Errorf("entries expired before earliest jittered TTL\nexpect: %d\ngot: %d", n, got)
+	}
+	clock.Advance(51 * time.Second)
+	if got := cached(); got == 0 || got == n {
+		t.Errorf("entries did not expire spread out\nexpect: between 0 and %d\ngot: %d", n, got)
+	}
+	clock.Advance(51 * time.Second)
+	if got := cached(); got != 0 {
+		t.Errorf("entries outlived latest jittered TTL\nexpect: 0\ngot: %d", got)
+	}
+
+	// Entries with their own TTL are not jittered
+	if !c.channels.has("own") {
+		t.Error("entry with own TTL expired early")
+	}
+}
+
+func TestDisabledTypes(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p, WithDisabledTypes(TypeChannel, TypeAttachment), WithNegativeTTL(time.Minute))
+
+	for i := 0; i < 2; i++ {
+		if ch, err := c.Channel("1234"); err != nil || ch.Name != "Testing Channel" {
+			t.Error("failed to retrieve channel from disabled cache:", err)
+		}
+		if _, err := c.User("5678"); err != nil {
+			t.Error("Unexpected error from user retrieval:", err)
+		}
+	}
+	if p.calls != 3 {
+		t.Errorf("wrong number of provider calls\nexpect: 3\ngot: %d", p.calls)
+	}
+
+	// Disabled caches neither cache nor negatively cache anything
+	c.SeedChannels([]*discordgo.Channel{{ID: "1"}})
+	if n := c.ChannelLen(); n != 0 {
+		t.Errorf("disabled cache held entries\nexpect: 0\ngot: %d", n)
+	}
+	nc := NewCache(&ErrorProvider{Err: notFoundError(discordgo.ErrCodeUnknownChannel)},
+		WithDisabledTypes(TypeChannel), WithNegativeTTL(time.Minute))
+	if _, err := nc.Channel("4321"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error for missing channel\nexpect: %v\ngot: %v", ErrNotFound, err)
+	}
+	if n := nc.missing.len(); n != 0 {
+		t.Errorf("disabled cache held negative entries\nexpect: 0\ngot: %d", n)
+	}
+
+	_, err := c.Attachment(&discordgo.MessageAttachment{URL: "https://example.com/a.png"})
+	if err != ErrUnsupported {
+		t.Errorf("wrong error from disabled attachment cache\nexpect: %v\ngot: %v", ErrUnsupported, err)
+	}
+}
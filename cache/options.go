@@ -0,0 +1,551 @@
+package cache
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/time/rate"
+)
+
+// An Option configures optional behaviour of a Cache at creation time.
+type Option func(c *Cache)
+
+// WithPrefetchConcurrency sets the maximum number of attachments a single call
+// to PrefetchAttachments downloads at once. The default is
+// DefaultPrefetchConcurrency. Limits less than one are treated as one.
+func WithPrefetchConcurrency(n int) Option {
+	return func(c *Cache) {
+		c.prefetchConcurrency = n
+	}
+}
+
+// WithStore stores the cache of every object type except attachments in s
+// rather than in memory, such that several processes may share one cache (see
+// Store). Entries in a Store are not bounded by WithMaxEntries, and the
+// attachment and negative caches remain in memory. The default of nil stores
+// entries in memory.
+func WithStore(s Store) Option {
+	return func(c *Cache) {
+		c.store = s
+	}
+}
+
+// WithOnHit sets a hook invoked for every lookup served from the cache. See
+// Hook for when hooks are invoked.
+func WithOnHit(fn Hook) Option {
+	return func(c *Cache) {
+		c.onHit = fn
+	}
+}
+
+// WithOnMiss sets a hook invoked for every lookup which was not present in the
+// cache, before the object is fetched.
+func WithOnMiss(fn Hook) Option {
+	return func(c *Cache) {
+		c.onMiss = fn
+	}
+}
+
+// WithOnInsert sets a hook invoked whenever an object is inserted into the
+// cache, whether fetched by a lookup or restored by Load.
+func WithOnInsert(fn Hook) Option {
+	return func(c *Cache) {
+		c.onInsert = fn
+	}
+}
+
+// WithOnEvict sets a hook invoked whenever an entry is removed from the cache,
+// whether by Clean, by the bound set with WithMaxEntries or by invalidation.
+func WithOnEvict(fn Hook) Option {
+	return func(c *Cache) {
+		c.onEvict = fn
+	}
+}
+
+// WithLogger sets a logger to which the cache logs each lookup which misses
+// the cache and calls the provider, at debug level with its latency and any
+// error, each failed attachment download, at warn level, and each entry
+// evicted by Clean, at debug level. The default of nil logs nothing.
+func WithLogger(l Logger) Option {
+	return func(c *Cache) {
+		c.logger = l
+	}
+}
+
+// WithClock sets the clock by which the cache measures the age of entries and
+// attachments against their TTLs and lifetimes, for example to advance time
+// in tests without sleeping. Timers, such as the janitor's and the delays
+// between download retries, are unaffected. The default, or a nil clock, uses
+// the system clock.
+func WithClock(clk Clock) Option {
+	return func(c *Cache) {
+		if clk == nil {
+			clk = realClock{}
+		}
+		c.clock = clk
+	}
+}
+
+// WithBatchConcurrency sets the maximum number of lookups a single batch
+// lookup, such as Users, runs at once. The default is DefaultBatchConcurrency.
+// Limits less than one are treated as one.
+func WithBatchConcurrency(n int) Option {
+	return func(c *Cache) {
+		c.batchConcurrency = n
+	}
+}
+
+// WithWarmRate limits the provider calls made by WarmUsers to r per second on
+// average, allowing bursts of up to burst calls. The limit is shared by every
+// call of WarmUsers on the cache, but does not apply to any other lookup. The
+// default is DefaultWarmRate with bursts of DefaultWarmBurst, and rate.Inf
+// removes the limit. Bursts less than one are treated as one.
+func WithWarmRate(r rate.Limit, burst int) Option {
+	return func(c *Cache) {
+		if burst < 1 {
+			burst = 1
+		}
+		c.warmRate, c.warmBurst = r, burst
+	}
+}
+
+// WithShards sets the number of shards each of the channel, user and guild
+// caches is split into. More shards reduce lock contention under heavy
+// concurrent use at the cost of a little memory. The default is
+// DefaultShards. Counts less than one are treated as one.
+func WithShards(n int) Option {
+	return func(c *Cache) {
+		c.shards = n
+	}
+}
+
+// WithDeterministicOrder makes the order of the cache deterministic, such that
+// tests may assert exact outcomes: the Range methods visit entries in order of
+// ID, and entries evicted or invalidated together, such as by Clean, are
+// removed and passed to the hook set with WithOnEvict in order of key, with
+// attachments otherwise equal in eviction order evicted in order of key. By
+// default, the order is that of the underlying maps, which is random. Sorting
+// costs time O(n log n) in the number of entries of each walk, and each walk
+// snapshots every entry before visiting any, so this is intended for tests
+// rather than production use.
+func WithDeterministicOrder() Option {
+	return func(c *Cache) {
+		c.deterministic = true
+	}
+}
+
+// WithAttachmentLifetime sets how long an attachment may go without being
+// referenced before Clean evicts it. The default is AttachmentLifetime.
+func WithAttachmentLifetime(d time.Duration) Option {
+	return func(c *Cache) {
+		c.attachmentLifetime = d
+	}
+}
+
+// WithAttachmentPruneThreshold sets the number of cached attachments above
+// which Clean evicts the least recently referenced attachments, until no more
+// than n remain. The default is AttachmentPruneThreshold.
+func WithAttachmentPruneThreshold(n int) Option {
+	return func(c *Cache) {
+		c.attachmentPruneThreshold = n
+	}
+}
+
+// WithMaxGuildBytes caps the memory held by each cached guild: guilds whose
+// estimated size (see EstimateGuildSize) exceeds n bytes are passed to trim
+// before being cached, such that they may be stripped of data which is never
+// needed. If trim is nil, TrimGuildState is used. Trimmed guilds are returned
+// by lookups as cached, so callers must expect them to lack whatever trim
+// strips. trim is given a copy of the guild, but as its slices are shared with
+// the provider, it must replace them rather than modifying them in place. The
+// default of zero never trims guilds.
+func WithMaxGuildBytes(n int64, trim func(g *discordgo.Guild)) Option {
+	return func(c *Cache) {
+		if trim == nil {
+			trim = TrimGuildState
+		}
+		c.maxGuildBytes, c.guildTrim = n, trim
+	}
+}
+
+// WithEvictionPolicy sets the policy by which Clean chooses the attachments to
+// evict once the attachment cache is over its prune threshold (see
+// WithAttachmentPruneThreshold) or byte budget (see WithMaxAttachmentBytes).
+// Under an LFU policy, the reference count of each attachment halves over each
+// halfLife without a reference, or over DefaultLFUHalfLife if halfLife is
+// zero or less, so that attachments which were hot but have since gone cold
+// are evicted eventually. Attachments which outlive their lifetime (see
+// WithAttachmentLifetime) are evicted regardless of policy. The default is
+// PolicyLRU.
+func WithEvictionPolicy(p EvictionPolicy, halfLife time.Duration) Option {
+	return func(c *Cache) {
+		if halfLife <= 0 {
+			halfLife = DefaultLFUHalfLife
+		}
+		c.evictionPolicy, c.lfuHalfLife = p, halfLife
+	}
+}
+
+// WithMaxAttachmentBytes sets a budget for the total size of cached attachment
+// content. Whenever the budget is exceeded, Clean evicts the least recently
+// referenced attachments until the cache is back under budget. This is in
+// addition to the prune threshold (see WithAttachmentPruneThreshold) on the
+// number of cached attachments. The default of zero sets no budget.
+func WithMaxAttachmentBytes(n int64) Option {
+	return func(c *Cache) {
+		c.maxAttachmentBytes = n
+	}
+}
+
+// WithCompression compresses the content of attachments held in memory with
+// gzip if it is at least threshold bytes, trading CPU time on every hit for
+// memory. Content which does not shrink when compressed, such as most images,
+// is held as is. Compression is transparent, so lookups always return the
+// original content, and the byte budget (see WithMaxAttachmentBytes) counts
+// the compressed size. Attachments backed by disk (see WithAttachmentDir) are
+// never compressed. The default of zero disables compression.
+func WithCompression(threshold int64) Option {
+	return func(c *Cache) {
+		c.compressThreshold = threshold
+	}
+}
+
+// WithAttachmentKey sets the function giving the key under which each
+// attachment is cached, for example to key attachments by a stable path
+// rather than by a url whose signature changes, or whose host differs when the
+// CDN is proxied, such that the same attachment served under different urls is
+// only downloaded once. Lookups, downloads shared between concurrent lookups,
+// backing files (see WithAttachmentDir) and statistics all use the key. The
+// methods given only a url, such as HasAttachment and AddAttachment, call fn
+// with an attachment with only its URL set. The signature expiry of a url (see
+// Attachment.Expired) is taken from the key, so is only tracked if the key
+// keeps the url's query. The default of nil keys attachments by their url.
+func WithAttachmentKey(fn AttachmentKeyFunc) Option {
+	return func(c *Cache) {
+		c.attachmentKey = fn
+	}
+}
+
+// WithDisabledTypes disables the caches of each of types, such that embedders
+// which only need some types of object cache nothing else. Lookups of a
+// disabled type of object call the provider every time, without sharing calls
+// between concurrent lookups or negative caching (see WithNegativeTTL), and
+// the objects returned, seeded or carried by events are never cached. Lookups
+// of attachments, if disabled, return ErrUnsupported without downloading
+// anything; to download attachments without caching them, use
+// WithAttachmentCaching instead. Every type is enabled by default.
+func WithDisabledTypes(types ...ObjectType) Option {
+	return func(c *Cache) {
+		if c.disabled == nil {
+			c.disabled = make(map[ObjectType]bool)
+		}
+		for _, t := range types {
+			c.disabled[t] = true
+		}
+	}
+}
+
+// WithResumeFlush sets the object types invalidated when the session resumes
+// its connection to the gateway after disconnecting (see HandleResumed). As
+// the gateway replays the events missed while disconnected, little need be
+// invalidated. The default is members only, and no types flushes nothing.
+func WithResumeFlush(types ...ObjectType) Option {
+	return func(c *Cache) {
+		c.resumeFlush = types
+	}
+}
+
+// WithReadyFlush is like WithResumeFlush, but sets the object types
+// invalidated when the session starts afresh with a new READY payload after
+// disconnecting (see HandleReady), in which case the events missed while
+// disconnected are lost. The default is every type but attachments, whose
+// content does not change.
+func WithReadyFlush(types ...ObjectType) Option {
+	return func(c *Cache) {
+		c.readyFlush = types
+	}
+}
+
+// WithAttachmentCaching sets whether downloaded attachments are retained in the
+// attachment cache. If disabled, Attachment and the other attachment lookups
+// still download and return attachments, with the same error handling and
+// retries, but never retain their content, so every lookup is downloaded
+// afresh, although concurrent lookups of the same attachment still share a
+// single download. Attachments added with AddAttachment are not retained
+// either, and PrefetchAttachments does nothing. The metadata caches are
+// unaffected. Attachment caching is enabled by default.
+func WithAttachmentCaching(enabled bool) Option {
+	return func(c *Cache) {
+		c.attachmentCaching = enabled
+	}
+}
+
+// WithHotAttachmentBytes splits an attachment cache backed by disk (see
+// WithAttachmentDir) into two tiers: a hot tier of attachments held in memory,
+// within a budget of n bytes, and a cold tier of the rest, backed by disk.
+// Attachments are held in memory when first cached. Each Clean then promotes
+// the attachments on disk which have been referenced since the last Clean to
+// memory, and demotes the least recently referenced attachments in memory to
+// disk until the hot tier is back within budget, so the budget may be exceeded
+// between cleans. Lookups are served from either tier alike. Eviction, the
+// prune threshold and the overall byte budget (see WithMaxAttachmentBytes)
+// apply to both tiers together. The default of zero, or an attachment cache
+// not backed by disk, leaves the attachment cache untiered.
+func WithHotAttachmentBytes(n int64) Option {
+	return func(c *Cache) {
+		c.hotAttachmentBytes = n
+	}
+}
+
+// WithAttachmentDir backs the attachment cache with the directory dir, which is
+// created if need be. Downloaded attachment content is written to a file in dir
+// named by a hash of its url, leaving only its details in memory, and is read
+// back from disk on each lookup. As the files outlive the process, attachments
+// downloaded by a previous process using the same directory are also served
+// from disk. Any byte budget set with WithMaxAttachmentBytes then applies to
+// the content on disk. The default of an empty dir holds attachments in
+// memory.
+func WithAttachmentDir(dir string) Option {
+	return func(c *Cache) {
+		c.attachmentDir = dir
+	}
+}
+
+// WithMirror reads attachments from the local directory dir, such as a shared
+// volume where another process deposits attachments, before downloading them
+// from the CDN. On a miss, the file found in dir by fn is read instead of
+// downloading the attachment, if it exists and its size matches that given by
+// the Discord API, and is then cached like a download. Otherwise, the
+// attachment is downloaded as usual. The mirror is only read, so files in it
+// are never written or deleted by the cache. If fn is nil, MirrorByFilename is
+// used. The default of an empty dir reads no mirror.
+func WithMirror(dir string, fn MirrorFunc) Option {
+	return func(c *Cache) {
+		if fn == nil {
+			fn = MirrorByFilename
+		}
+		c.mirrorDir, c.mirrorPath = dir, fn
+	}
+}
+
+// WithAllowedTypes restricts attachment downloads to the media types given,
+// such as "image/png". A type ending in "/*", such as "image/*", allows every
+// subtype. Downloads whose Content-Type, as sent by the CDN rather than as
+// reported by the Discord API, is not allowed fail with ErrDisallowedType and
+// are not cached. The default of no types allows any type.
+func WithAllowedTypes(types ...string) Option {
+	return func(c *Cache) {
+		c.allowedTypes = types
+	}
+}
+
+// WithMaxAttachmentSize sets the maximum size of a single attachment download.
+// Downloads of larger attachments fail with ErrTooLarge and are not cached. The
+// default is DefaultMaxAttachmentSize. A limit of zero or less removes the
+// limit entirely.
+func WithMaxAttachmentSize(n int64) Option {
+	return func(c *Cache) {
+		c.maxAttachmentSize = n
+	}
+}
+
+// WithRetry sets the retry policy of attachment downloads. A download which
+// fails with a network error or a 5xx response is attempted up to attempts
+// times in total, waiting delay before the first retry and doubling the wait
+// before each one after. A download rejected by a rate limit with a 429
+// response is retried likewise, but after waiting as long as its Retry-After
+// header asks, and fails at once if that is longer than MaxRetryAfter. A
+// download still rate limited once no attempts remain fails with a
+// RateLimitError. Other failures, such as the 4xx response of an expired URL,
+// are never retried. The default is DefaultRetryAttempts attempts with a delay
+// of DefaultRetryDelay. Setting attempts to one disables retries.
+func WithRetry(attempts int, delay time.Duration) Option {
+	return func(c *Cache) {
+		c.retryAttempts = attempts
+		c.retryDelay = delay
+	}
+}
+
+// WithTTL sets the time to live of cached entries of type t. Once an entry is
+// older than its TTL, a lookup treats it as a miss and re-fetches it from the
+// provider, and Clean removes it. A TTL of zero means entries of type t never
+// expire. The default for every type but attachments is DefaultTTL. For roles
+// and emojis, the TTL applies to the set of each in a guild as a whole, and
+// for histories, to the recent messages of each channel as a whole.
+// Attachments are instead evicted by their lifetime (see
+// WithAttachmentLifetime). Their TTL is the interval after which a cached
+// attachment is revalidated with the CDN using its ETag and Last-Modified
+// validators, being downloaded again only if it has changed. Attachments are
+// never revalidated by default.
+func WithTTL(t ObjectType, ttl time.Duration) Option {
+	return func(c *Cache) {
+		switch t {
+		case TypeChannel:
+			c.channelTTL = ttl
+		case TypeUser:
+			c.userTTL = ttl
+		case TypeGuild:
+			c.guildTTL = ttl
+		case TypeMember:
+			c.memberTTL = ttl
+		case TypeRole:
+			c.roleTTL = ttl
+		case TypeEmoji:
+			c.emojiTTL = ttl
+		case TypeSticker:
+			c.stickerTTL = ttl
+		case TypeMessage:
+			c.messageTTL = ttl
+		case TypeHistory:
+			c.historyTTL = ttl
+		case TypeAttachment:
+			c.attachmentTTL = ttl
+		}
+	}
+}
+
+// WithTTLJitter randomly lengthens or shortens the TTL of each cached entry by
+// up to fraction of the TTL of its type (see WithTTL), such that a fraction of
+// 0.1 makes each entry expire after between 90% and 110% of the TTL. Entries
+// cached together, such as during a burst of lookups at startup, then expire
+// spread out over time rather than all at once, stopping them from being
+// fetched from the provider again all at once. The jitter of each entry is
+// fixed when it is inserted. Entries with their own TTL (see
+// SetChannelWithTTL) and attachments are not affected. Fractions are clamped
+// to between zero and one, and the default of zero disables jitter.
+func WithTTLJitter(fraction float64) Option {
+	return func(c *Cache) {
+		switch {
+		case fraction < 0:
+			fraction = 0
+		case fraction > 1:
+			fraction = 1
+		}
+		c.ttlJitter = fraction
+	}
+}
+
+// WithMaxEntries bounds the number of cached entries of type t to n (for roles
+// and emojis, n guilds' worth, and for histories, n channels' worth). Once the
+// bound is reached, inserting a new entry evicts the least recently used entry
+// of the same type, whichever shard (see WithShards) it is in. Bounded caches
+// must record the use of each entry on lookup, meaning that hits take an
+// exclusive rather than a shared lock on their shard, and each eviction
+// briefly locks every shard in turn. Histories are bounded to
+// DefaultMaxHistories channels by default, and every other type is unbounded
+// by default; a bound of zero leaves the cache of any type unbounded.
+// Attachments are instead governed by their prune threshold (see
+// WithAttachmentPruneThreshold), so bounding them has no effect.
+func WithMaxEntries(t ObjectType, n int) Option {
+	return func(c *Cache) {
+		switch t {
+		case TypeChannel:
+			c.channelMax = n
+		case TypeUser:
+			c.userMax = n
+		case TypeGuild:
+			c.guildMax = n
+		case TypeMember:
+			c.memberMax = n
+		case TypeRole:
+			c.roleMax = n
+		case TypeEmoji:
+			c.emojiMax = n
+		case TypeSticker:
+			c.stickerMax = n
+		case TypeMessage:
+			c.messageMax = n
+		case TypeHistory:
+			c.historyMax = n
+		}
+	}
+}
+
+// WithHistoryLimit sets the number of recent messages cached for each channel
+// by RecentMessages, beyond which older messages are dropped as new ones
+// arrive. The default is DefaultHistoryLimit. Limits less than one are
+// treated as one.
+func WithHistoryLimit(n int) Option {
+	return func(c *Cache) {
+		if n < 1 {
+			n = 1
+		}
+		c.historyLimit = n
+	}
+}
+
+// WithUserNameIndex indexes cached users by username, such that they may be
+// found by name with UserByName and UsersByName without calling the provider.
+// The index is kept up to date as users are inserted, renamed and evicted, at
+// the cost of a little memory for each cached user.
+func WithUserNameIndex() Option {
+	return func(c *Cache) {
+		c.userNameIndex = true
+	}
+}
+
+// WithMaxMembersPerGuild bounds the number of cached members of each guild to
+// n, such that a single large guild cannot dominate the member cache. Once a
+// guild has n cached members, caching another member of the guild evicts the
+// least recently used member of the same guild, leaving other guilds alone.
+// The bound applies on top of any bound on the member cache as a whole set
+// with WithMaxEntries, which evicts the least recently used members of any
+// guild. Only members cached by this Cache are counted, so members cached by
+// other caches sharing a Store (see WithStore) are not bounded. The default of
+// zero leaves each guild unbounded.
+func WithMaxMembersPerGuild(n int) Option {
+	return func(c *Cache) {
+		c.guildMemberMax = n
+	}
+}
+
+// WithNegativeTTL enables negative caching of lookups of every object type
+// except attachments. When the provider reports that an object does not exist
+// (a 404 or one of Discord's "unknown object" error codes), lookups of the same
+// ID return an error matching both ErrNotFound and ErrMissing without calling
+// the provider until ttl has elapsed. Transient errors are never cached. The
+// default of zero disables negative caching.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithTombstoneTTL makes the deletion handlers, such as HandleChannelDelete,
+// record that the deleted object no longer exists for ttl, such that lookups
+// of it return an error matching both ErrNotFound and ErrMissing without
+// calling the provider, as with negative caching (see WithNegativeTTL). This
+// stops a burst of lookups of a deleted object, such as from messages which
+// still refer to it, each failing against the API. The tombstone is cleared if
+// the object is seen again, such as by a creation or update handler or when
+// seeded. The default of zero disables tombstones.
+func WithTombstoneTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.tombstoneTTL = ttl
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for attachment downloads. The
+// default is a client with a timeout of DefaultHTTPTimeout, using a transport
+// from NewTransport limited to DefaultMaxConnsPerHost connections per host (but
+// see WithMaxConnsPerHost), which attempts HTTP/2 and keeps connections to the
+// CDN alive for reuse. A client set here fully controls its connection
+// usage through its own transport, such as one from NewTransport shared by
+// several clients. A nil client restores the default.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Cache) {
+		c.httpClient = client
+	}
+}
+
+// WithMaxConnsPerHost sets the maximum number of connections the default HTTP
+// client opens to a single host, including during bursts of downloads such as
+// those of PrefetchAttachments. It has no effect on a client set with
+// WithHTTPClient. The default is DefaultMaxConnsPerHost, and zero means no
+// limit.
+func WithMaxConnsPerHost(n int) Option {
+	return func(c *Cache) {
+		c.maxConnsPerHost = n
+	}
+}
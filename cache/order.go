@@ -0,0 +1,69 @@
+package cache
+
+import "sort"
+
+// sortedTable is a table which walks its entries, and returns the keys of
+// removed entries, in order of key (see WithDeterministicOrder). Walking
+// snapshots and sorts every entry first, so takes time O(n log n) in the
+// number of entries, however early fn stops.
+type sortedTable[T any] struct {
+	table[T]
+}
+
+func (s sortedTable[T]) deleteFunc(pred func(key string, val *T) bool) []string {
+	removed := s.table.deleteFunc(pred)
+	sort.Strings(removed)
+	return removed
+}
+
+func (s sortedTable[T]) clear() []string {
+	removed := s.table.clear()
+	sort.Strings(removed)
+	return removed
+}
+
+func (s sortedTable[T]) walk(fn func(key string, val *T) bool) {
+	type item struct {
+		key string
+		val *T
+	}
+
+	var items []item
+	s.table.walk(func(key string, val *T) bool {
+		items = append(items, item{key, val})
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+
+	for _, it := range items {
+		if !fn(it.key, it.val) {
+			return
+		}
+	}
+}
+
+// byKey breaks ties in the order of h by key, such that attachments which are
+// equal in order, such as those last referenced at the same time, are always
+// evicted in the same order.
+func (h *attachmentHeap) byKey() {
+	less := h.less
+	h.less = func(a, b *Attachment) bool {
+		switch {
+		case less(a, b):
+			return true
+		case less(b, a):
+			return false
+		default:
+			return a.key < b.key
+		}
+	}
+}
+
+// sortedKeys sorts keys if the order of the cache is deterministic, returning
+// keys.
+func (c *Cache) sortedKeys(keys []string) []string {
+	if c.deterministic {
+		sort.Strings(keys)
+	}
+	return keys
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDeterministicOrder(t *testing.T) {
+	ids := make([]string, 50)
+	for i := range ids {
+		ids[i] = fmt.Sprint(rand.Int63())
+	}
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+
+	for run := 0; run < 3; run++ {
+		var (
+			mu      sync.Mutex
+			evicted []string
+		)
+		clock := NewFakeClock()
+		c := NewCache(MockProvider{}, WithDeterministicOrder(), WithClock(clock),
+			WithTTL(TypeChannel, time.Minute), WithAttachmentPruneThreshold(len(ids)/2),
+			WithOnEvict(func(_ ObjectType, id string) {
+				mu.Lock()
+				evicted = append(evicted, id)
+				mu.Unlock()
+			}))
+
+		chs := make([]*discordgo.Channel, len(ids))
+		for i, id := range ids {
+			chs[i] = &discordgo.Channel{ID: id}
+			c.AddAttachment(id, id, "", []byte(id))
+		}
+		c.SeedChannels(chs)
+
+		var ranged []string
+		c.RangeChannels(func(ID string, _ discordgo.Channel) bool {
+			ranged = append(ranged, ID)
+			return true
+		})
+		if !reflect.DeepEqual(ranged, sorted) {
+			t.Errorf("channels not ranged in order of ID\nexpect: %v\ngot: %v", sorted, ranged)
+		}
+
+		// The expired channels are evicted in order, followed by the
+		// first half of the attachments by key, as each was last
+		// referenced at the same time
+		clock.Advance(2 * time.Minute)
+		c.Clean()
+		expect := append(append([]string(nil), sorted...), sorted[:len(sorted)/2]...)
+		if !reflect.DeepEqual(evicted, expect) {
+			t.Errorf("wrong eviction order\nexpect: %v\ngot: %v", expect, evicted)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// IsPartialGuild returns true if g lacks the roles which every guild has, such
+// as guilds sent by the gateway as unavailable stubs. Guilds fetched from the
+// Discord API carry their roles and emojis but never their channels or
+// members, which only guilds sent by the gateway carry, so a guild which is
+// not partial may still lack its channels (see GuildWithChannels).
+func IsPartialGuild(g discordgo.Guild) bool {
+	return len(g.Roles) == 0
+}
+
+// GuildWithRoles is like Guild, but if the guild lacks its roles (see
+// IsPartialGuild), they are filled in from the role cache, looking them up
+// from the provider as by Role on a miss, and the cached guild is replaced by
+// the fuller guild. The provider must be able to look up the roles of a guild
+// (see RoleProvider), or ErrUnsupported is returned for partial guilds.
+func (c *Cache) GuildWithRoles(guildID string) (discordgo.Guild, error) {
+	return c.GuildWithRolesContext(context.Background(), guildID)
+}
+
+// GuildWithRolesContext is like GuildWithRoles, but stops waiting for the
+// provider and returns the context's error if ctx is done before the lookup
+// completes.
+func (c *Cache) GuildWithRolesContext(ctx context.Context, guildID string) (discordgo.Guild, error) {
+	g, err := c.GuildContext(ctx, guildID)
+	if err != nil || len(g.Roles) > 0 {
+		return g, err
+	}
+
+	set, err := c.guildRoles(ctx, guildID)
+	if err != nil {
+		return g, err
+	}
+	g.Roles = make([]*discordgo.Role, 0, len(set))
+	for _, r := range set {
+		g.Roles = append(g.Roles, r)
+	}
+	sort.Slice(g.Roles, func(i, j int) bool {
+		if g.Roles[i].Position != g.Roles[j].Position {
+			return g.Roles[i].Position < g.Roles[j].Position
+		}
+		return g.Roles[i].ID < g.Roles[j].ID
+	})
+
+	c.fillGuild(guildID, func(cached *discordgo.Guild) bool {
+		if len(cached.Roles) > 0 {
+			return false
+		}
+		cached.Roles = g.Roles
+		return true
+	})
+	return g, nil
+}
+
+// GuildWithChannels is like GuildWithRoles, but for the channels of the guild,
+// which are looked up from the provider if the guild lacks them and are
+// cached as channels too. The provider must be able to look up the channels of
+// a guild (see GuildChannelsProvider), or ErrUnsupported is returned for
+// guilds without channels.
+func (c *Cache) GuildWithChannels(guildID string) (discordgo.Guild, error) {
+	return c.GuildWithChannelsContext(context.Background(), guildID)
+}
+
+// GuildWithChannelsContext is like GuildWithChannels, but stops waiting for
+// the provider and returns the context's error if ctx is done before the
+// lookup completes.
+func (c *Cache) GuildWithChannelsContext(ctx context.Context, guildID string) (discordgo.Guild, error) {
+	g, err := c.GuildContext(ctx, guildID)
+	if err != nil || len(g.Channels) > 0 {
+		return g, err
+	}
+
+	v, err := c.doContext(ctx, "channels:"+guildID, func(ctx context.Context) (interface{}, error) {
+		return fetchGuildChannels(ctx, c.provider, guildID)
+	})
+	if err != nil {
+		return g, err
+	}
+	g.Channels = v.([]*discordgo.Channel)
+	c.SeedChannels(g.Channels)
+
+	c.fillGuild(guildID, func(cached *discordgo.Guild) bool {
+		if len(cached.Channels) > 0 {
+			return false
+		}
+		cached.Channels = g.Channels
+		return true
+	})
+	return g, nil
+}
+
+// fillGuild replaces the cached guild guildID by a copy completed by fill, if
+// it is still cached and fill returns true. Otherwise, the cached guild is
+// left alone, such as if it has since been replaced by a fuller guild. The
+// completed guild keeps the insertion time of the cached guild, so it expires
+// no later than the guild it completes.
+func (c *Cache) fillGuild(guildID string, fill func(g *discordgo.Guild) bool) {
+	e, ok := c.guilds.peek(guildID)
+	if !ok {
+		return
+	}
+
+	val := *e.val
+	if fill(&val) {
+		cp := *e
+		cp.val = &val
+		c.guilds.insert(guildID, &cp)
+	}
+}
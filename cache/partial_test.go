@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPartialGuild(t *testing.T) {
+	c := NewCache(MockProvider{})
+
+	g, err := c.Guild("9101112")
+	if err != nil {
+		t.Fatal("Unexpected error from guild retrieval:", err)
+	}
+	if !IsPartialGuild(g) {
+		t.Error("guild without roles was not reported partial")
+	}
+
+	g, err = c.GuildWithRoles("9101112")
+	if err != nil {
+		t.Fatal("Unexpected error from guild retrieval with roles:", err)
+	}
+	if len(g.Roles) != 2 || g.Roles[0].ID != "1" || g.Roles[1].ID != "2" {
+		t.Errorf("wrong roles of completed guild\nexpect: [1 2]\ngot: %v", g.Roles)
+	}
+
+	g, err = c.GuildWithChannels("9101112")
+	if err != nil {
+		t.Fatal("Unexpected error from guild retrieval with channels:", err)
+	}
+	if len(g.Channels) != 2 {
+		t.Errorf("wrong channel count of completed guild\nexpect: 2\ngot: %d", len(g.Channels))
+	}
+	if !c.channels.has("4321") {
+		t.Error("channels of completed guild were not cached")
+	}
+
+	// The cached guild is replaced by the fuller guild
+	g, _ = c.Guild("9101112")
+	if IsPartialGuild(g) || len(g.Channels) != 2 {
+		t.Errorf("cached guild was not completed: %d roles, %d channels", len(g.Roles), len(g.Channels))
+	}
+	if n := c.Stats().Guild.Misses; n != 1 {
+		t.Errorf("wrong number of guild misses\nexpect: 1\ngot: %d", n)
+	}
+
+	// Complete guilds are served as cached
+	c.SeedGuilds([]*discordgo.Guild{{ID: "1", Roles: []*discordgo.Role{{ID: "3"}}}})
+	if g, err := c.GuildWithRoles("1"); err != nil || len(g.Roles) != 1 {
+		t.Error("complete guild was not served as cached:", err)
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DefaultPrefetchConcurrency is the maximum number of concurrent downloads
+// made by a single call to PrefetchAttachments if no other limit is
+// configured.
+const DefaultPrefetchConcurrency = 4
+
+// PrefetchAttachments downloads and caches each of atts, such that later
+// lookups of them are served from the cache. Attachments are downloaded
+// concurrently, at most the prefetch concurrency (see WithPrefetchConcurrency)
+// at once, and attachments which are already cached are skipped without
+// being read or revalidated. If any attachment could not be downloaded, a
+// LookupError mapping the key of each such attachment (its url, unless set
+// otherwise with WithAttachmentKey) to its error is returned, and the
+// remaining attachments are cached regardless. If attachment caching is
+// disabled (see WithAttachmentCaching), nothing is downloaded, and if
+// attachments are disabled altogether (see WithDisabledTypes), ErrUnsupported
+// is returned.
+func (c *Cache) PrefetchAttachments(ctx context.Context, atts []*discordgo.MessageAttachment) error {
+	if c.disabled[TypeAttachment] {
+		return ErrUnsupported
+	}
+	if !c.attachmentCaching {
+		return nil
+	}
+
+	byKey := make(map[string]*discordgo.MessageAttachment, len(atts))
+	keys := make([]string, 0, len(atts))
+	for _, at := range atts {
+		if at == nil {
+			continue
+		}
+		key := c.keyOf(at)
+		if c.hasAttachment(key) {
+			continue
+		}
+		if _, ok := byKey[key]; !ok {
+			byKey[key] = at
+			keys = append(keys, key)
+		}
+	}
+
+	_, err := batch(ctx, c.prefetchConcurrency, keys, func(ctx context.Context, key string) (struct{}, error) {
+		_, err := c.AttachmentContext(ctx, byKey[key])
+		return struct{}{}, err
+	})
+	return err
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPrefetchAttachments(t *testing.T) {
+	var inflight, peak, hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{}, WithPrefetchConcurrency(2), WithRetry(1, 0))
+	c.Attachment(&discordgo.MessageAttachment{URL: srv.URL + "/cached"})
+
+	var atts []*discordgo.MessageAttachment
+	for _, path := range []string{"/a", "/b", "/c", "/a", "/cached", "/missing"} {
+		atts = append(atts, &discordgo.MessageAttachment{URL: srv.URL + path})
+	}
+	err := c.PrefetchAttachments(context.Background(), atts)
+
+	var lerr LookupError
+	if !errors.As(err, &lerr) || len(lerr) != 1 || lerr[srv.URL+"/missing"] == nil {
+		t.Errorf("wrong error from prefetch: %v", err)
+	}
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if !c.HasAttachment(srv.URL + path) {
+			t.Errorf("attachment '%s' was not prefetched", path)
+		}
+	}
+	if hits != 5 {
+		t.Errorf("wrong number of downloads\nexpect: 5\ngot: %d", hits)
+	}
+	if peak > 2 {
+		t.Errorf("too many concurrent downloads\nexpect: <=2\ngot: %d", peak)
+	}
+}
+
+func TestMaxConnsPerHost(t *testing.T) {
+	var inflight, peak int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	c := NewCache(MockProvider{}, WithPrefetchConcurrency(8), WithMaxConnsPerHost(2))
+	var atts []*discordgo.MessageAttachment
+	for i := 0; i < 8; i++ {
+		atts = append(atts, &discordgo.MessageAttachment{URL: srv.URL + "/" + strconv.Itoa(i)})
+	}
+	if err := c.PrefetchAttachments(context.Background(), atts); err != nil {
+		t.Fatal("Unexpected error from prefetch:", err)
+	}
+	if peak > 2 {
+		t.Errorf("too many concurrent connections\nexpect: <=2\ngot: %d", peak)
+	}
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"io"
+)
+
+// A ProgressFunc is called as an attachment is downloaded with the number of
+// bytes read so far and the total size of the attachment, or -1 if the CDN did
+// not declare its size.
+type ProgressFunc func(read, total int64)
+
+// progressKey is the context key of the ProgressFunc of ContextWithProgress.
+type progressKey struct{}
+
+// ContextWithProgress returns a copy of ctx carrying fn, such that attachment
+// downloads made with the returned context, such as by AttachmentContext or
+// CopyAttachment, report their progress to fn, for example to show the
+// progress of downloading a large video. fn is called after each read from
+// the CDN, from the goroutine making the download, so it must be quick and
+// safe to call concurrently with the caller. As concurrent lookups of the same
+// url share a download, only the context of the lookup which started the
+// download has its progress reported; attachments served from the cache are
+// not reported at all.
+func ContextWithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFrom returns the ProgressFunc carried by ctx, or nil if none.
+func progressFrom(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+// progressReader is a reader which reports the progress of reading r to fn.
+type progressReader struct {
+	r     io.Reader
+	fn    ProgressFunc
+	read  int64
+	total int64
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.read += int64(n)
+		pr.fn(pr.read, pr.total)
+	}
+	return n, err
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestProgress(t *testing.T) {
+	content := make([]byte, 100000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sized.bin" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Name  string
+		Path  string
+		Total int64
+	}{
+		{"Sized", "/sized.bin", int64(len(content))},
+		{"Unsized", "/unsized.bin", -1},
+	}
+	for _, tc := range cases {
+		var calls, last, total int64
+		var backwards bool
+		ctx := ContextWithProgress(context.Background(), func(read, size int64) {
+			backwards = backwards || read < last
+			calls, last, total = calls+1, read, size
+		})
+
+		c := NewCache(MockProvider{})
+		at := &discordgo.MessageAttachment{URL: srv.URL + tc.Path}
+		if _, err := c.AttachmentContext(ctx, at); err != nil {
+			t.Fatalf("%s: Unexpected error from attachment retrieval: %v", tc.Name, err)
+		}
+		if calls == 0 || last != int64(len(content)) || total != tc.Total {
+			t.Errorf("%s: wrong progress reported\nexpect: %d of %d\ngot: %d of %d in %d calls",
+				tc.Name, len(content), tc.Total, last, total, calls)
+		}
+		if backwards {
+			t.Errorf("%s: progress went backwards", tc.Name)
+		}
+
+		// Hits are not reported
+		calls = 0
+		c.AttachmentContext(ctx, at)
+		if calls != 0 {
+			t.Errorf("%s: progress reported for cache hit", tc.Name)
+		}
+	}
+}
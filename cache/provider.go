@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// *discordgo.Session implements every provider interface but StickerProvider
+// and the context providers, such as ContextProvider. Wrap it in a
+// SessionProvider for its requests to be made with the context of the lookup.
+var (
+	_ Provider                = (*discordgo.Session)(nil)
+	_ MemberProvider          = (*discordgo.Session)(nil)
+	_ RoleProvider            = (*discordgo.Session)(nil)
+	_ EmojiProvider           = (*discordgo.Session)(nil)
+	_ GuildChannelsProvider   = (*discordgo.Session)(nil)
+	_ MessageProvider         = (*discordgo.Session)(nil)
+	_ ChannelMessagesProvider = (*discordgo.Session)(nil)
+)
+
+// A MemberProvider is a Provider which can also look up guild members, as
+// required by Member.
+type MemberProvider interface {
+	GuildMember(guildID, userID string) (st *discordgo.Member, err error)
+}
+
+// A RoleProvider is a Provider which can also look up the roles of a guild, as
+// required by Role.
+type RoleProvider interface {
+	GuildRoles(guildID string) (st []*discordgo.Role, err error)
+}
+
+// An EmojiProvider is a Provider which can also look up the emojis of a guild,
+// as required by Emoji.
+type EmojiProvider interface {
+	GuildEmojis(guildID string) (emoji []*discordgo.Emoji, err error)
+}
+
+// A GuildChannelsProvider is a Provider which can also look up the channels of
+// a guild, as required by WarmGuild.
+type GuildChannelsProvider interface {
+	GuildChannels(guildID string) (st []*discordgo.Channel, err error)
+}
+
+// A MessageProvider is a Provider which can also look up messages, as
+// required by Message.
+type MessageProvider interface {
+	ChannelMessage(channelID, messageID string) (st *discordgo.Message, err error)
+}
+
+// A ChannelMessagesProvider is a Provider which can also page the message
+// history of a channel, newest message first, as required by RecentMessages.
+type ChannelMessagesProvider interface {
+	ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) (st []*discordgo.Message, err error)
+}
+
+// A ContextProvider is a Provider which can also look up channels, users and
+// guilds with a context, such that the call is abandoned if the context is
+// done, for example by making the underlying request with the context. The
+// cache prefers these methods to those of Provider when available. Lookups
+// sharing a call each wait on their own context, so the context given to the
+// provider is only done once every lookup sharing the call has given up.
+type ContextProvider interface {
+	ChannelContext(ctx context.Context, channelID string) (c *discordgo.Channel, err error)
+	UserContext(ctx context.Context, userID string) (u *discordgo.User, err error)
+	GuildContext(ctx context.Context, guildID string) (st *discordgo.Guild, err error)
+}
+
+// A MemberContextProvider is a MemberProvider which can also look up guild
+// members with a context, as ContextProvider does for channels.
+type MemberContextProvider interface {
+	GuildMemberContext(ctx context.Context, guildID, userID string) (st *discordgo.Member, err error)
+}
+
+// A RoleContextProvider is a RoleProvider which can also look up the roles of
+// a guild with a context, as ContextProvider does for channels.
+type RoleContextProvider interface {
+	GuildRolesContext(ctx context.Context, guildID string) (st []*discordgo.Role, err error)
+}
+
+// An EmojiContextProvider is an EmojiProvider which can also look up the
+// emojis of a guild with a context, as ContextProvider does for channels.
+type EmojiContextProvider interface {
+	GuildEmojisContext(ctx context.Context, guildID string) (emoji []*discordgo.Emoji, err error)
+}
+
+// A GuildChannelsContextProvider is a GuildChannelsProvider which can also
+// look up the channels of a guild with a context, as ContextProvider does for
+// channels.
+type GuildChannelsContextProvider interface {
+	GuildChannelsContext(ctx context.Context, guildID string) (st []*discordgo.Channel, err error)
+}
+
+// A MessageContextProvider is a MessageProvider which can also look up
+// messages with a context, as ContextProvider does for channels.
+type MessageContextProvider interface {
+	ChannelMessageContext(ctx context.Context, channelID, messageID string) (st *discordgo.Message, err error)
+}
+
+// A ChannelMessagesContextProvider is a ChannelMessagesProvider which can also
+// page the message history of a channel with a context, as ContextProvider
+// does for channels.
+type ChannelMessagesContextProvider interface {
+	ChannelMessagesContext(ctx context.Context, channelID string, limit int, beforeID, afterID, aroundID string) (st []*discordgo.Message, err error)
+}
+
+// fetchChannel looks up the channel channelID with p, with ctx if p is a
+// ContextProvider.
+func fetchChannel(ctx context.Context, p Provider, channelID string) (*discordgo.Channel, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.ChannelContext(ctx, channelID)
+	}
+
+	return p.Channel(channelID)
+}
+
+// fetchUser is like fetchChannel, but for the user userID.
+func fetchUser(ctx context.Context, p Provider, userID string) (*discordgo.User, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.UserContext(ctx, userID)
+	}
+
+	return p.User(userID)
+}
+
+// fetchGuild is like fetchChannel, but for the guild guildID.
+func fetchGuild(ctx context.Context, p Provider, guildID string) (*discordgo.Guild, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.GuildContext(ctx, guildID)
+	}
+
+	return p.Guild(guildID)
+}
+
+// fetchMember looks up the member userID of guild guildID with p, with ctx if
+// p is a MemberContextProvider, returning ErrUnsupported if p is unable to look
+// up members.
+func fetchMember(ctx context.Context, p Provider, guildID, userID string) (*discordgo.Member, error) {
+	switch p := p.(type) {
+	case MemberContextProvider:
+		return p.GuildMemberContext(ctx, guildID, userID)
+	case MemberProvider:
+		return p.GuildMember(guildID, userID)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// fetchRoles is like fetchMember, but for the roles of guild guildID.
+func fetchRoles(ctx context.Context, p Provider, guildID string) ([]*discordgo.Role, error) {
+	switch p := p.(type) {
+	case RoleContextProvider:
+		return p.GuildRolesContext(ctx, guildID)
+	case RoleProvider:
+		return p.GuildRoles(guildID)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// fetchEmojis is like fetchMember, but for the emojis of guild guildID.
+func fetchEmojis(ctx context.Context, p Provider, guildID string) ([]*discordgo.Emoji, error) {
+	switch p := p.(type) {
+	case EmojiContextProvider:
+		return p.GuildEmojisContext(ctx, guildID)
+	case EmojiProvider:
+		return p.GuildEmojis(guildID)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// fetchGuildChannels is like fetchMember, but for the channels of guild
+// guildID.
+func fetchGuildChannels(ctx context.Context, p Provider, guildID string) ([]*discordgo.Channel, error) {
+	switch p := p.(type) {
+	case GuildChannelsContextProvider:
+		return p.GuildChannelsContext(ctx, guildID)
+	case GuildChannelsProvider:
+		return p.GuildChannels(guildID)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// fetchMessage is like fetchMember, but for the message messageID of channel
+// channelID.
+func fetchMessage(ctx context.Context, p Provider, channelID, messageID string) (*discordgo.Message, error) {
+	switch p := p.(type) {
+	case MessageContextProvider:
+		return p.ChannelMessageContext(ctx, channelID, messageID)
+	case MessageProvider:
+		return p.ChannelMessage(channelID, messageID)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// fetchChannelMessages pages the history of channel channelID with p, with ctx
+// if p is a ChannelMessagesContextProvider, returning ErrUnsupported if p is
+// unable to page channel histories.
+func fetchChannelMessages(ctx context.Context, p Provider, channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	switch p := p.(type) {
+	case ChannelMessagesContextProvider:
+		return p.ChannelMessagesContext(ctx, channelID, limit, beforeID, afterID, aroundID)
+	case ChannelMessagesProvider:
+		return p.ChannelMessages(channelID, limit, beforeID, afterID, aroundID)
+	default:
+		return nil, ErrUnsupported
+	}
+}
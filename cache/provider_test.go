@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// MinimalProvider implements only the methods required of every Provider.
+type MinimalProvider struct{}
+
+func (MinimalProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	return MockProvider{}.Channel(channelID)
+}
+
+func (MinimalProvider) User(userID string) (*discordgo.User, error) {
+	return MockProvider{}.User(userID)
+}
+
+func (MinimalProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	return MockProvider{}.Guild(guildID)
+}
+
+// BlockingProvider is a ContextProvider whose lookups of channels block until
+// release is closed or their context is done, sending the context's error on
+// abandoned once done.
+type BlockingProvider struct {
+	MockProvider
+	release   chan struct{}
+	abandoned chan error
+}
+
+func (p BlockingProvider) ChannelContext(ctx context.Context, channelID string) (*discordgo.Channel, error) {
+	select {
+	case <-p.release:
+		return p.Channel(channelID)
+	case <-ctx.Done():
+		p.abandoned <- ctx.Err()
+		return nil, ctx.Err()
+	}
+}
+
+func (p BlockingProvider) UserContext(ctx context.Context, userID string) (*discordgo.User, error) {
+	return p.User(userID)
+}
+
+func (p BlockingProvider) GuildContext(ctx context.Context, guildID string) (*discordgo.Guild, error) {
+	return p.Guild(guildID)
+}
+
+func TestContextProvider(t *testing.T) {
+	p := BlockingProvider{release: make(chan struct{}), abandoned: make(chan error, 1)}
+	wrapped := []struct {
+		Name     string
+		Provider Provider
+	}{
+		{"Direct", p},
+		{"Multi", NewMultiProvider(p)},
+		{"RateLimited", NewRateLimitedProvider(p, 1000, 1)},
+	}
+
+	// A lookup which gives up cancels the provider call it made
+	for _, w := range wrapped {
+		c := NewCache(w.Provider)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := c.ChannelContext(ctx, "1234")
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: wrong error from abandoned lookup\nexpect: %v\ngot: %v", w.Name, context.DeadlineExceeded, err)
+		}
+		select {
+		case err := <-p.abandoned:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: wrong error seen by provider\nexpect: %v\ngot: %v", w.Name, context.Canceled, err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: provider call was not cancelled", w.Name)
+		}
+	}
+
+	// The call continues while any lookup sharing it is still waiting
+	c := NewCache(p)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.ChannelContext(ctx, "1234")
+		done <- err
+	}()
+	result := make(chan error)
+	go func() {
+		// Join the call once the first lookup has started it
+		for c.Stats().Channel.Misses < 1 {
+			time.Sleep(time.Millisecond)
+		}
+		ch, err := c.Channel("1234")
+		if err == nil && ch.Name != "Testing Channel" {
+			err = errors.New("wrong channel " + ch.Name)
+		}
+		result <- err
+	}()
+	for c.Stats().Channel.Misses < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error from abandoned lookup\nexpect: %v\ngot: %v", context.Canceled, err)
+	}
+	select {
+	case err := <-p.abandoned:
+		t.Error("provider call cancelled while a lookup was waiting:", err)
+	default:
+	}
+	close(p.release)
+	if err := <-result; err != nil {
+		t.Error("Unexpected error from shared lookup:", err)
+	}
+	if _, ok := c.channels.get("1234"); !ok {
+		t.Error("channel from shared call was not cached")
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Lookup func(c *Cache) error
+	}{
+		{"Member", func(c *Cache) error { _, err := c.Member("9101112", "5678"); return err }},
+		{"Role", func(c *Cache) error { _, err := c.Role("9101112", "1"); return err }},
+		{"Emoji", func(c *Cache) error { _, err := c.Emoji("9101112", "1"); return err }},
+		{"Sticker", func(c *Cache) error { _, err := c.Sticker("1314"); return err }},
+		{"Message", func(c *Cache) error { _, err := c.Message("1234", "1516"); return err }},
+		{"Warm", func(c *Cache) error { return c.WarmGuild(context.Background(), "9101112") }},
+	}
+
+	providers := []struct {
+		Name     string
+		Provider Provider
+	}{
+		{"Minimal", MinimalProvider{}},
+		{"Wrapped", NewMultiProvider(MinimalProvider{})},
+	}
+
+	for _, p := range providers {
+		c := NewCache(p.Provider)
+		if _, err := c.Channel("1234"); err != nil {
+			t.Errorf("%s: Unexpected error from channel retrieval: %v", p.Name, err)
+		}
+		for _, tc := range cases {
+			if err := tc.Lookup(c); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("%s/%s: wrong error\nexpect: %v\ngot: %v", p.Name, tc.Name, ErrUnsupported, err)
+			}
+		}
+	}
+}
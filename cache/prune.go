@@ -0,0 +1,127 @@
+package cache
+
+import "container/heap"
+
+// attachmentHeap is a min-heap of cached attachments, used to find the
+// attachments to evict in time proportional to the number evicted rather than
+// the size of the attachment cache. Each attachment records its own position
+// in the heap, found with index, so that it can be fixed or removed in place.
+type attachmentHeap struct {
+	items []*Attachment
+	less  func(a, b *Attachment) bool
+	index func(a *Attachment) *int
+}
+
+// newReferenceHeap returns a heap of attachments ordered by last reference.
+func newReferenceHeap() *attachmentHeap {
+	return &attachmentHeap{
+		less:  func(a, b *Attachment) bool { return a.LastReference.Before(b.LastReference) },
+		index: func(a *Attachment) *int { return &a.refIndex },
+	}
+}
+
+// newExpiryHeap returns a heap of attachments ordered by url expiry.
+func newExpiryHeap() *attachmentHeap {
+	return &attachmentHeap{
+		less:  func(a, b *Attachment) bool { return a.Expires.Before(b.Expires) },
+		index: func(a *Attachment) *int { return &a.expiryIndex },
+	}
+}
+
+// newValueHeap returns a heap of attachments ordered by their value under an
+// LFU policy, optionally weighted by size.
+func newValueHeap(weighted bool) *attachmentHeap {
+	return &attachmentHeap{
+		less:  func(a, b *Attachment) bool { return a.value(weighted) < b.value(weighted) },
+		index: func(a *Attachment) *int { return &a.valueIndex },
+	}
+}
+
+func (h *attachmentHeap) Len() int           { return len(h.items) }
+func (h *attachmentHeap) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+
+func (h *attachmentHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	*h.index(h.items[i]) = i
+	*h.index(h.items[j]) = j
+}
+
+func (h *attachmentHeap) Push(x interface{}) {
+	a := x.(*Attachment)
+	*h.index(a) = len(h.items)
+	h.items = append(h.items, a)
+}
+
+func (h *attachmentHeap) Pop() interface{} {
+	n := len(h.items) - 1
+	a := h.items[n]
+	h.items[n] = nil
+	h.items = h.items[:n]
+	*h.index(a) = -1
+	return a
+}
+
+// add inserts a into the heap.
+func (h *attachmentHeap) add(a *Attachment) {
+	heap.Push(h, a)
+}
+
+// remove removes a from the heap, if present.
+func (h *attachmentHeap) remove(a *Attachment) {
+	if i := *h.index(a); i >= 0 && i < len(h.items) && h.items[i] == a {
+		heap.Remove(h, i)
+	}
+}
+
+// fix restores the order of the heap after the key of a has changed.
+func (h *attachmentHeap) fix(a *Attachment) {
+	if i := *h.index(a); i >= 0 && i < len(h.items) && h.items[i] == a {
+		heap.Fix(h, i)
+	}
+}
+
+// reset removes every attachment from the heap.
+func (h *attachmentHeap) reset() {
+	h.items = nil
+}
+
+// ascend calls fn for each attachment in ascending order until fn returns
+// false, without changing the heap. Visiting the first k attachments takes
+// O(k log k) time, however large the heap.
+func (h *attachmentHeap) ascend(fn func(a *Attachment) bool) {
+	if len(h.items) == 0 {
+		return
+	}
+
+	// The frontier of unvisited nodes whose parents have been visited, of
+	// which the least is always the next in order
+	frontier := &nodeHeap{h: h, nodes: []int{0}}
+	for frontier.Len() > 0 {
+		i := heap.Pop(frontier).(int)
+		if !fn(h.items[i]) {
+			return
+		}
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(h.items) {
+				heap.Push(frontier, child)
+			}
+		}
+	}
+}
+
+// nodeHeap is a min-heap of the positions of attachments in h, ordered as h.
+type nodeHeap struct {
+	h     *attachmentHeap
+	nodes []int
+}
+
+func (n *nodeHeap) Len() int           { return len(n.nodes) }
+func (n *nodeHeap) Less(i, j int) bool { return n.h.Less(n.nodes[i], n.nodes[j]) }
+func (n *nodeHeap) Swap(i, j int)      { n.nodes[i], n.nodes[j] = n.nodes[j], n.nodes[i] }
+func (n *nodeHeap) Push(x interface{}) { n.nodes = append(n.nodes, x.(int)) }
+
+func (n *nodeHeap) Pop() interface{} {
+	i := n.nodes[len(n.nodes)-1]
+	n.nodes = n.nodes[:len(n.nodes)-1]
+	return i
+}
@@ -0,0 +1,23 @@
+package cache
+
+import "github.com/bwmarrin/discordgo"
+
+// RangeChannels calls fn for each cached channel which has not outlived its
+// TTL, in no particular order (but see WithDeterministicOrder), stopping early
+// if fn returns false. The entries are snapshotted before fn is first called
+// and no lock is held while it runs, so fn may safely call back into the cache,
+// for example to invalidate the channel. Consequently, channels inserted or
+// removed during the iteration may or may not be visited.
+func (c *Cache) RangeChannels(fn func(ID string, ch discordgo.Channel) bool) {
+	c.channels.rangeAll(fn)
+}
+
+// RangeUsers is like RangeChannels, but for users.
+func (c *Cache) RangeUsers(fn func(ID string, u discordgo.User) bool) {
+	c.users.rangeAll(fn)
+}
+
+// RangeGuilds is like RangeChannels, but for guilds.
+func (c *Cache) RangeGuilds(fn func(ID string, g discordgo.Guild) bool) {
+	c.guilds.rangeAll(fn)
+}
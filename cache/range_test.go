@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRange(t *testing.T) {
+	c := NewCache(MockProvider{}, WithTTL(TypeUser, time.Minute))
+	for i := 0; i < 10; i++ {
+		u := discordgo.User{ID: strconv.Itoa(i)}
+		c.users.set(u.ID, newEntry(&u, time.Now()))
+	}
+	expired := discordgo.User{ID: "expired"}
+	c.users.set("expired", &entry[discordgo.User]{val: &expired, inserted: time.Now().Add(-time.Hour)})
+
+	// Evicting from within the iteration must not deadlock
+	seen := make(map[string]bool)
+	c.RangeUsers(func(ID string, u discordgo.User) bool {
+		if ID != u.ID {
+			t.Errorf("wrong user for ID\nexpect: %s\ngot: %s", ID, u.ID)
+		}
+		seen[ID] = true
+		c.InvalidateUser(ID)
+		return true
+	})
+	if len(seen) != 10 || seen["expired"] {
+		t.Errorf("wrong users visited: %v", seen)
+	}
+	if c.UserLen() != 1 {
+		t.Errorf("wrong length after evicting in range\nexpect: 1\ngot: %d", c.UserLen())
+	}
+
+	c.Channel("1234")
+	testguild := discordgo.Guild{ID: "a"}
+	c.guilds.set("a", newEntry(&testguild, time.Now()))
+	c.guilds.set("b", newEntry(&testguild, time.Now()))
+
+	n := 0
+	c.RangeChannels(func(string, discordgo.Channel) bool { n++; return true })
+	if n != 1 {
+		t.Errorf("wrong number of channels visited\nexpect: 1\ngot: %d", n)
+	}
+
+	// Stopping early
+	n = 0
+	c.RangeGuilds(func(string, discordgo.Guild) bool { n++; return false })
+	if n != 1 {
+		t.Errorf("iteration did not stop early\nexpect: 1\ngot: %d", n)
+	}
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitedProvider is a Provider which limits the rate of calls to another
+// Provider with a token bucket, smoothing the bursts of calls caused by a cold
+// cache or mass invalidation. Each call blocks until a token is available.
+// This is independent of, and applies before, any rate limiting done by the
+// wrapped provider itself.
+//
+// Calls which the wrapped provider reports were rejected by a Discord rate
+// limit, such as when discordgo is configured not to retry them itself, are
+// retried once the limit resets, as told by the error or the Retry-After
+// header of the response, up to DefaultRetryAttempts attempts in total (but
+// see SetRetryAttempts). Once no attempts remain, or if the limit resets after
+// MaxRetryAfter, the call fails with a RateLimitError.
+type RateLimitedProvider struct {
+	provider Provider
+	limiter  *rate.Limiter
+	attempts int
+}
+
+// NewRateLimitedProvider returns a provider which calls p at most r times per
+// second on average, allowing bursts of up to burst calls.
+func NewRateLimitedProvider(p Provider, r rate.Limit, burst int) *RateLimitedProvider {
+	return &RateLimitedProvider{
+		provider: p,
+		limiter:  rate.NewLimiter(r, burst),
+		attempts: DefaultRetryAttempts,
+	}
+}
+
+// SetRetryAttempts sets the number of attempts made in total at each call
+// rejected by a rate limit. Setting n to one disables retries. It must not be
+// called concurrently with calls to p.
+func (p *RateLimitedProvider) SetRetryAttempts(n int) {
+	p.attempts = n
+}
+
+// Wait blocks until a call may be made to the wrapped provider, or returns the
+// context's error if ctx is done first.
+func (p *RateLimitedProvider) Wait(ctx context.Context) error {
+	return p.limiter.Wait(ctx)
+}
+
+// retryLimited makes the call fn through p once a token is available, retrying
+// calls rejected by a rate limit as documented on RateLimitedProvider.
+func retryLimited[T any](ctx context.Context, p *RateLimitedProvider, fn func() (T, error)) (T, error) {
+	var zero T
+	for attempt := 1; ; attempt++ {
+		if err := p.Wait(ctx); err != nil {
+			return zero, err
+		}
+		v, err := fn()
+		wait, limited := rateLimitWait(err)
+		if !limited {
+			return v, err
+		}
+		if attempt >= p.attempts || wait > MaxRetryAfter {
+			return zero, &RateLimitError{RetryAfter: wait, Err: err}
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return zero, err
+		}
+	}
+}
+
+func (p *RateLimitedProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	return p.ChannelContext(context.Background(), channelID)
+}
+
+func (p *RateLimitedProvider) ChannelContext(ctx context.Context, channelID string) (*discordgo.Channel, error) {
+	return retryLimited(ctx, p, func() (*discordgo.Channel, error) { return fetchChannel(ctx, p.provider, channelID) })
+}
+
+func (p *RateLimitedProvider) User(userID string) (*discordgo.User, error) {
+	return p.UserContext(context.Background(), userID)
+}
+
+func (p *RateLimitedProvider) UserContext(ctx context.Context, userID string) (*discordgo.User, error) {
+	return retryLimited(ctx, p, func() (*discordgo.User, error) { return fetchUser(ctx, p.provider, userID) })
+}
+
+func (p *RateLimitedProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	return p.GuildContext(context.Background(), guildID)
+}
+
+func (p *RateLimitedProvider) GuildContext(ctx context.Context, guildID string) (*discordgo.Guild, error) {
+	return retryLimited(ctx, p, func() (*discordgo.Guild, error) { return fetchGuild(ctx, p.provider, guildID) })
+}
+
+func (p *RateLimitedProvider) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	return p.GuildMemberContext(context.Background(), guildID, userID)
+}
+
+func (p *RateLimitedProvider) GuildMemberContext(ctx context.Context, guildID, userID string) (*discordgo.Member, error) {
+	return retryLimited(ctx, p, func() (*discordgo.Member, error) { return fetchMember(ctx, p.provider, guildID, userID) })
+}
+
+func (p *RateLimitedProvider) GuildRoles(guildID string) ([]*discordgo.Role, error) {
+	return p.GuildRolesContext(context.Background(), guildID)
+}
+
+func (p *RateLimitedProvider) GuildRolesContext(ctx context.Context, guildID string) ([]*discordgo.Role, error) {
+	return retryLimited(ctx, p, func() ([]*discordgo.Role, error) { return fetchRoles(ctx, p.provider, guildID) })
+}
+
+func (p *RateLimitedProvider) GuildEmojis(guildID string) ([]*discordgo.Emoji, error) {
+	return p.GuildEmojisContext(context.Background(), guildID)
+}
+
+func (p *RateLimitedProvider) GuildEmojisContext(ctx context.Context, guildID string) ([]*discordgo.Emoji, error) {
+	return retryLimited(ctx, p, func() ([]*discordgo.Emoji, error) { return fetchEmojis(ctx, p.provider, guildID) })
+}
+
+func (p *RateLimitedProvider) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	return p.GuildChannelsContext(context.Background(), guildID)
+}
+
+func (p *RateLimitedProvider) GuildChannelsContext(ctx context.Context, guildID string) ([]*discordgo.Channel, error) {
+	return retryLimited(ctx, p, func() ([]*discordgo.Channel, error) { return fetchGuildChannels(ctx, p.provider, guildID) })
+}
+
+func (p *RateLimitedProvider) Sticker(stickerID string) (*discordgo.Sticker, error) {
+	return p.StickerContext(context.Background(), stickerID)
+}
+
+func (p *RateLimitedProvider) StickerContext(ctx context.Context, stickerID string) (*discordgo.Sticker, error) {
+	return retryLimited(ctx, p, func() (*discordgo.Sticker, error) { return fetchSticker(ctx, p.provider, stickerID) })
+}
+
+func (p *RateLimitedProvider) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	return p.ChannelMessageContext(context.Background(), channelID, messageID)
+}
+
+func (p *RateLimitedProvider) ChannelMessageContext(ctx context.Context, channelID, messageID string) (*discordgo.Message, error) {
+	return retryLimited(ctx, p, func() (*discordgo.Message, error) { return fetchMessage(ctx, p.provider, channelID, messageID) })
+}
+
+func (p *RateLimitedProvider) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	return p.ChannelMessagesContext(context.Background(), channelID, limit, beforeID, afterID, aroundID)
+}
+
+func (p *RateLimitedProvider) ChannelMessagesContext(ctx context.Context, channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	return retryLimited(ctx, p, func() ([]*discordgo.Message, error) {
+		return fetchChannelMessages(ctx, p.provider, channelID, limit, beforeID, afterID, aroundID)
+	})
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/time/rate"
+)
+
+// LimitedProvider is a provider whose first limited lookups of users are
+// rejected by a rate limit, with the error err returns.
+type LimitedProvider struct {
+	MockProvider
+	limited int32
+	calls   int32
+	err     func() error
+}
+
+func (p *LimitedProvider) User(userID string) (*discordgo.User, error) {
+	if atomic.AddInt32(&p.calls, 1) <= p.limited {
+		return nil, p.err()
+	}
+	return p.MockProvider.User(userID)
+}
+
+func TestRateLimitedProvider(t *testing.T) {
+	p := NewRateLimitedProvider(MockProvider{}, rate.Every(50*time.Millisecond), 1)
+	c := NewCache(p)
+
+	start := time.Now()
+	for _, id := range []string{"1", "2", "3"} {
+		c.Channel(id)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("provider calls were not rate limited\nexpect: >=100ms\ngot: %s", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.Wait(ctx); err == nil {
+		t.Error("wait succeeded with done context")
+	}
+}
+
+func TestRateLimitedProviderRetry(t *testing.T) {
+	discordLimit := func(d time.Duration) func() error {
+		return func() error {
+			return &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{
+				TooManyRequests: &discordgo.TooManyRequests{RetryAfter: d},
+			}}
+		}
+	}
+	restLimit := func(retryAfter string) func() error {
+		return func() error {
+			hdr := make(http.Header)
+			hdr.Set("Retry-After", retryAfter)
+			return &discordgo.RESTError{Response: &http.Response{StatusCode: http.StatusTooManyRequests, Header: hdr}}
+		}
+	}
+
+	cases := []struct {
+		Name     string
+		Limited  int32
+		Err      func() error
+		Attempts int
+		Calls    int32
+		Wait     time.Duration
+		Failed   bool
+	}{
+		{"Recovers", 2, discordLimit(20 * time.Millisecond), 3, 3, 40 * time.Millisecond, false},
+		{"RetryAfterHeader", 1, restLimit("0.02"), 3, 2, 20 * time.Millisecond, false},
+		{"Exhausted", 5, discordLimit(time.Millisecond), 3, 3, 0, true},
+		{"TooLong", 5, discordLimit(time.Hour), 3, 1, 0, true},
+		{"SingleShot", 5, discordLimit(time.Millisecond), 1, 1, 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			lp := &LimitedProvider{limited: tc.Limited, err: tc.Err}
+			p := NewRateLimitedProvider(lp, rate.Inf, 1)
+			p.SetRetryAttempts(tc.Attempts)
+
+			start := time.Now()
+			u, err := p.User("5678")
+			if d := time.Since(start); d < tc.Wait {
+				t.Errorf("retried before the rate limit reset\nexpect: >=%s\ngot: %s", tc.Wait, d)
+			}
+			if lp.calls != tc.Calls {
+				t.Errorf("wrong number of calls\nexpect: %d\ngot: %d", tc.Calls, lp.calls)
+			}
+			if !tc.Failed {
+				if err != nil || u.Username != "Testing User" {
+					t.Errorf("lookup did not recover from rate limit: %v", err)
+				}
+				return
+			}
+
+			var rlerr *RateLimitError
+			if !errors.Is(err, ErrRateLimited) || !errors.As(err, &rlerr) {
+				t.Fatalf("wrong error\nexpect: %v\ngot: %v", ErrRateLimited, err)
+			}
+			if expect, _ := rateLimitWait(tc.Err()); rlerr.RetryAfter != expect {
+				t.Errorf("wrong retry after\nexpect: %s\ngot: %s", expect, rlerr.RetryAfter)
+			}
+			if ClassifyError(err) != ErrorRateLimited {
+				t.Errorf("wrong error class\nexpect: %s\ngot: %s", ErrorRateLimited, ClassifyError(err))
+			}
+		})
+	}
+
+	// Waits for a limit to reset end with the context
+	lp := &LimitedProvider{limited: 5, err: discordLimit(time.Second)}
+	p := NewRateLimitedProvider(lp, rate.Inf, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.UserContext(ctx, "5678"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error from wait beyond deadline\nexpect: %v\ngot: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		Header, Value string
+		Expect        time.Duration
+		OK            bool
+	}{
+		{"Retry-After", "3", 3 * time.Second, true},
+		{"Retry-After", "1.5", 1500 * time.Millisecond, true},
+		{"Retry-After", now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"Retry-After", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"X-RateLimit-Reset-After", "0.25", 250 * time.Millisecond, true},
+		{"Retry-After", "soon", 0, false},
+		{"Retry-After", "-1", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tc := range cases {
+		h := make(http.Header)
+		if tc.Header != "" {
+			h.Set(tc.Header, tc.Value)
+		}
+		if d, ok := parseRetryAfter(h, now); d != tc.Expect || ok != tc.OK {
+			t.Errorf("%s: %q: wrong wait\nexpect: %s (%t)\ngot: %s (%t)", tc.Header, tc.Value, tc.Expect, tc.OK, d, ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import "github.com/bwmarrin/discordgo"
+
+// After the gateway disconnects, the session either resumes, replaying the
+// events missed in the meantime, or starts afresh with a new READY payload,
+// in which case the events missed are lost. The cache tracks which happens, so
+// that it can invalidate whatever may have gone stale: a little after a resume
+// (see WithResumeFlush), and more after a fresh start (see WithReadyFlush).
+
+// Object types invalidated on reconnecting to the gateway by default.
+var (
+	defaultResumeFlush = []ObjectType{TypeMember}
+	defaultReadyFlush  = []ObjectType{
+		TypeChannel, TypeUser, TypeGuild, TypeMember,
+		TypeRole, TypeEmoji, TypeSticker, TypeMessage, TypeHistory,
+	}
+)
+
+// HandleDisconnect records that the session has disconnected from the gateway,
+// such that the cache is flushed once it reconnects (see HandleResumed and
+// HandleReady).
+func (c *Cache) HandleDisconnect(e *discordgo.Disconnect) {
+	c.disconnected.Store(true)
+}
+
+// HandleResumed invalidates the object types set with WithResumeFlush if the
+// session has resumed after disconnecting.
+func (c *Cache) HandleResumed(e *discordgo.Resumed) {
+	if c.disconnected.Swap(false) {
+		c.invalidateTypes(c.resumeFlush)
+	}
+}
+
+// flushAfterReady invalidates the object types set with WithReadyFlush if the
+// session has started afresh after disconnecting.
+func (c *Cache) flushAfterReady() {
+	if c.disconnected.Swap(false) {
+		c.invalidateTypes(c.readyFlush)
+	}
+}
+
+// FlushOnDisconnect registers handlers on s which flush the cache as the
+// session reconnects to the gateway, as HandleDisconnect, HandleResumed and
+// HandleReady do, but without otherwise caching anything from events. It
+// returns a function which removes the handlers again. RegisterHandlers
+// already registers the same handlers, so the two need not be combined.
+func (c *Cache) FlushOnDisconnect(s *discordgo.Session) (remove func()) {
+	removers := []func(){
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.Disconnect) { c.HandleDisconnect(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.Resumed) { c.HandleResumed(e) }),
+		s.AddHandler(func(_ *discordgo.Session, e *discordgo.Ready) { c.flushAfterReady() }),
+	}
+
+	return func() {
+		for _, r := range removers {
+			r()
+		}
+	}
+}
+
+// invalidateTypes invalidates every cached object of each of types.
+func (c *Cache) invalidateTypes(types []ObjectType) {
+	for _, t := range types {
+		switch t {
+		case TypeChannel:
+			c.InvalidateAllChannels()
+		case TypeUser:
+			c.InvalidateAllUsers()
+		case TypeGuild:
+			c.InvalidateAllGuilds()
+		case TypeMember:
+			c.InvalidateAllMembers()
+		case TypeRole:
+			c.InvalidateAllRoles()
+		case TypeEmoji:
+			c.InvalidateAllEmojis()
+		case TypeSticker:
+			c.InvalidateAllStickers()
+		case TypeMessage:
+			c.InvalidateAllMessages()
+		case TypeHistory:
+			c.InvalidateAllHistories()
+		case TypeAttachment:
+			c.InvalidateAllAttachments()
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// RefreshChannel fetches the channel ID from the provider whether or not it is
+// cached, replacing any cached entry with the fresh channel, for example when
+// the channel is known to have changed. Unlike invalidating the channel and
+// looking it up again, the cached entry remains in place until the fresh
+// channel replaces it, so concurrent lookups are never left to miss. If the
+// provider fails, its error is returned and the cached entry is left as is.
+// A refresh is not a lookup, so it is not counted as a hit or a miss.
+func (c *Cache) RefreshChannel(ID string) (discordgo.Channel, error) {
+	v, err := c.channels.refresh(context.Background(), ID, func(ctx context.Context) (*discordgo.Channel, error) {
+		return fetchChannel(ctx, c.provider, ID)
+	})
+	if err != nil {
+		return discordgo.Channel{}, err
+	}
+
+	return *v, nil
+}
+
+// RefreshUser is like RefreshChannel, but for users.
+func (c *Cache) RefreshUser(ID string) (discordgo.User, error) {
+	v, err := c.users.refresh(context.Background(), ID, func(ctx context.Context) (*discordgo.User, error) {
+		return fetchUser(ctx, c.provider, ID)
+	})
+	if err != nil {
+		return discordgo.User{}, err
+	}
+
+	return *v, nil
+}
+
+// RefreshGuild is like RefreshChannel, but for guilds.
+func (c *Cache) RefreshGuild(ID string) (discordgo.Guild, error) {
+	v, err := c.guilds.refresh(context.Background(), ID, func(ctx context.Context) (*discordgo.Guild, error) {
+		return fetchGuild(ctx, c.provider, ID)
+	})
+	if err != nil {
+		return discordgo.Guild{}, err
+	}
+
+	return *v, nil
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ChangingProvider returns objects named after its current name, or its error
+// if set.
+type ChangingProvider struct {
+	Name string
+	Err  error
+}
+
+func (p *ChangingProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	return &discordgo.Channel{ID: channelID, Name: p.Name}, nil
+}
+
+func (p *ChangingProvider) User(userID string) (*discordgo.User, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	return &discordgo.User{ID: userID, Username: p.Name}, nil
+}
+
+func (p *ChangingProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	return &discordgo.Guild{ID: guildID, Name: p.Name}, nil
+}
+
+func TestRefresh(t *testing.T) {
+	p := &ChangingProvider{Name: "Old"}
+	c := NewCache(p)
+	c.Channel("1")
+	c.User("1")
+	c.Guild("1")
+
+	p.Name = "New"
+	if ch, err := c.RefreshChannel("1"); err != nil || ch.Name != "New" {
+		t.Error("failed to refresh channel:", err)
+	}
+	if u, err := c.RefreshUser("1"); err != nil || u.Username != "New" {
+		t.Error("failed to refresh user:", err)
+	}
+	if g, err := c.RefreshGuild("1"); err != nil || g.Name != "New" {
+		t.Error("failed to refresh guild:", err)
+	}
+	if ch, _ := c.Channel("1"); ch.Name != "New" {
+		t.Errorf("refresh did not replace cached channel\nexpect: %s\ngot: %s", "New", ch.Name)
+	}
+
+	// Failed refreshes leave the cached entry in place
+	errTest := errors.New("refresh failed")
+	p.Name, p.Err = "Newer", errTest
+	if _, err := c.RefreshChannel("1"); !errors.Is(err, errTest) {
+		t.Errorf("wrong error from failed refresh\nexpect: %v\ngot: %v", errTest, err)
+	}
+	if ch, err := c.Channel("1"); err != nil || ch.Name != "New" {
+		t.Error("failed refresh removed cached channel:", err)
+	}
+
+	// Refreshing an uncached object inserts it
+	p.Err = nil
+	c.RefreshUser("2")
+	if !c.HasUser("2") {
+		t.Error("refreshed user was not cached")
+	}
+	if s := c.Stats().User; s.Hits != 0 || s.Misses != 1 {
+		t.Errorf("refresh was counted as a lookup: %+v", s)
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ErrRateLimited is matched by every RateLimitError.
+var ErrRateLimited = errors.New("cache: rate limited")
+
+// MaxRetryAfter is the longest the cache waits for a rate limit to reset
+// before retrying a request. A request rejected by a limit which resets later
+// fails at once with a RateLimitError, rather than blocking for the window.
+const MaxRetryAfter = 30 * time.Second
+
+// A RateLimitError is returned when a request has been rejected by a rate limit
+// on every attempt allowed, or by a limit which resets after MaxRetryAfter. It
+// matches ErrRateLimited, and wraps the error of the last attempt.
+type RateLimitError struct {
+	// RetryAfter is how long the last attempt was told to wait before
+	// retrying, or zero if it was not told.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: retry after %s: %s", ErrRateLimited.Error(), e.RetryAfter, e.Err.Error())
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// parseRetryAfter returns how long the response with header h asks to be
+// waited for before retrying, from its Retry-After header, in seconds or as
+// an HTTP date, or from the X-RateLimit-Reset-After header Discord sends with
+// fractional seconds. False is returned if h carries neither.
+func parseRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	for _, name := range []string{"X-RateLimit-Reset-After", "Retry-After"} {
+		v := h.Get(name)
+		if v == "" {
+			continue
+		}
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := t.Sub(now); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+	}
+
+	return 0, false
+}
+
+// rateLimitWait returns whether err, an error from a provider, is a rejection
+// by a rate limit, and if so, how long it asks to be waited for before
+// retrying, or zero if it does not say.
+func rateLimitWait(err error) (time.Duration, bool) {
+	if ClassifyError(err) != ErrorRateLimited {
+		return 0, false
+	}
+
+	var rlerr *discordgo.RateLimitError
+	if errors.As(err, &rlerr) && rlerr.RateLimit != nil && rlerr.TooManyRequests != nil {
+		return rlerr.RetryAfter, true
+	}
+	var rlval discordgo.RateLimitError
+	if errors.As(err, &rlval) && rlval.RateLimit != nil && rlval.TooManyRequests != nil {
+		return rlval.RetryAfter, true
+	}
+	var rerr *discordgo.RESTError
+	if errors.As(err, &rerr) && rerr.Response != nil {
+		d, _ := parseRetryAfter(rerr.Response.Header, time.Now())
+		return d, true
+	}
+
+	return 0, true
+}
+
+// sleepContext waits for d, returning the context's error if ctx is done
+// first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// roleSet is the full set of roles of a guild, keyed by role ID.
+type roleSet map[string]*discordgo.Role
+
+// Role looks up and returns the role roleID of guild guildID. The first lookup
+// of any role in a guild fetches and caches every role of that guild, such
+// that subsequent lookups of any role in the guild are served from the cache
+// until the guild's roles are older than the role TTL (see WithTTL) or are
+// invalidated with InvalidateGuildRoles. If the guild's roles could not be
+// fetched, error is returned from the discord API. If the roles were fetched
+// but contain no role roleID, ErrMissing is returned. If the provider cannot
+// look up roles (see RoleProvider), ErrUnsupported is returned.
+func (c *Cache) Role(guildID, roleID string) (discordgo.Role, error) {
+	return c.RoleContext(context.Background(), guildID, roleID)
+}
+
+// RoleContext is like Role, but stops waiting for the provider and returns the
+// context's error if ctx is done before the lookup completes.
+func (c *Cache) RoleContext(ctx context.Context, guildID, roleID string) (discordgo.Role, error) {
+	roles, err := c.guildRoles(ctx, guildID)
+	if err != nil {
+		return discordgo.Role{}, err
+	}
+
+	r, ok := roles[roleID]
+	if !ok {
+		return discordgo.Role{}, ErrMissing
+	}
+
+	return *r, nil
+}
+
+// guildRoles returns the cached role set of guild guildID, fetching it from
+// the provider on a miss.
+func (c *Cache) guildRoles(ctx context.Context, guildID string) (roleSet, error) {
+	v, err := c.roles.lookup(ctx, guildID, func(ctx context.Context) (*roleSet, error) {
+		roles, err := fetchRoles(ctx, c.provider, guildID)
+		if err != nil {
+			return nil, err
+		}
+
+		set := make(roleSet, len(roles))
+		for _, r := range roles {
+			set[r.ID] = r
+		}
+		return &set, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return *v, nil
+}
+
+// InvalidateGuildRoles invalidates the cached roles of guild guildID, such
+// that the next role lookup in the guild re-fetches all of them. This should
+// be called whenever a role of the guild is created, updated or deleted.
+func (c *Cache) InvalidateGuildRoles(guildID string) error {
+	return c.roles.invalidate(guildID)
+}
+
+// InvalidateAllRoles invalidates the cached roles of every guild.
+func (c *Cache) InvalidateAllRoles() {
+	c.roles.invalidateAll()
+}
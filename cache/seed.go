@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// SeedChannels inserts each of channels into the cache without calling the
+// provider, for example to warm the cache with the channels already sent in
+// the gateway's READY payload. A channel which is already cached is replaced
+// by its seeded copy, and nil channels are skipped.
+func (c *Cache) SeedChannels(channels []*discordgo.Channel) {
+	for _, ch := range channels {
+		if ch != nil {
+			c.channels.replace(ch.ID, ch)
+		}
+	}
+}
+
+// SeedUsers is like SeedChannels, but for users.
+func (c *Cache) SeedUsers(users []*discordgo.User) {
+	for _, u := range users {
+		if u != nil {
+			c.users.replace(u.ID, u)
+		}
+	}
+}
+
+// SeedGuilds is like SeedChannels, but for guilds.
+func (c *Cache) SeedGuilds(guilds []*discordgo.Guild) {
+	for _, g := range guilds {
+		if g != nil {
+			c.guilds.replace(g.ID, g)
+		}
+	}
+}
+
+// SeedFromReady warms the cache with the objects carried by the gateway's READY
+// payload r without calling the provider: the user of the session, its private
+// channels, and each of its guilds as by SeedGuild. Guilds which are sent as
+// unavailable stubs, as they are in READY payloads until their GUILD_CREATE
+// event arrives, are skipped (but see HandleGuildCreate).
+func (c *Cache) SeedFromReady(r *discordgo.Ready) {
+	if r.User != nil {
+		c.users.replace(r.User.ID, r.User)
+	}
+	c.SeedChannels(r.PrivateChannels)
+	for _, g := range r.Guilds {
+		c.SeedGuild(g)
+	}
+}
+
+// SeedGuild inserts g into the cache without calling the provider, along with
+// whichever of its channels, roles, emojis, stickers and members it carries,
+// for example from a GUILD_CREATE event. The members' users are cached too. The
+// cached roles and emojis of the guild are replaced by those of g, if it has
+// any. Unavailable guilds, which carry nothing but their ID, are skipped. As g
+// may be the guild held by the state of the session, which modifies it in
+// place, g and the objects it carries are copied before they are cached.
+func (c *Cache) SeedGuild(g *discordgo.Guild) {
+	if g == nil || g.Unavailable {
+		return
+	}
+
+	g = copyGuild(g)
+	c.guilds.replace(g.ID, g)
+	for _, ch := range g.Channels {
+		if ch == nil {
+			continue
+		}
+		// Channels sent within a guild omit their guild ID
+		cp := *ch
+		if cp.GuildID == "" {
+			cp.GuildID = g.ID
+		}
+		c.channels.replace(cp.ID, &cp)
+	}
+	if len(g.Roles) > 0 {
+		set := make(roleSet, len(g.Roles))
+		for _, r := range g.Roles {
+			if r != nil {
+				set[r.ID] = r
+			}
+		}
+		c.roles.replace(g.ID, &set)
+	}
+	if len(g.Emojis) > 0 {
+		set := make(emojiSet, len(g.Emojis))
+		for _, em := range g.Emojis {
+			if em != nil {
+				set[em.ID] = em
+			}
+		}
+		c.emojis.replace(g.ID, &set)
+	}
+	for _, st := range g.Stickers {
+		if st != nil {
+			c.stickers.replace(st.ID, st)
+		}
+	}
+	for _, m := range g.Members {
+		if m != nil && m.User != nil {
+			// Members sent within a guild omit their guild ID
+			cp := *m
+			cp.GuildID = g.ID
+			c.members.replace(memberKey(g.ID, m.User.ID), &cp)
+			c.users.replace(m.User.ID, m.User)
+		}
+	}
+}
+
+// AbsorbMessage inserts the users and members embedded in m into the cache
+// without calling the provider, for example from a MESSAGE_CREATE event, such
+// that the users a message is about to be rendered with are already cached:
+// its author, the users it mentions, and the member of its author if it was
+// sent in a guild, along with those of the message it replies to. Users and
+// members already cached are replaced by their copies from m. The authors of
+// messages sent by webhooks are not real users, so are skipped. The message
+// itself is not cached (but see HandleMessageCreate).
+func (c *Cache) AbsorbMessage(m *discordgo.Message) {
+	if m == nil {
+		return
+	}
+
+	if m.Author != nil && m.WebhookID == "" {
+		c.users.replace(m.Author.ID, m.Author)
+		// Members sent with a message omit their user and guild
+		if m.Member != nil && m.GuildID != "" {
+			cp := *m.Member
+			cp.User = m.Author
+			cp.GuildID = m.GuildID
+			c.members.replace(memberKey(m.GuildID, m.Author.ID), &cp)
+		}
+	}
+	c.SeedUsers(m.Mentions)
+	if m.ReferencedMessage != nil && m.ReferencedMessage != m {
+		c.AbsorbMessage(m.ReferencedMessage)
+	}
+}
+
+// SetChannelWithTTL inserts ch into the cache like SeedChannels, but the entry
+// expires after ttl rather than the channel TTL (see WithTTL), for example to
+// keep frequently used channels cached for longer. If ttl is NeverExpire, the
+// entry never expires, although it may still be invalidated or, if the cache
+// is bounded with WithMaxEntries, evicted. A zero ttl uses the channel TTL.
+func (c *Cache) SetChannelWithTTL(ch *discordgo.Channel, ttl time.Duration) {
+	c.channels.replaceWithTTL(ch.ID, ch, ttl)
+}
+
+// SetUserWithTTL is like SetChannelWithTTL, but for users.
+func (c *Cache) SetUserWithTTL(u *discordgo.User, ttl time.Duration) {
+	c.users.replaceWithTTL(u.ID, u, ttl)
+}
+
+// SetGuildWithTTL is like SetChannelWithTTL, but for guilds.
+func (c *Cache) SetGuildWithTTL(g *discordgo.Guild, ttl time.Duration) {
+	c.guilds.replaceWithTTL(g.ID, g, ttl)
+}
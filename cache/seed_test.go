@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSeed(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p)
+	c.Guild("9101112")
+
+	c.SeedChannels([]*discordgo.Channel{{ID: "1", Name: "Seeded"}, nil})
+	c.SeedUsers([]*discordgo.User{{ID: "2", Username: "Seeded"}})
+	c.SeedGuilds([]*discordgo.Guild{{ID: "9101112", Name: "Seeded"}})
+
+	if ch, err := c.Channel("1"); err != nil || ch.Name != "Seeded" {
+		t.Error("failed to retrieve seeded channel:", err)
+	}
+	if u, err := c.User("2"); err != nil || u.Username != "Seeded" {
+		t.Error("failed to retrieve seeded user:", err)
+	}
+	if g, err := c.Guild("9101112"); err != nil || g.Name != "Seeded" {
+		t.Error("seeding did not overwrite cached guild:", err)
+	}
+	if p.calls != 1 {
+		t.Errorf("seeded lookups caused provider calls\nexpect: 1\ngot: %d", p.calls)
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	c := NewCache(MockProvider{}, WithTTL(TypeChannel, time.Minute))
+	c.SetChannelWithTTL(&discordgo.Channel{ID: "pinned"}, NeverExpire)
+	c.SetChannelWithTTL(&discordgo.Channel{ID: "long"}, 2*time.Hour)
+	c.SetChannelWithTTL(&discordgo.Channel{ID: "short"}, time.Second)
+	c.SetChannelWithTTL(&discordgo.Channel{ID: "default"}, 0)
+
+	for _, key := range []string{"pinned", "long", "short", "default"} {
+		e, _ := c.channels.get(key)
+		e.inserted = e.inserted.Add(-time.Hour)
+	}
+	c.Clean()
+
+	cases := []struct {
+		ID     string
+		Expect bool
+	}{
+		{"pinned", true},
+		{"long", true},
+		{"short", false},
+		{"default", false},
+	}
+	for _, tc := range cases {
+		if c.HasChannel(tc.ID) != tc.Expect {
+			t.Errorf("%s: wrong cache state after clean\nexpect cached: %t", tc.ID, tc.Expect)
+		}
+	}
+
+	// Entry TTLs survive a snapshot
+	var buf bytes.Buffer
+	c.Save(&buf)
+	d := NewCache(MockProvider{}, WithTTL(TypeChannel, time.Minute))
+	d.Load(&buf)
+	if !d.HasChannel("pinned") {
+		t.Error("pinned channel was not restored from snapshot")
+	}
+}
+
+func TestSeedFromReady(t *testing.T) {
+	c := NewCache(&ErrorProvider{Err: errBroken})
+	c.SeedFromReady(&discordgo.Ready{
+		User:            &discordgo.User{ID: "1", Username: "Bot"},
+		PrivateChannels: []*discordgo.Channel{{ID: "2", Name: "DM"}},
+		Guilds: []*discordgo.Guild{
+			{
+				ID:       "3",
+				Name:     "Seeded",
+				Channels: []*discordgo.Channel{{ID: "4", Name: "general"}},
+				Roles:    []*discordgo.Role{{ID: "5", Name: "everyone"}},
+				Emojis:   []*discordgo.Emoji{{ID: "6", Name: "smile"}},
+				Stickers: []*discordgo.Sticker{{ID: "7", Name: "wave"}},
+				Members:  []*discordgo.Member{{User: &discordgo.User{ID: "8", Username: "Member"}, Nick: "Nick"}},
+			},
+			{ID: "9", Unavailable: true},
+		},
+	})
+
+	if u, err := c.User("1"); err != nil || u.Username != "Bot" {
+		t.Error("failed to retrieve seeded bot user:", err)
+	}
+	if ch, err := c.Channel("2"); err != nil || ch.Name != "DM" {
+		t.Error("failed to retrieve seeded private channel:", err)
+	}
+	if g, err := c.Guild("3"); err != nil || g.Name != "Seeded" {
+		t.Error("failed to retrieve seeded guild:", err)
+	}
+	if ch, err := c.Channel("4"); err != nil || ch.GuildID != "3" {
+		t.Errorf("wrong seeded guild channel\nexpect guild: 3\ngot: %q (%v)", ch.GuildID, err)
+	}
+	if r, err := c.Role("3", "5"); err != nil || r.Name != "everyone" {
+		t.Error("failed to retrieve seeded role:", err)
+	}
+	if em, err := c.Emoji("3", "6"); err != nil || em.Name != "smile" {
+		t.Error("failed to retrieve seeded emoji:", err)
+	}
+	if st, err := c.Sticker("7"); err != nil || st.Name != "wave" {
+		t.Error("failed to retrieve seeded sticker:", err)
+	}
+	if m, err := c.Member("3", "8"); err != nil || m.Nick != "Nick" || m.GuildID != "3" {
+		t.Errorf("wrong seeded member\nexpect guild: 3\ngot: %q (%v)", m.GuildID, err)
+	}
+	if u, err := c.User("8"); err != nil || u.Username != "Member" {
+		t.Error("failed to retrieve seeded member user:", err)
+	}
+
+	// Unavailable stubs are not cached
+	if _, err := c.Guild("9"); err == nil {
+		t.Error("unavailable guild stub was cached")
+	}
+}
+
+func TestAbsorbMessage(t *testing.T) {
+	p := &ErrorProvider{Err: notFoundError(0)}
+	c := NewCache(p)
+	c.SeedUsers([]*discordgo.User{{ID: "1", Username: "Old Name"}})
+
+	c.AbsorbMessage(&discordgo.Message{
+		ID:        "10",
+		ChannelID: "20",
+		GuildID:   "30",
+		Author:    &discordgo.User{ID: "1", Username: "New Name"},
+		Member:    &discordgo.Member{Nick: "Nickname"},
+		Mentions:  []*discordgo.User{{ID: "2", Username: "Mentioned"}, nil},
+		ReferencedMessage: &discordgo.Message{
+			ID:     "9",
+			Author: &discordgo.User{ID: "3", Username: "Replied To"},
+		},
+	})
+	c.AbsorbMessage(&discordgo.Message{
+		ID:        "11",
+		WebhookID: "40",
+		Author:    &discordgo.User{ID: "40", Username: "Webhook"},
+	})
+
+	users := map[string]string{"1": "New Name", "2": "Mentioned", "3": "Replied To"}
+	for id, name := range users {
+		if u, err := c.User(id); err != nil || u.Username != name {
+			t.Errorf("wrong user %s absorbed\nexpect: %s\ngot: %s (%v)", id, name, u.Username, err)
+		}
+	}
+	m, err := c.Member("30", "1")
+	if err != nil || m.Nick != "Nickname" || m.GuildID != "30" || m.User == nil || m.User.ID != "1" {
+		t.Errorf("wrong member absorbed: %+v (%v)", m, err)
+	}
+	if p.calls != 0 {
+		t.Errorf("absorbed entries called the provider\nexpect calls: 0\ngot: %d", p.calls)
+	}
+	if _, err := c.User("40"); err == nil {
+		t.Error("webhook author was absorbed as a user")
+	}
+	if _, ok := c.messages.get(messageKey("20", "10")); ok {
+		t.Error("absorbed message was cached")
+	}
+}
+
+func TestSeedGuildCopies(t *testing.T) {
+	c := NewCache(&ErrorProvider{Err: notFoundError(0)})
+	g := &discordgo.Guild{
+		ID:       "1",
+		Name:     "Seeded",
+		Channels: []*discordgo.Channel{{ID: "2", Name: "general"}},
+		Roles:    []*discordgo.Role{{ID: "3", Name: "everyone"}},
+		Emojis:   []*discordgo.Emoji{{ID: "4", Name: "smile"}},
+	}
+	c.SeedGuild(g)
+
+	// The state modifies its guilds in place as events arrive
+	*g = discordgo.Guild{ID: "1", Name: "Updated", Roles: g.Roles, Emojis: g.Emojis, Channels: g.Channels}
+	g.Channels[0].Name = "renamed"
+	g.Channels = append(g.Channels, &discordgo.Channel{ID: "5", Name: "added"})
+	g.Roles[0].Name = "renamed"
+	g.Emojis[0].Name = "renamed"
+
+	if cached, err := c.Guild("1"); err != nil || cached.Name != "Seeded" || len(cached.Channels) != 1 || cached.Channels[0].Name != "general" {
+		t.Errorf("cached guild changed with seeded guild: %+v (%v)", cached, err)
+	}
+	if r, err := c.Role("1", "3"); err != nil || r.Name != "everyone" {
+		t.Errorf("cached role changed with seeded guild\nexpect: %s\ngot: %s (%v)", "everyone", r.Name, err)
+	}
+	if em, err := c.Emoji("1", "4"); err != nil || em.Name != "smile" {
+		t.Errorf("cached emoji changed with seeded guild\nexpect: %s\ngot: %s (%v)", "smile", em.Name, err)
+	}
+	if ch, err := c.Channel("2"); err != nil || ch.Name != "general" {
+		t.Errorf("cached channel changed with seeded guild\nexpect: %s\ngot: %s (%v)", "general", ch.Name, err)
+	}
+}
@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// *SessionProvider implements every provider interface, including the context
+// providers.
+var (
+	_ Provider                       = (*SessionProvider)(nil)
+	_ ContextProvider                = (*SessionProvider)(nil)
+	_ MemberContextProvider          = (*SessionProvider)(nil)
+	_ RoleContextProvider            = (*SessionProvider)(nil)
+	_ EmojiContextProvider           = (*SessionProvider)(nil)
+	_ GuildChannelsContextProvider   = (*SessionProvider)(nil)
+	_ StickerContextProvider         = (*SessionProvider)(nil)
+	_ MessageContextProvider         = (*SessionProvider)(nil)
+	_ ChannelMessagesContextProvider = (*SessionProvider)(nil)
+)
+
+// SessionProvider is a Provider which looks up objects through the Discord API
+// with a discordgo session, like the session itself, but makes each request
+// with the context of the lookup, such that abandoned lookups cancel their
+// requests (see ContextProvider). Requests are authorised with the token of the
+// session, made with its HTTP client and limited by its rate limiter, and are
+// retried on rate limits and 502 Bad Gateway as the session configures (see
+// discordgo.Session.ShouldRetryOnRateLimit and MaxRestRetries), although waits
+// for a rate limit to reset are also abandoned once the context is done.
+//
+// A session makes its own requests without a context, so for lookups to be
+// cancellable the cache should be given a SessionProvider rather than the
+// session:
+//
+//	c := cache.NewCache(cache.NewSessionProvider(s))
+type SessionProvider struct {
+	session *discordgo.Session
+}
+
+// NewSessionProvider returns a provider which looks up objects with s.
+func NewSessionProvider(s *discordgo.Session) *SessionProvider {
+	return &SessionProvider{session: s}
+}
+
+// get requests urlStr from the Discord API with ctx, rate limited by the
+// bucket bucketID of the session, and decodes the response into v. Failed
+// requests are reported with the same errors as the session reports them.
+func (p *SessionProvider) get(ctx context.Context, urlStr, bucketID string, v interface{}) error {
+	s := p.session
+	for retries := 0; ; {
+		bucket := s.Ratelimiter.LockBucket(bucketID)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+		if err != nil {
+			bucket.Release(nil)
+			return err
+		}
+		if s.Token != "" {
+			req.Header.Set("authorization", s.Token)
+		}
+		req.Header.Set("User-Agent", s.UserAgent)
+
+		resp, err := s.Client.Do(req)
+		if err != nil {
+			bucket.Release(nil)
+			return err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err := bucket.Release(resp.Header); err != nil {
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if err := discordgo.Unmarshal(body, v); err != nil {
+				return fmt.Errorf("%w: %s", discordgo.ErrJSONUnmarshal, err)
+			}
+			return nil
+		case http.StatusTooManyRequests:
+			var tmr discordgo.TooManyRequests
+			if err := discordgo.Unmarshal(body, &tmr); err != nil {
+				return err
+			}
+			if !s.ShouldRetryOnRateLimit {
+				return &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{TooManyRequests: &tmr, URL: urlStr}}
+			}
+			if err := sleepContext(ctx, tmr.RetryAfter); err != nil {
+				return err
+			}
+		case http.StatusBadGateway:
+			if retries >= s.MaxRestRetries {
+				return fmt.Errorf("cache: exceeded max retries: HTTP %s, %s", resp.Status, body)
+			}
+			retries++
+		default:
+			rerr := &discordgo.RESTError{Request: req, Response: resp, ResponseBody: body}
+			if discordgo.Unmarshal(body, &rerr.Message) != nil {
+				rerr.Message = nil
+			}
+			return rerr
+		}
+	}
+}
+
+func (p *SessionProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	return p.ChannelContext(context.Background(), channelID)
+}
+
+func (p *SessionProvider) ChannelContext(ctx context.Context, channelID string) (st *discordgo.Channel, err error) {
+	err = p.get(ctx, discordgo.EndpointChannel(channelID), discordgo.EndpointChannel(channelID), &st)
+	return st, err
+}
+
+func (p *SessionProvider) User(userID string) (*discordgo.User, error) {
+	return p.UserContext(context.Background(), userID)
+}
+
+func (p *SessionProvider) UserContext(ctx context.Context, userID string) (st *discordgo.User, err error) {
+	err = p.get(ctx, discordgo.EndpointUser(userID), discordgo.EndpointUsers, &st)
+	return st, err
+}
+
+func (p *SessionProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	return p.GuildContext(context.Background(), guildID)
+}
+
+func (p *SessionProvider) GuildContext(ctx context.Context, guildID string) (st *discordgo.Guild, err error) {
+	err = p.get(ctx, discordgo.EndpointGuild(guildID), discordgo.EndpointGuild(guildID), &st)
+	return st, err
+}
+
+func (p *SessionProvider) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	return p.GuildMemberContext(context.Background(), guildID, userID)
+}
+
+func (p *SessionProvider) GuildMemberContext(ctx context.Context, guildID, userID string) (st *discordgo.Member, err error) {
+	err = p.get(ctx, discordgo.EndpointGuildMember(guildID, userID), discordgo.EndpointGuildMember(guildID, ""), &st)
+	if err != nil {
+		return nil, err
+	}
+
+	// As with the session, the member is returned without its guild
+	st.GuildID = guildID
+	return st, nil
+}
+
+func (p *SessionProvider) GuildRoles(guildID string) ([]*discordgo.Role, error) {
+	return p.GuildRolesContext(context.Background(), guildID)
+}
+
+func (p *SessionProvider) GuildRolesContext(ctx context.Context, guildID string) (st []*discordgo.Role, err error) {
+	err = p.get(ctx, discordgo.EndpointGuildRoles(guildID), discordgo.EndpointGuildRoles(guildID), &st)
+	return st, err
+}
+
+func (p *SessionProvider) GuildEmojis(guildID string) ([]*discordgo.Emoji, error) {
+	return p.GuildEmojisContext(context.Background(), guildID)
+}
+
+func (p *SessionProvider) GuildEmojisContext(ctx context.Context, guildID string) (emoji []*discordgo.Emoji, err error) {
+	err = p.get(ctx, discordgo.EndpointGuildEmojis(guildID), discordgo.EndpointGuildEmojis(guildID), &emoji)
+	return emoji, err
+}
+
+func (p *SessionProvider) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	return p.GuildChannelsContext(context.Background(), guildID)
+}
+
+func (p *SessionProvider) GuildChannelsContext(ctx context.Context, guildID string) (st []*discordgo.Channel, err error) {
+	err = p.get(ctx, discordgo.EndpointGuildChannels(guildID), discordgo.EndpointGuildChannels(guildID), &st)
+	return st, err
+}
+
+func (p *SessionProvider) Sticker(stickerID string) (*discordgo.Sticker, error) {
+	return p.StickerContext(context.Background(), stickerID)
+}
+
+func (p *SessionProvider) StickerContext(ctx context.Context, stickerID string) (st *discordgo.Sticker, err error) {
+	err = p.get(ctx, discordgo.EndpointSticker(stickerID), discordgo.EndpointSticker(""), &st)
+	return st, err
+}
+
+func (p *SessionProvider) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	return p.ChannelMessageContext(context.Background(), channelID, messageID)
+}
+
+func (p *SessionProvider) ChannelMessageContext(ctx context.Context, channelID, messageID string) (st *discordgo.Message, err error) {
+	err = p.get(ctx, discordgo.EndpointChannelMessage(channelID, messageID), discordgo.EndpointChannelMessage(channelID, ""), &st)
+	return st, err
+}
+
+func (p *SessionProvider) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	return p.ChannelMessagesContext(context.Background(), channelID, limit, beforeID, afterID, aroundID)
+}
+
+func (p *SessionProvider) ChannelMessagesContext(ctx context.Context, channelID string, limit int, beforeID, afterID, aroundID string) (st []*discordgo.Message, err error) {
+	v := url.Values{}
+	if limit > 0 {
+		v.Set("limit", strconv.Itoa(limit))
+	}
+	if afterID != "" {
+		v.Set("after", afterID)
+	}
+	if beforeID != "" {
+		v.Set("before", beforeID)
+	}
+	if aroundID != "" {
+		v.Set("around", aroundID)
+	}
+
+	uri := discordgo.EndpointChannelMessages(channelID)
+	if len(v) > 0 {
+		uri += "?" + v.Encode()
+	}
+	err = p.get(ctx, uri, discordgo.EndpointChannelMessages(channelID), &st)
+	return st, err
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// APITransport answers requests of the Discord API with canned responses, by
+// path, blocking on any path without one until the request is abandoned.
+type APITransport struct {
+	responses map[string]string
+	requests  chan *http.Request
+	abandoned chan error
+}
+
+func (t *APITransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.requests != nil {
+		t.requests <- r
+	}
+
+	body, ok := t.responses[r.URL.Path]
+	if !ok {
+		<-r.Context().Done()
+		t.abandoned <- r.Context().Err()
+		return nil, r.Context().Err()
+	}
+
+	status := http.StatusOK
+	if strings.Contains(body, `"code"`) {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func TestSessionProvider(t *testing.T) {
+	apiPath := strings.TrimPrefix(discordgo.EndpointAPI, "https://discord.com")
+	tr := &APITransport{
+		responses: map[string]string{
+			apiPath + "channels/1234":               `{"id": "1234", "name": "Testing Channel"}`,
+			apiPath + "channels/0":                  `{"code": 10003, "message": "Unknown Channel"}`,
+			apiPath + "guilds/9101112/members/5678": `{"user": {"id": "5678"}}`,
+			apiPath + "channels/1234/messages":      `[{"id": "1516"}]`,
+		},
+		requests:  make(chan *http.Request, 10),
+		abandoned: make(chan error, 1),
+	}
+	s, _ := discordgo.New("Bot token")
+	s.Client = &http.Client{Transport: tr}
+	c := NewCache(NewSessionProvider(s))
+
+	if ch, err := c.Channel("1234"); err != nil || ch.Name != "Testing Channel" {
+		t.Error("failed to retrieve channel through session:", err)
+	}
+	if r := <-tr.requests; r.Header.Get("authorization") != "Bot token" {
+		t.Errorf("request made without token of session\nexpect: %s\ngot: %s", "Bot token", r.Header.Get("authorization"))
+	}
+	if _, err := c.Channel("0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error for unknown channel\nexpect: %v\ngot: %v", ErrNotFound, err)
+	}
+	<-tr.requests
+
+	// Members are given their guild, as by the session
+	if m, err := c.Member("9101112", "5678"); err != nil || m.GuildID != "9101112" {
+		t.Errorf("wrong member from session: %+v, %v", m, err)
+	}
+	<-tr.requests
+
+	msgs, err := NewSessionProvider(s).ChannelMessages("1234", 10, "1600", "", "")
+	if err != nil || len(msgs) != 1 || msgs[0].ID != "1516" {
+		t.Errorf("wrong history from session: %v, %v", msgs, err)
+	}
+	if r := <-tr.requests; r.URL.RawQuery != "before=1600&limit=10" {
+		t.Errorf("wrong query for history\nexpect: %s\ngot: %s", "before=1600&limit=10", r.URL.RawQuery)
+	}
+
+	// A lookup which gives up cancels its request, whatever the object
+	lookups := []struct {
+		Name   string
+		Lookup func(ctx context.Context) error
+	}{
+		{"Guild", func(ctx context.Context) error { _, err := c.GuildContext(ctx, "1"); return err }},
+		{"Role", func(ctx context.Context) error { _, err := c.RoleContext(ctx, "1", "2"); return err }},
+		{"Message", func(ctx context.Context) error { _, err := c.MessageContext(ctx, "1", "2"); return err }},
+	}
+	for _, l := range lookups {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := l.Lookup(ctx)
+		cancel()
+		<-tr.requests
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: wrong error from abandoned lookup\nexpect: %v\ngot: %v", l.Name, context.DeadlineExceeded, err)
+		}
+		select {
+		case err := <-tr.abandoned:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s: wrong error seen by request\nexpect: %v\ngot: %v", l.Name, context.Canceled, err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: request was not cancelled", l.Name)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultShards is the number of shards each of the channel, user and guild
+// caches is split into if no other count is configured.
+const DefaultShards = 16
+
+// shardMap is a map of snowflake IDs to cached objects, split into a number of
+// shards which are each locked independently. Keys are distributed across
+// shards by their FNV hash, such that lookups of unrelated IDs are very
+// unlikely to contend for the same lock.
+//
+// A shardMap may optionally be bounded, in which case the least recently used
+// entries of the map as a whole are evicted once it holds more entries than
+// the bound. Each use of an entry is stamped from a clock shared between
+// shards, and the entry with the oldest stamp at the back of any shard is
+// evicted first. Evictions happen once the inserting shard is unlocked, so
+// concurrent insertions may evict one entry too many, but once every insertion
+// has returned the map never holds more entries than the bound.
+type shardMap[T any] struct {
+	shards []shard[T]
+	// Maximum number of entries, or zero if unbounded.
+	limit int
+	// Number of entries across all shards.
+	count atomic.Int64
+	// Clock from which uses of entries are stamped.
+	clock atomic.Uint64
+}
+
+// shard is a single locked portion of a shardMap.
+type shard[T any] struct {
+	mu sync.RWMutex
+	// Map of keys to their elements in order. Element values are always
+	// of type *shardItem[T].
+	m map[string]*list.Element
+	// Keys in order of use, most recently used first. Only maintained on
+	// lookup if the map is bounded.
+	order *list.List
+}
+
+// shardItem is a single entry in a shard.
+type shardItem[T any] struct {
+	key string
+	val *T
+	// Stamp of the last use of the entry, if the map is bounded.
+	used uint64
+}
+
+// newShardMap creates a new shardMap split into n shards. If n is less than
+// one, a single shard is used. If limit is greater than zero, the map evicts
+// least recently used entries to hold no more than limit entries.
+func newShardMap[T any](n, limit int) *shardMap[T] {
+	if n < 1 {
+		n = 1
+	}
+	if limit < 0 {
+		limit = 0
+	}
+
+	s := &shardMap[T]{shards: make([]shard[T], n), limit: limit}
+	for i := range s.shards {
+		s.shards[i].m = make(map[string]*list.Element)
+		s.shards[i].order = list.New()
+	}
+
+	return s
+}
+
+// shard returns the shard responsible for key.
+func (s *shardMap[T]) shard(key string) *shard[T] {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// get returns the value stored for key, if any. For an unbounded map, only the
+// read lock of the shard is taken. A bounded map must record the use, so takes
+// the exclusive lock.
+func (s *shardMap[T]) get(key string) (*T, bool) {
+	sh := s.shard(key)
+	if s.limit == 0 {
+		sh.mu.RLock()
+		defer sh.mu.RUnlock()
+	} else {
+		sh.mu.Lock()
+		defer sh.mu.Unlock()
+	}
+
+	elem, ok := sh.m[key]
+	if !ok {
+		return nil, false
+	}
+	if s.limit > 0 {
+		s.use(sh, elem)
+	}
+
+	return elem.Value.(*shardItem[T]).val, true
+}
+
+// use records a use of elem, an element of sh, moving it to the front of the
+// order of sh with a new stamp. sh.mu must be held exclusively.
+func (s *shardMap[T]) use(sh *shard[T], elem *list.Element) {
+	sh.order.MoveToFront(elem)
+	elem.Value.(*shardItem[T]).used = s.clock.Add(1)
+}
+
+// peek is like get, but never records the use, so only ever takes the read
+// lock of the shard.
+func (s *shardMap[T]) peek(key string) (*T, bool) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	elem, ok := sh.m[key]
+	if !ok {
+		return nil, false
+	}
+	return elem.Value.(*shardItem[T]).val, true
+}
+
+// set stores val for key, replacing any existing value. If the map is bounded,
+// the keys of any entries evicted to make room are returned.
+func (s *shardMap[T]) set(key string, val *T) (evicted []string) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	if elem, ok := sh.m[key]; ok {
+		elem.Value.(*shardItem[T]).val = val
+		s.use(sh, elem)
+		sh.mu.Unlock()
+		return nil
+	}
+
+	elem := sh.order.PushFront(&shardItem[T]{key: key, val: val})
+	elem.Value.(*shardItem[T]).used = s.clock.Add(1)
+	sh.m[key] = elem
+	s.count.Add(1)
+	sh.mu.Unlock()
+
+	for s.limit > 0 && s.count.Load() > int64(s.limit) {
+		key, ok := s.evictOldest()
+		if !ok {
+			break
+		}
+		if key != "" {
+			evicted = append(evicted, key)
+		}
+	}
+
+	return evicted
+}
+
+// evictOldest removes the least recently used entry of the map, being the
+// entry with the oldest stamp at the back of any shard, and returns its key.
+// If the entry is used or removed before it can be evicted, the empty key is
+// returned and nothing is evicted. False is returned only if the map is empty.
+func (s *shardMap[T]) evictOldest() (string, bool) {
+	var (
+		oldest *shardItem[T]
+		stamp  uint64
+		from   *shard[T]
+	)
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		if back := sh.order.Back(); back != nil {
+			it := back.Value.(*shardItem[T])
+			if oldest == nil || it.used < oldest.used {
+				oldest, stamp, from = it, it.used, sh
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	if oldest == nil {
+		return "", false
+	}
+
+	from.mu.Lock()
+	defer from.mu.Unlock()
+	if back := from.order.Back(); back == nil || back.Value.(*shardItem[T]) != oldest || oldest.used != stamp {
+		return "", true
+	}
+	s.remove(from, oldest.key)
+	return oldest.key, true
+}
+
+// delete removes the value for key, returning false if it was not present.
+func (s *shardMap[T]) delete(key string) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.remove(sh, key)
+}
+
+// remove removes key from sh, returning false if it was not present. sh.mu
+// must be held.
+func (s *shardMap[T]) remove(sh *shard[T], key string) bool {
+	elem, ok := sh.m[key]
+	if !ok {
+		return false
+	}
+
+	sh.order.Remove(elem)
+	delete(sh.m, key)
+	s.count.Add(-1)
+	return true
+}
+
+// deleteFunc removes every entry for which pred returns true, returning the
+// keys removed. Each shard is locked in turn while it is walked, so pred must
+// not call back into the map.
+func (s *shardMap[T]) deleteFunc(pred func(key string, val *T) bool) (removed []string) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for key, elem := range sh.m {
+			if pred(key, elem.Value.(*shardItem[T]).val) {
+				s.remove(sh, key)
+				removed = append(removed, key)
+			}
+		}
+		sh.mu.Unlock()
+	}
+
+	return removed
+}
+
+// walk calls fn for every entry until fn returns false. Each shard is read
+// locked in turn while it is walked, so fn must not modify the map.
+func (s *shardMap[T]) walk(fn func(key string, val *T) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for key, elem := range sh.m {
+			if !fn(key, elem.Value.(*shardItem[T]).val) {
+				sh.mu.RUnlock()
+				return
+			}
+		}
+		sh.mu.RUnlock()
+	}
+}
+
+// clear removes every entry from every shard, returning the keys removed.
+// Shard maps are reallocated rather than emptied so that their memory is
+// released.
+func (s *shardMap[T]) clear() (removed []string) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for key := range sh.m {
+			removed = append(removed, key)
+		}
+		s.count.Add(-int64(len(sh.m)))
+		sh.m = make(map[string]*list.Element)
+		sh.order.Init()
+		sh.mu.Unlock()
+	}
+
+	return removed
+}
+
+// len returns the total number of entries across all shards. As each shard
+// is locked in turn, the count may be stale by the time it is returned if
+// the map is being concurrently modified.
+func (s *shardMap[T]) len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		n += len(sh.m)
+		sh.mu.RUnlock()
+	}
+
+	return n
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestShardMap(t *testing.T) {
+	for _, n := range []int{-1, 0, 1, 16, 33} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			s := newShardMap[int](n, 0)
+			if n > 0 && len(s.shards) != n {
+				t.Fatalf("wrong shard count\nexpect: %d\ngot: %d", n, len(s.shards))
+			}
+
+			for i := 0; i < 500; i++ {
+				v := i
+				s.set(strconv.Itoa(i), &v)
+			}
+			if s.len() != 500 {
+				t.Errorf("wrong length across shards\nexpect: %d\ngot: %d", 500, s.len())
+			}
+
+			for i := 0; i < 500; i++ {
+				v, ok := s.get(strconv.Itoa(i))
+				if !ok || *v != i {
+					t.Fatalf("lost entry %d across shards", i)
+				}
+			}
+
+			if !s.delete("42") || s.delete("42") {
+				t.Error("wrong result from delete of existing then deleted key")
+			}
+			if s.len() != 499 {
+				t.Errorf("wrong length after delete\nexpect: %d\ngot: %d", 499, s.len())
+			}
+		})
+	}
+}
+
+func TestShardMapLRU(t *testing.T) {
+	s := newShardMap[int](1, 3)
+	for i := 0; i < 3; i++ {
+		v := i
+		s.set(strconv.Itoa(i), &v)
+	}
+
+	// Use "0" so that "1" becomes the least recently used
+	s.get("0")
+	v := 3
+	evicted := s.set("3", &v)
+	if len(evicted) != 1 || evicted[0] != "1" {
+		t.Errorf("wrong eviction\nexpect: [1]\ngot: %v", evicted)
+	}
+	if s.len() != 3 {
+		t.Errorf("wrong length after eviction\nexpect: %d\ngot: %d", 3, s.len())
+	}
+	for _, key := range []string{"0", "2", "3"} {
+		if _, ok := s.get(key); !ok {
+			t.Errorf("entry '%s' was wrongfully evicted", key)
+		}
+	}
+
+	// Replacing an existing key is not an insertion
+	if evicted := s.set("0", &v); len(evicted) != 0 {
+		t.Errorf("unexpected eviction on replace: %v", evicted)
+	}
+}
+
+func TestShardMapBound(t *testing.T) {
+	s := newShardMap[int](DefaultShards, 4)
+	for i := 0; i < 100; i++ {
+		v := i
+		s.set(strconv.Itoa(i), &v)
+		if n := s.len(); n > 4 {
+			t.Fatalf("bound exceeded after %d insertions\nexpect: <= %d\ngot: %d", i+1, 4, n)
+		}
+	}
+
+	// The least recently used entry of the whole map is evicted, whichever
+	// shard it is in
+	s.get("96")
+	v := 100
+	if evicted := s.set("100", &v); len(evicted) != 1 || evicted[0] != "97" {
+		t.Errorf("wrong eviction\nexpect: [97]\ngot: %v", evicted)
+	}
+	for _, key := range []string{"96", "98", "99", "100"} {
+		if _, ok := s.peek(key); !ok {
+			t.Errorf("entry '%s' was wrongfully evicted", key)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				v := i
+				s.set(strconv.Itoa(g*100+i), &v)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := s.len(); n > 4 {
+		t.Errorf("bound exceeded by concurrent insertions\nexpect: <= %d\ngot: %d", 4, n)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	c := NewCache(MockProvider{}, WithShards(1), WithMaxEntries(TypeUser, 1))
+	testuser := discordgo.User{ID: "testuser"}
+	c.users.set("testuser", newEntry(&testuser, time.Now()))
+
+	if _, err := c.User("5678"); err != nil {
+		t.Fatal("Unexpected error from user retrieval:", err)
+	}
+	if _, ok := c.users.get("testuser"); ok {
+		t.Error("least recently used user was not evicted")
+	}
+	if c.Stats().User.Evictions != 1 {
+		t.Errorf("wrong eviction count\nexpect: 1\ngot: %d", c.Stats().User.Evictions)
+	}
+}
+
+func TestWithShards(t *testing.T) {
+	c := NewCache(MockProvider{})
+	if n := len(c.channels.table.(*shardMap[entry[discordgo.Channel]]).shards); n != DefaultShards {
+		t.Errorf("wrong default shard count\nexpect: %d\ngot: %d", DefaultShards, n)
+	}
+
+	c = NewCache(MockProvider{}, WithShards(4))
+	if n := len(c.users.table.(*shardMap[entry[discordgo.User]]).shards); n != 4 {
+		t.Errorf("wrong configured shard count\nexpect: %d\ngot: %d", 4, n)
+	}
+}
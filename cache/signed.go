@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// urlExpiry returns the time at which the signature of the Discord CDN url
+// rawURL expires, given by its ex parameter as a hexadecimal Unix timestamp,
+// or zero if rawURL is not signed.
+func urlExpiry(rawURL string) time.Time {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}
+	}
+
+	ex, err := strconv.ParseInt(u.Query().Get("ex"), 16, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(ex, 0)
+}
+
+// Expired returns true if the attachment was cached from a signed Discord CDN
+// url whose signature has since expired. The cache treats such attachments as
+// missing and evicts them, as the url they are cached under can no longer be
+// downloaded from; looking the attachment up again requires a freshly signed
+// url, such as from re-fetching the message.
+func (a Attachment) Expired() bool {
+	return a.expiredAt(time.Now())
+}
+
+// expiredAt is like Expired, but at the time now.
+func (a Attachment) expiredAt(now time.Time) bool {
+	return !a.Expires.IsZero() && now.After(a.Expires)
+}
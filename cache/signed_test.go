@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignedURL(t *testing.T) {
+	signed := func(at time.Time) string {
+		return "https://cdn.discordapp.com/attachments/1/2/a.png?ex=" + strconv.FormatInt(at.Unix(), 16) + "&is=0&hm=0"
+	}
+	past, future := signed(time.Now().Add(-time.Hour)), signed(time.Now().Add(time.Hour))
+	unsigned := "https://cdn.discordapp.com/attachments/1/2/b.png"
+
+	c := NewCache(MockProvider{})
+	for _, url := range []string{past, future, unsigned} {
+		c.AddAttachment(url, "", "", []byte("content"))
+	}
+
+	plan := c.CleanPlan()
+	if len(plan) != 1 || plan[0] != (Eviction{past, EvictExpired}) {
+		t.Errorf("wrong clean plan for expired url: %v", plan)
+	}
+
+	cases := []struct {
+		Name   string
+		URL    string
+		Expect bool
+	}{
+		{"Expired", past, false},
+		{"Valid", future, true},
+		{"Unsigned", unsigned, true},
+	}
+	for _, tc := range cases {
+		if _, ok := c.cachedAttachment(tc.URL); ok != tc.Expect {
+			t.Errorf("%s: wrong lookup result\nexpect cached: %t\ngot: %t", tc.Name, tc.Expect, ok)
+		}
+	}
+	if c.HasAttachment(past) {
+		t.Error("attachment with expired url was not evicted")
+	}
+}
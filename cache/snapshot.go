@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrBadSnapshot is returned by Load if its input is not a snapshot written by
+// Save.
+var ErrBadSnapshot = errors.New("cache: invalid snapshot")
+
+// snapshotVersion is the version of the snapshot format written by Save.
+const snapshotVersion = 1
+
+// snapshot is the serialized form of the metadata caches. Entries are kept as
+// raw JSON until they are loaded so that a single bad entry does not prevent
+// the rest from loading.
+type snapshot struct {
+	Version  int                        `json:"version"`
+	Channels map[string]json.RawMessage `json:"channels"`
+	Users    map[string]json.RawMessage `json:"users"`
+	Guilds   map[string]json.RawMessage `json:"guilds"`
+	Members  map[string]json.RawMessage `json:"members"`
+	Roles    map[string]json.RawMessage `json:"roles"`
+	Emojis   map[string]json.RawMessage `json:"emojis"`
+	Stickers map[string]json.RawMessage `json:"stickers"`
+	Messages map[string]json.RawMessage `json:"messages"`
+}
+
+// Save writes a snapshot of the channel, user, guild, member, role, emoji,
+// sticker and message caches to w as JSON, such that it can be restored with
+// Load. Entries keep their insertion time, so entries restored from a snapshot
+// expire no later than they would have had the cache kept running. Attachments
+// and negative cache entries are not saved. Save does not block lookups, so
+// concurrent changes to the cache may or may not be reflected in the snapshot.
+func (c *Cache) Save(w io.Writer) error {
+	snap := snapshot{
+		Version:  snapshotVersion,
+		Channels: c.channels.save(),
+		Users:    c.users.save(),
+		Guilds:   c.guilds.save(),
+		Members:  c.members.save(),
+		Roles:    c.roles.save(),
+		Emojis:   c.emojis.save(),
+		Stickers: c.stickers.save(),
+		Messages: c.messages.save(),
+	}
+
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// Load reads a snapshot written by Save from r and merges it into the cache.
+// Existing entries are only replaced by entries from the snapshot which are
+// newer, and entries which have already outlived their TTL are skipped. Any
+// entry which cannot be decoded is also skipped, rather than failing the whole
+// load. If r does not contain a snapshot at all, ErrBadSnapshot is returned.
+func (c *Cache) Load(r io.Reader) error {
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("%w: %s", ErrBadSnapshot, err.Error())
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, snap.Version)
+	}
+
+	c.channels.load(snap.Channels)
+	c.users.load(snap.Users)
+	c.guilds.load(snap.Guilds)
+	c.members.load(snap.Members)
+	c.roles.load(snap.Roles)
+	c.emojis.load(snap.Emojis)
+	c.stickers.load(snap.Stickers)
+	c.messages.load(snap.Messages)
+	return nil
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSnapshot(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	src := NewCache(p)
+	src.Channel("1234")
+	src.User("5678")
+	src.Role("9101112", "1")
+
+	var buf bytes.Buffer
+	if err := src.Save(&buf); err != nil {
+		t.Fatal("Unexpected error from save:", err)
+	}
+
+	// Loading merges into existing entries
+	dst := NewCache(p)
+	existing := discordgo.Guild{ID: "existing"}
+	dst.guilds.set("existing", newEntry(&existing, time.Now()))
+	if err := dst.Load(&buf); err != nil {
+		t.Fatal("Unexpected error from load:", err)
+	}
+	if _, ok := dst.guilds.get("existing"); !ok {
+		t.Error("load replaced existing entries")
+	}
+
+	if c, err := dst.Channel("1234"); err != nil || c.Name != "Testing Channel" {
+		t.Error("failed to retrieve loaded channel:", err)
+	}
+	if u, err := dst.User("5678"); err != nil || u.Username != "Testing User" {
+		t.Error("failed to retrieve loaded user:", err)
+	}
+	if r, err := dst.Role("9101112", "2"); err != nil || r.Name != "Other Role" {
+		t.Error("failed to retrieve loaded role:", err)
+	}
+	if p.calls != 3 {
+		t.Errorf("loaded entries caused provider calls\nexpect: 3\ngot: %d", p.calls)
+	}
+}
+
+func TestSnapshotLoad(t *testing.T) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	old := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	in := `{"version":1,"channels":{` +
+		`"good":{"value":{"id":"good"},"inserted":"` + now + `"},` +
+		`"bad":{"value":"not a channel","inserted":"` + now + `"},` +
+		`"empty":{"inserted":"` + now + `"},` +
+		`"expired":{"value":{"id":"expired"},"inserted":"` + old + `"}` +
+		`}}`
+
+	c := NewCache(MockProvider{}, WithTTL(TypeChannel, time.Minute))
+	if err := c.Load(strings.NewReader(in)); err != nil {
+		t.Fatal("Unexpected error from load:", err)
+	}
+	if _, ok := c.channels.get("good"); !ok {
+		t.Error("valid entry was not loaded")
+	}
+	for _, key := range []string{"bad", "empty", "expired"} {
+		if _, ok := c.channels.get(key); ok {
+			t.Errorf("entry '%s' was wrongfully loaded", key)
+		}
+	}
+
+	for _, in := range []string{"", "not json", `{"version":2}`} {
+		if err := c.Load(strings.NewReader(in)); !errors.Is(err, ErrBadSnapshot) {
+			t.Errorf("wrong error for snapshot '%s'\nexpect: %v\ngot: %v", in, ErrBadSnapshot, err)
+		}
+	}
+}
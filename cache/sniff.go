@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"mime"
+	"net/http"
+)
+
+// sniffLen is the number of bytes of content considered by
+// http.DetectContentType.
+const sniffLen = 512
+
+// genericTypes are the content types which say nothing of the content, and so
+// are sniffed past.
+var genericTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+	"application/unknown":      true,
+}
+
+// mediaType returns the media type of contentType, without its parameters, or
+// contentType as is if it cannot be parsed.
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+
+	return contentType
+}
+
+// detectType sets the type of the downloaded attachment a: the Content-Type
+// header sent by the CDN, or if it is missing or generic, the type sniffed from
+// the content, or if that is generic too, the type given by the Discord API,
+// which is left in Type by the caller. If the type given by the API is set and
+// disagrees with the type detected, it is kept in DeclaredType.
+func detectType(a *Attachment, header string) {
+	declared := a.Type
+	switch {
+	case !genericTypes[mediaType(header)]:
+		a.Type = header
+	default:
+		buf := a.Content
+		if len(buf) > sniffLen {
+			buf = buf[:sniffLen]
+		}
+		if sniffed := http.DetectContentType(buf); !genericTypes[mediaType(sniffed)] {
+			a.Type = sniffed
+		}
+	}
+
+	if declared != "" && mediaType(declared) != mediaType(a.Type) {
+		a.DeclaredType = declared
+	}
+}
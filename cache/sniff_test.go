@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSniffContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if typ, ok := r.URL.Query()["type"]; ok {
+			w.Header()["Content-Type"] = typ
+		} else {
+			// Keep the server from sniffing the type itself
+			w.Header()["Content-Type"] = nil
+		}
+		w.Write(png)
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Name               string
+		Header, Declared   string
+		Expect, ExpectDecl string
+	}{
+		{"Header", "image/webp", "image/webp", "image/webp", ""},
+		{"Missing", "", "", "image/png", ""},
+		{"Generic", "application/octet-stream", "image/png", "image/png", ""},
+		{"Disagree", "application/octet-stream", "image/jpeg", "image/png", "image/jpeg"},
+	}
+
+	c := NewCache(MockProvider{})
+	for _, tc := range cases {
+		u := srv.URL + "/" + tc.Name
+		if tc.Header != "" {
+			u += "?type=" + url.QueryEscape(tc.Header)
+		}
+		a, err := c.Attachment(&discordgo.MessageAttachment{URL: u, ContentType: tc.Declared})
+		if err != nil {
+			t.Fatalf("%s: unexpected error from attachment download: %v", tc.Name, err)
+		}
+		if a.Type != tc.Expect || a.DeclaredType != tc.ExpectDecl {
+			t.Errorf("%s: wrong content type\nexpect: %q (declared %q)\ngot: %q (declared %q)",
+				tc.Name, tc.Expect, tc.ExpectDecl, a.Type, a.DeclaredType)
+		}
+	}
+
+	// Content which cannot be sniffed keeps the type given by the API
+	a := Attachment{Type: "model/gltf-binary", Content: []byte{0, 1, 2, 3}}
+	detectType(&a, "")
+	if a.Type != "model/gltf-binary" || a.DeclaredType != "" {
+		t.Errorf("wrong fallback content type\nexpect: model/gltf-binary\ngot: %q (declared %q)", a.Type, a.DeclaredType)
+	}
+}
@@ -0,0 +1,247 @@
+package cache
+
+import "github.com/bwmarrin/discordgo"
+
+// *StateProvider implements every provider interface but the context
+// providers, such as ContextProvider, as it makes no calls which could be
+// abandoned.
+var (
+	_ Provider                = (*StateProvider)(nil)
+	_ MemberProvider          = (*StateProvider)(nil)
+	_ RoleProvider            = (*StateProvider)(nil)
+	_ EmojiProvider           = (*StateProvider)(nil)
+	_ GuildChannelsProvider   = (*StateProvider)(nil)
+	_ StickerProvider         = (*StateProvider)(nil)
+	_ MessageProvider         = (*StateProvider)(nil)
+	_ ChannelMessagesProvider = (*StateProvider)(nil)
+)
+
+// StateProvider is a Provider which looks up objects in the state tracked by
+// discordgo from gateway events, without making any API calls. Objects absent
+// from the state are reported with discordgo.ErrStateNotFound, which is not
+// treated as the object not existing, as the state only holds what the
+// gateway has delivered. To fall back to the API for such objects, combine it
+// with a session in a MultiProvider:
+//
+//	p := cache.NewMultiProvider(cache.NewStateProvider(s.State), s)
+//
+// Users are found among the members of each guild in the state, or as the
+// user of the session itself, and stickers among the stickers of each guild.
+// Channel histories are paged from the messages the state holds for each
+// channel (see discordgo.State.MaxMessageCount), which may be fewer than the
+// channel has. Paging around a message is not supported, and is reported with
+// discordgo.ErrStateNotFound.
+type StateProvider struct {
+	state *discordgo.State
+}
+
+// NewStateProvider returns a provider which looks up objects in s.
+func NewStateProvider(s *discordgo.State) *StateProvider {
+	return &StateProvider{state: s}
+}
+
+// The state modifies its objects in place as events arrive, so every object,
+// and every slice of objects it holds, is copied while holding its lock before
+// being returned.
+
+func (p *StateProvider) Channel(channelID string) (*discordgo.Channel, error) {
+	ch, err := p.state.Channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	return copyChannel(ch), nil
+}
+
+func (p *StateProvider) User(userID string) (*discordgo.User, error) {
+	if p.state == nil {
+		return nil, discordgo.ErrNilState
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	if u := p.state.User; u != nil && u.ID == userID {
+		cp := *u
+		return &cp, nil
+	}
+	for _, g := range p.state.Guilds {
+		for _, m := range g.Members {
+			if m.User != nil && m.User.ID == userID {
+				cp := *m.User
+				return &cp, nil
+			}
+		}
+	}
+
+	return nil, discordgo.ErrStateNotFound
+}
+
+func (p *StateProvider) Guild(guildID string) (*discordgo.Guild, error) {
+	g, err := p.state.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	return copyGuild(g), nil
+}
+
+func (p *StateProvider) GuildMember(guildID, userID string) (*discordgo.Member, error) {
+	m, err := p.state.Member(guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	cp := *m
+	if m.User != nil {
+		u := *m.User
+		cp.User = &u
+	}
+	return &cp, nil
+}
+
+func (p *StateProvider) GuildRoles(guildID string) ([]*discordgo.Role, error) {
+	g, err := p.state.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	return copyAll(g.Roles), nil
+}
+
+func (p *StateProvider) GuildEmojis(guildID string) ([]*discordgo.Emoji, error) {
+	g, err := p.state.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	return copyAll(g.Emojis), nil
+}
+
+func (p *StateProvider) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	g, err := p.state.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	return copyChannels(g.Channels), nil
+}
+
+func (p *StateProvider) Sticker(stickerID string) (*discordgo.Sticker, error) {
+	if p.state == nil {
+		return nil, discordgo.ErrNilState
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	for _, g := range p.state.Guilds {
+		for _, st := range g.Stickers {
+			if st.ID == stickerID {
+				cp := *st
+				return &cp, nil
+			}
+		}
+	}
+
+	return nil, discordgo.ErrStateNotFound
+}
+
+func (p *StateProvider) ChannelMessage(channelID, messageID string) (*discordgo.Message, error) {
+	m, err := p.state.Message(channelID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	cp := *m
+	return &cp, nil
+}
+
+func (p *StateProvider) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	if aroundID != "" {
+		return nil, discordgo.ErrStateNotFound
+	}
+	ch, err := p.state.Channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	return pageMessages(ch.Messages, limit, beforeID, afterID), nil
+}
+
+// copyChannel returns a copy of ch, including the slices the state modifies.
+// The state must be read locked.
+func copyChannel(ch *discordgo.Channel) *discordgo.Channel {
+	cp := *ch
+	cp.Messages = copyAll(ch.Messages)
+	cp.PermissionOverwrites = copyAll(ch.PermissionOverwrites)
+	cp.Recipients = copyAll(ch.Recipients)
+	cp.Members = copyAll(ch.Members)
+	return &cp
+}
+
+// copyGuild returns a copy of g, including the slices the state modifies. The
+// state must be read locked if g belongs to it.
+func copyGuild(g *discordgo.Guild) *discordgo.Guild {
+	cp := *g
+	cp.Roles = copyAll(g.Roles)
+	cp.Emojis = copyAll(g.Emojis)
+	cp.Stickers = copyAll(g.Stickers)
+	cp.Members = copyAll(g.Members)
+	cp.Presences = copyAll(g.Presences)
+	cp.VoiceStates = copyAll(g.VoiceStates)
+	cp.StageInstances = copyAll(g.StageInstances)
+	cp.Features = append([]discordgo.GuildFeature(nil), g.Features...)
+	cp.Channels = copyChannels(g.Channels)
+	cp.Threads = copyChannels(g.Threads)
+	return &cp
+}
+
+// copyChannels is like copyAll, but copies each channel with copyChannel.
+func copyChannels(s []*discordgo.Channel) []*discordgo.Channel {
+	if s == nil {
+		return nil
+	}
+
+	cp := make([]*discordgo.Channel, len(s))
+	for i, ch := range s {
+		if ch != nil {
+			cp[i] = copyChannel(ch)
+		}
+	}
+
+	return cp
+}
+
+// copyAll returns a copy of each element of s, or nil if s is nil. Nil
+// elements are left nil.
+func copyAll[T any](s []*T) []*T {
+	if s == nil {
+		return nil
+	}
+
+	cp := make([]*T, len(s))
+	for i, v := range s {
+		if v == nil {
+			continue
+		}
+		val := *v
+		cp[i] = &val
+	}
+
+	return cp
+}
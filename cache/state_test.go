@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func newTestState() *discordgo.State {
+	s := discordgo.NewState()
+	s.User = &discordgo.User{ID: "1", Username: "Bot"}
+	s.GuildAdd(&discordgo.Guild{
+		ID:       "1000",
+		Name:     "State Guild",
+		Channels: []*discordgo.Channel{{ID: "2000", GuildID: "1000", Name: "State Channel"}},
+		Members:  []*discordgo.Member{{GuildID: "1000", User: &discordgo.User{ID: "3000", Username: "State User"}}},
+		Roles:    []*discordgo.Role{{ID: "4000", Name: "State Role"}},
+		Emojis:   []*discordgo.Emoji{{ID: "5000", Name: "state"}},
+		Stickers: []*discordgo.Sticker{{ID: "6000", Name: "State Sticker"}},
+	})
+
+	return s
+}
+
+func TestStateProvider(t *testing.T) {
+	s := newTestState()
+	c := NewCache(NewStateProvider(s))
+
+	if ch, err := c.Channel("2000"); err != nil || ch.Name != "State Channel" {
+		t.Error("failed to retrieve channel from state:", err)
+	}
+	if g, err := c.Guild("1000"); err != nil || g.Name != "State Guild" {
+		t.Error("failed to retrieve guild from state:", err)
+	}
+	for id, name := range map[string]string{"1": "Bot", "3000": "State User"} {
+		if u, err := c.User(id); err != nil || u.Username != name {
+			t.Errorf("failed to retrieve user '%s' from state: %v", id, err)
+		}
+	}
+	if m, err := c.Member("1000", "3000"); err != nil || m.User.Username != "State User" {
+		t.Error("failed to retrieve member from state:", err)
+	}
+	if r, err := c.Role("1000", "4000"); err != nil || r.Name != "State Role" {
+		t.Error("failed to retrieve role from state:", err)
+	}
+	if e, err := c.Emoji("1000", "5000"); err != nil || e.Name != "state" {
+		t.Error("failed to retrieve emoji from state:", err)
+	}
+	if st, err := c.Sticker("6000"); err != nil || st.Name != "State Sticker" {
+		t.Error("failed to retrieve sticker from state:", err)
+	}
+
+	// Later changes to the state do not modify cached objects
+	s.MemberAdd(&discordgo.Member{GuildID: "1000", User: &discordgo.User{ID: "3000", Username: "Renamed"}})
+	if m, _ := c.Member("1000", "3000"); m.User.Username != "State User" {
+		t.Error("cached member was modified by state")
+	}
+
+	// Objects absent from the state are not treated as not existing
+	if _, err := c.Channel("1234"); !errors.Is(err, discordgo.ErrStateNotFound) || errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error for channel absent from state\nexpect: %v\ngot: %v", discordgo.ErrStateNotFound, err)
+	}
+
+	// Absent objects fall back to later providers
+	c = NewCache(NewMultiProvider(NewStateProvider(s), MockProvider{}))
+	if ch, err := c.Channel("1234"); err != nil || ch.Name != "Testing Channel" {
+		t.Error("failed to fall back for channel absent from state:", err)
+	}
+}
+
+func TestStateProviderCopies(t *testing.T) {
+	s := newTestState()
+	s.MaxMessageCount = 10
+	s.MessageAdd(&discordgo.Message{ID: "7000", ChannelID: "2000", Content: "first"})
+	s.MessageAdd(&discordgo.Message{ID: "7001", ChannelID: "2000", Content: "second"})
+	p := NewStateProvider(s)
+
+	g, err := p.Guild("1000")
+	if err != nil {
+		t.Fatal("Unexpected error from guild lookup:", err)
+	}
+	ch, err := p.Channel("2000")
+	if err != nil {
+		t.Fatal("Unexpected error from channel lookup:", err)
+	}
+
+	// The state replaces and removes elements of its slices in place
+	s.RoleAdd("1000", &discordgo.Role{ID: "4000", Name: "Renamed Role"})
+	s.MessageRemove(&discordgo.Message{ID: "7000", ChannelID: "2000"})
+
+	if g.Roles[0].Name != "State Role" {
+		t.Errorf("copied guild changed with state\nexpect: %s\ngot: %s", "State Role", g.Roles[0].Name)
+	}
+	if len(ch.Messages) != 2 || ch.Messages[0].ID != "7000" || ch.Messages[1].ID != "7001" {
+		t.Errorf("copied channel changed with state: %v", ch.Messages)
+	}
+	if len(g.Channels[0].Messages) != 2 || g.Channels[0].Messages[0].ID != "7000" {
+		t.Errorf("channel of copied guild changed with state: %v", g.Channels[0].Messages)
+	}
+}
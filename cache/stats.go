@@ -0,0 +1,112 @@
+package cache
+
+import "sync/atomic"
+
+// TypeStats are the statistics for the cache of a single object type.
+type TypeStats struct {
+	// Hits is the number of lookups served from the cache.
+	Hits uint64
+	// Misses is the number of lookups which were not present in the cache
+	// and so went to the provider (or CDN, for attachments).
+	Misses uint64
+	// Evictions is the number of entries removed from the cache, either by
+	// invalidation or by Clean.
+	Evictions uint64
+	// Entries is the number of entries currently cached.
+	Entries int
+	// Corrupt is the number of entries found on read not to match their
+	// checksum, and so discarded. Only attachments have checksums.
+	Corrupt uint64
+}
+
+// HitRatio returns the fraction of lookups which were served from the cache,
+// or zero if there have been no lookups.
+func (s TypeStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Stats is a snapshot of the statistics for each of the caches within a
+// Cache. As each counter is read independently, counters may be very
+// slightly inconsistent with one another if the cache is in concurrent use.
+type Stats struct {
+	Channel    TypeStats
+	User       TypeStats
+	Guild      TypeStats
+	Member     TypeStats
+	Role       TypeStats
+	Emoji      TypeStats
+	Sticker    TypeStats
+	Message    TypeStats
+	History    TypeStats
+	Attachment TypeStats
+}
+
+// counters are the live, atomically updated statistics for one object type.
+type counters struct {
+	hits, misses, evictions atomic.Uint64
+	corrupt                 atomic.Uint64
+	latency                 latency
+}
+
+func (c *counters) snapshot(entries int) TypeStats {
+	return TypeStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Corrupt:   c.corrupt.Load(),
+	}
+}
+
+// Stats returns the current statistics of the cache.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Channel:    c.channelStats.snapshot(c.ChannelLen()),
+		User:       c.userStats.snapshot(c.UserLen()),
+		Guild:      c.guildStats.snapshot(c.GuildLen()),
+		Member:     c.memberStats.snapshot(c.members.len()),
+		Role:       c.roleStats.snapshot(c.roles.len()),
+		Emoji:      c.emojiStats.snapshot(c.emojis.len()),
+		Sticker:    c.stickerStats.snapshot(c.stickers.len()),
+		Message:    c.messageStats.snapshot(c.messages.len()),
+		History:    c.historyStats.snapshot(c.histories.len()),
+		Attachment: c.attachmentStats.snapshot(c.AttachmentLen()),
+	}
+}
+
+// ChannelLen returns the number of cached channels, including any which have
+// outlived their TTL but are yet to be removed by Clean.
+func (c *Cache) ChannelLen() int {
+	return c.channels.len()
+}
+
+// UserLen is like ChannelLen, but for users.
+func (c *Cache) UserLen() int {
+	return c.users.len()
+}
+
+// GuildLen is like ChannelLen, but for guilds.
+func (c *Cache) GuildLen() int {
+	return c.guilds.len()
+}
+
+// AttachmentLen returns the number of cached attachments.
+func (c *Cache) AttachmentLen() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.attachmentCache)
+}
+
+// AttachmentBytes returns the total size of the cached attachments, whether
+// held in memory or on disk.
+func (c *Cache) AttachmentBytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.attachmentBytes
+}
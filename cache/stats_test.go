@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	c := NewCache(MockProvider{})
+
+	c.Channel("1234") // Miss
+	c.Channel("1234") // Hit
+	c.Channel("1234") // Hit
+	c.Channel("abcd") // Miss (error)
+	c.InvalidateChannel("1234")
+	c.User("5678") // Miss
+
+	c.mu.Lock()
+	c.insertAttachment("a", &Attachment{LastReference: time.Now()})
+	c.insertAttachment("b", &Attachment{LastReference: time.Now().Add(-2 * AttachmentLifetime)})
+	c.mu.Unlock()
+	c.Clean()
+
+	cases := []struct {
+		Name   string
+		Got    TypeStats
+		Expect TypeStats
+	}{
+		{"Channel", c.Stats().Channel, TypeStats{Hits: 2, Misses: 2, Evictions: 1, Entries: 0}},
+		{"User", c.Stats().User, TypeStats{Hits: 0, Misses: 1, Evictions: 0, Entries: 1}},
+		{"Guild", c.Stats().Guild, TypeStats{}},
+		{"Attachment", c.Stats().Attachment, TypeStats{Evictions: 1, Entries: 1}},
+	}
+	for _, tc := range cases {
+		if tc.Got != tc.Expect {
+			t.Errorf("%s: wrong stats\nexpect: %+v\ngot: %+v", tc.Name, tc.Expect, tc.Got)
+		}
+	}
+
+	if r := c.Stats().Channel.HitRatio(); r != 0.5 {
+		t.Errorf("wrong hit ratio\nexpect: %f\ngot: %f", 0.5, r)
+	}
+}
+
+func TestLen(t *testing.T) {
+	c := NewCache(MockProvider{})
+	c.Channel("1234")
+	c.User("5678")
+	c.Guild("9101112")
+	c.Guild("abcd") // Error, so not cached
+	c.mu.Lock()
+	c.insertAttachment("a", &Attachment{})
+	c.insertAttachment("b", &Attachment{})
+	c.mu.Unlock()
+
+	cases := []struct {
+		Name   string
+		Got    int
+		Expect int
+	}{
+		{"Channel", c.ChannelLen(), 1},
+		{"User", c.UserLen(), 1},
+		{"Guild", c.GuildLen(), 1},
+		{"Attachment", c.AttachmentLen(), 2},
+	}
+	for _, tc := range cases {
+		if tc.Got != tc.Expect {
+			t.Errorf("%s: wrong length\nexpect: %d\ngot: %d", tc.Name, tc.Expect, tc.Got)
+		}
+	}
+}
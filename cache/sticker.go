@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A StickerProvider is a Provider which can also look up stickers. As
+// *discordgo.Session has no such method, stickers are fetched from a session
+// with a raw API request instead, so only other providers need implement this.
+type StickerProvider interface {
+	Sticker(stickerID string) (st *discordgo.Sticker, err error)
+}
+
+// A StickerContextProvider is a StickerProvider which can also look up
+// stickers with a context, as ContextProvider does for channels.
+type StickerContextProvider interface {
+	StickerContext(ctx context.Context, stickerID string) (st *discordgo.Sticker, err error)
+}
+
+// fetchSticker looks up the sticker stickerID with p, with ctx if p is a
+// StickerContextProvider, returning ErrUnsupported if p is unable to look up
+// stickers.
+func fetchSticker(ctx context.Context, p Provider, stickerID string) (*discordgo.Sticker, error) {
+	switch p := p.(type) {
+	case StickerContextProvider:
+		return p.StickerContext(ctx, stickerID)
+	case StickerProvider:
+		return p.Sticker(stickerID)
+	case *discordgo.Session:
+		buf, err := p.RequestWithBucketID(http.MethodGet, discordgo.EndpointSticker(stickerID), nil, discordgo.EndpointSticker(""))
+		if err != nil {
+			return nil, err
+		}
+
+		st := new(discordgo.Sticker)
+		if err := json.Unmarshal(buf, st); err != nil {
+			return nil, err
+		}
+		return st, nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// Sticker looks up and returns a sticker's data from the discord API, or
+// returns the cached value if already found and not older than the sticker
+// TTL (see WithTTL), in the same manner as Channel. The sticker is returned
+// exactly as provided, so FormatType may be used to build the URL of the
+// sticker's asset, or to skip Lottie stickers which cannot be rendered as an
+// image. If the provider is unable to look up stickers (see StickerProvider),
+// ErrUnsupported is returned.
+func (c *Cache) Sticker(ID string) (discordgo.Sticker, error) {
+	return c.StickerContext(context.Background(), ID)
+}
+
+// StickerContext is like Sticker, but stops waiting for the provider and
+// returns the context's error if ctx is done before the lookup completes.
+func (c *Cache) StickerContext(ctx context.Context, ID string) (discordgo.Sticker, error) {
+	v, err := c.stickers.lookup(ctx, ID, func(ctx context.Context) (*discordgo.Sticker, error) {
+		return fetchSticker(ctx, c.provider, ID)
+	})
+	if err != nil {
+		return discordgo.Sticker{}, err
+	}
+
+	return *v, nil
+}
+
+// InvalidateSticker invalidates the cache entry for the sticker ID.
+func (c *Cache) InvalidateSticker(ID string) error {
+	return c.stickers.invalidate(ID)
+}
+
+// InvalidateAllStickers invalidates every cached sticker.
+func (c *Cache) InvalidateAllStickers() {
+	c.stickers.invalidateAll()
+}
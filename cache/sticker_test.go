@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSticker(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p)
+
+	for i := 0; i < 2; i++ {
+		st, err := c.Sticker("1314")
+		if err != nil {
+			t.Fatal("Unexpected error from sticker retrieval:", err)
+		}
+		if st.Name != "Testing Sticker" || st.FormatType != discordgo.StickerFormatTypeLottie {
+			t.Errorf("wrong sticker returned: %+v", st)
+		}
+	}
+	if s := c.Stats().Sticker; s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("wrong sticker stats: %+v", s)
+	}
+
+	if err := c.InvalidateSticker("1314"); err != nil {
+		t.Error("Unexpected error from sticker invalidation:", err)
+	}
+	if _, ok := c.stickers.get("1314"); ok {
+		t.Error("sticker was not invalidated")
+	}
+
+	// Providers which cannot look up stickers
+	c = NewCache(&ErrorProvider{})
+	if _, err := c.Sticker("1314"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("wrong error from unsupported provider\nexpect: %v\ngot: %v", ErrUnsupported, err)
+	}
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// A Store is a storage backend for the channel, user, guild, member, role and
+// emoji caches, such as a Redis or Memcached client shared between several
+// processes. Entries are stored as JSON, under keys prefixed by the type of
+// their object (for example, "channel:" followed by the channel ID), so a
+// single Store may hold every type at once. A Store must be safe for
+// concurrent use.
+//
+// The cache treats a failed Get as a miss and ignores a failed Set, such that
+// an unavailable Store degrades to fetching every object from the provider
+// rather than failing lookups. Expiry and bounding are still applied by the
+// Cache (see WithTTL), though a Store is free to evict entries of its own
+// accord.
+//
+// By default, a Cache stores entries in memory without serializing them.
+type Store interface {
+	// Get returns the value stored under key, or ErrMissing if there is
+	// none.
+	Get(key string) ([]byte, error)
+	// Set stores val under key, replacing any existing value.
+	Set(key string, val []byte) error
+	// Delete removes the value stored under key, returning ErrMissing if
+	// there is none.
+	Delete(key string) error
+	// Range calls fn for every key and value in the store until fn returns
+	// false.
+	Range(fn func(key string, val []byte) bool) error
+}
+
+// table is a map of keys to cached entries of one object type, being either a
+// shardMap or a Store.
+type table[T any] interface {
+	get(key string) (*T, bool)
+	peek(key string) (*T, bool)
+	set(key string, val *T) (evicted []string)
+	delete(key string) bool
+	deleteFunc(pred func(key string, val *T) bool) (removed []string)
+	clear() (removed []string)
+	len() int
+	walk(fn func(key string, val *T) bool)
+}
+
+// storeTable is a table stored in a Store, each key being prefixed by prefix.
+type storeTable[T any] struct {
+	store  Store
+	prefix string
+}
+
+func (s storeTable[T]) get(key string) (*T, bool) {
+	buf, err := s.store.Get(s.prefix + key)
+	if err != nil {
+		return nil, false
+	}
+
+	val := new(T)
+	if err := json.Unmarshal(buf, val); err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+func (s storeTable[T]) peek(key string) (*T, bool) {
+	return s.get(key)
+}
+
+// set stores val under key. As bounding is left to the Store, no keys are
+// ever reported as evicted.
+func (s storeTable[T]) set(key string, val *T) []string {
+	if buf, err := json.Marshal(val); err == nil {
+		s.store.Set(s.prefix+key, buf)
+	}
+
+	return nil
+}
+
+func (s storeTable[T]) delete(key string) bool {
+	return s.store.Delete(s.prefix+key) == nil
+}
+
+// deleteFunc decodes every entry of the table to test it against pred. Keys
+// are deleted once the walk completes, so the Store need not support deletion
+// from within Range.
+func (s storeTable[T]) deleteFunc(pred func(key string, val *T) bool) (removed []string) {
+	var keys []string
+	s.store.Range(func(key string, buf []byte) bool {
+		if !strings.HasPrefix(key, s.prefix) {
+			return true
+		}
+
+		val := new(T)
+		if err := json.Unmarshal(buf, val); err == nil && pred(key[len(s.prefix):], val) {
+			keys = append(keys, key[len(s.prefix):])
+		}
+		return true
+	})
+
+	for _, key := range keys {
+		if s.store.Delete(s.prefix+key) == nil {
+			removed = append(removed, key)
+		}
+	}
+	return removed
+}
+
+func (s storeTable[T]) clear() []string {
+	return s.deleteFunc(func(string, *T) bool { return true })
+}
+
+func (s storeTable[T]) len() int {
+	n := 0
+	s.store.Range(func(key string, _ []byte) bool {
+		if strings.HasPrefix(key, s.prefix) {
+			n++
+		}
+		return true
+	})
+
+	return n
+}
+
+// walk calls fn for every entry of the table which can be decoded, until fn
+// returns false.
+func (s storeTable[T]) walk(fn func(key string, val *T) bool) {
+	s.store.Range(func(key string, buf []byte) bool {
+		if !strings.HasPrefix(key, s.prefix) {
+			return true
+		}
+
+		val := new(T)
+		if err := json.Unmarshal(buf, val); err != nil {
+			return true
+		}
+		return fn(key[len(s.prefix):], val)
+	})
+}
+
+// entryJSON is the serialized form of an entry.
+type entryJSON[T any] struct {
+	Value    *T            `json:"value"`
+	Inserted time.Time     `json:"inserted"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+	Jitter   float64       `json:"jitter,omitempty"`
+}
+
+func (e entry[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(entryJSON[T]{Value: e.val, Inserted: e.inserted, TTL: e.ttl, Jitter: e.jitter})
+}
+
+func (e *entry[T]) UnmarshalJSON(buf []byte) error {
+	var j entryJSON[T]
+	if err := json.Unmarshal(buf, &j); err != nil {
+		return err
+	}
+	if j.Value == nil {
+		return errors.New("cache: entry has no value")
+	}
+
+	e.val, e.inserted, e.ttl, e.jitter = j.Value, j.Inserted, j.TTL, j.Jitter
+	return nil
+}
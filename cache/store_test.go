@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MapStore is a Store held in a plain map.
+type MapStore struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (s *MapStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	val, ok := s.m[key]
+	if !ok {
+		return nil, ErrMissing
+	}
+	return val, nil
+}
+
+func (s *MapStore) Set(key string, val []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.m == nil {
+		s.m = make(map[string][]byte)
+	}
+	s.m[key] = val
+	return nil
+}
+
+func (s *MapStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.m[key]; !ok {
+		return ErrMissing
+	}
+	delete(s.m, key)
+	return nil
+}
+
+func (s *MapStore) Range(fn func(key string, val []byte) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, val := range s.m {
+		if !fn(key, val) {
+			break
+		}
+	}
+	return nil
+}
+
+// BrokenStore is a Store which is always unavailable.
+type BrokenStore struct{}
+
+var errBroken = errors.New("store unavailable")
+
+func (BrokenStore) Get(key string) ([]byte, error)                   { return nil, errBroken }
+func (BrokenStore) Set(key string, val []byte) error                 { return errBroken }
+func (BrokenStore) Delete(key string) error                          { return errBroken }
+func (BrokenStore) Range(fn func(key string, val []byte) bool) error { return errBroken }
+
+func TestStore(t *testing.T) {
+	store := &MapStore{}
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	a := NewCache(p, WithStore(store))
+	b := NewCache(p, WithStore(store))
+
+	if _, err := a.Channel("1234"); err != nil {
+		t.Fatal("Unexpected error from channel retrieval:", err)
+	}
+	if _, err := a.Role("9101112", "1"); err != nil {
+		t.Fatal("Unexpected error from role retrieval:", err)
+	}
+	if _, ok := store.m["channel:1234"]; !ok {
+		t.Error("channel was not written to store")
+	}
+
+	// Lookups from another cache are served by the shared store
+	if c, err := b.Channel("1234"); err != nil || c.Name != "Testing Channel" {
+		t.Error("failed to retrieve channel from shared store:", err)
+	}
+	if r, err := b.Role("9101112", "2"); err != nil || r.Name != "Other Role" {
+		t.Error("failed to retrieve role from shared store:", err)
+	}
+	if p.calls != 2 {
+		t.Errorf("wrong number of provider calls\nexpect: 2\ngot: %d", p.calls)
+	}
+	if n := b.Stats().Channel.Entries; n != 1 {
+		t.Errorf("wrong channel entry count\nexpect: 1\ngot: %d", n)
+	}
+
+	if err := b.InvalidateChannel("1234"); err != nil {
+		t.Error("Unexpected error from channel invalidation:", err)
+	}
+	if _, ok := a.channels.get("1234"); ok {
+		t.Error("invalidation was not shared through store")
+	}
+
+	// Clean expires entries in the store
+	a = NewCache(p, WithStore(store), WithTTL(TypeRole, time.Minute))
+	store.Set("roles:9101112", []byte(`{"value":{},"inserted":"2000-01-01T00:00:00Z"}`))
+	a.Clean()
+	if _, ok := store.m["roles:9101112"]; ok {
+		t.Error("expired role set was not removed from store")
+	}
+}
+
+func TestStoreUnavailable(t *testing.T) {
+	c := NewCache(MockProvider{}, WithStore(BrokenStore{}))
+	for i := 0; i < 2; i++ {
+		if ch, err := c.Channel("1234"); err != nil || ch.Name != "Testing Channel" {
+			t.Error("lookup failed with unavailable store:", err)
+		}
+	}
+	if s := c.Stats().Channel; s.Misses != 2 || s.Entries != 0 {
+		t.Errorf("wrong stats with unavailable store: %+v", s)
+	}
+}
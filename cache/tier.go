@@ -0,0 +1,116 @@
+package cache
+
+import "os"
+
+// tiered returns true if the attachment cache is split into a hot tier held
+// in memory and a cold tier backed by disk (see WithHotAttachmentBytes).
+func (c *Cache) tiered() bool {
+	return c.attachmentDir != "" && c.hotAttachmentBytes > 0
+}
+
+// holdInMemory prepares the content of a to be held in memory, compressing it
+// if configured (see WithCompression).
+func (c *Cache) holdInMemory(a *Attachment) {
+	if c.compressThreshold > 0 && int64(len(a.Content)) >= c.compressThreshold {
+		if buf, ok := compress(a.Content); ok {
+			a.Content, a.compressed, a.size = buf, true, int64(len(a.Content))
+		}
+	}
+}
+
+// tierMove is a change of tier of the cached attachment orig under key, such
+// that it is replaced by cp if it is still cached once the content of cp has
+// been read or written.
+type tierMove struct {
+	key  string
+	orig *Attachment
+	cp   Attachment
+}
+
+// tierAttachments promotes the attachments of the cold tier referenced since
+// the last call into the hot tier, then demotes the least recently referenced
+// attachments of the hot tier to the cold tier until the hot tier is within
+// its budget. Files are read and written without holding c.mu, so attachments
+// which change in the meantime are left as they are.
+func (c *Cache) tierAttachments() {
+	if !c.tiered() {
+		return
+	}
+
+	c.mu.Lock()
+	var promote []tierMove
+	for key := range c.promote {
+		if a, ok := c.attachmentCache[key]; ok && a.Path != "" {
+			promote = append(promote, tierMove{key, a, *a})
+		}
+	}
+	c.promote = make(map[string]bool)
+	c.mu.Unlock()
+
+	for i := range promote {
+		m := &promote[i]
+		buf, err := os.ReadFile(m.cp.Path)
+		if err != nil {
+			m.orig = nil
+			continue
+		}
+		m.cp.Content, m.cp.Path, m.cp.size = buf, "", 0
+		c.holdInMemory(&m.cp)
+	}
+
+	c.mu.Lock()
+	for i := range promote {
+		m := &promote[i]
+		// Replacing the attachment deletes its backing file
+		if m.orig != nil && c.attachmentCache[m.key] == m.orig {
+			c.insertAttachment(m.key, &m.cp)
+		}
+	}
+
+	var demote []tierMove
+	held := c.attachmentMemory
+	c.byReference.ascend(func(a *Attachment) bool {
+		if held <= c.hotAttachmentBytes {
+			return false
+		}
+		if a.Path == "" {
+			demote = append(demote, tierMove{a.key, a, *a})
+			held -= a.memory()
+		}
+		return true
+	})
+	c.mu.Unlock()
+
+	for i := range demote {
+		m := &demote[i]
+		content := m.cp.Content
+		if m.cp.compressed {
+			buf, err := decompress(content)
+			if err != nil {
+				m.orig = nil
+				continue
+			}
+			content = buf
+		}
+		path, err := c.writeAttachment(m.key, content)
+		if err != nil {
+			m.orig = nil
+			continue
+		}
+		m.cp.Content, m.cp.Path, m.cp.size, m.cp.compressed = nil, path, int64(len(content)), false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range demote {
+		m := &demote[i]
+		if m.orig == nil {
+			continue
+		}
+		if c.attachmentCache[m.key] == m.orig {
+			c.insertAttachment(m.key, &m.cp)
+		} else if cur, ok := c.attachmentCache[m.key]; !ok || cur.Path != m.cp.Path {
+			os.Remove(m.cp.Path)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestTieredAttachments(t *testing.T) {
+	clock := NewFakeClock()
+	c := NewCache(MockProvider{}, WithClock(clock),
+		WithAttachmentDir(t.TempDir()), WithHotAttachmentBytes(1000))
+
+	content := map[string][]byte{
+		"1": bytes.Repeat([]byte("1"), 600),
+		"2": bytes.Repeat([]byte("2"), 600),
+		"3": bytes.Repeat([]byte("3"), 600),
+	}
+	for _, url := range []string{"1", "2", "3"} {
+		c.AddAttachment(url, url, "", content[url])
+		clock.Advance(time.Second)
+	}
+
+	// New attachments are held in memory until the next clean
+	if u := c.MemoryUsage(); u.Attachments != 1800 {
+		t.Errorf("wrong hot tier usage before clean\nexpect: 1800\ngot: %d", u.Attachments)
+	}
+
+	tiers := func() map[string]bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		onDisk := make(map[string]bool)
+		for url, a := range c.attachmentCache {
+			if a.Path != "" {
+				if _, err := os.Stat(a.Path); err != nil {
+					t.Errorf("%s: backing file missing: %v", url, err)
+				}
+				onDisk[url] = true
+			}
+		}
+		return onDisk
+	}
+
+	c.Clean()
+	if got := tiers(); len(got) != 2 || !got["1"] || !got["2"] {
+		t.Errorf("wrong attachments demoted\nexpect: map[1:true 2:true]\ngot: %v", got)
+	}
+	if u := c.MemoryUsage(); u.Attachments != 600 {
+		t.Errorf("wrong hot tier usage after clean\nexpect: 600\ngot: %d", u.Attachments)
+	}
+
+	// Lookups are served from the cold tier, then promoted by the next clean
+	clock.Advance(time.Second)
+	a, err := c.Attachment(&discordgo.MessageAttachment{URL: "1"})
+	if err != nil || !bytes.Equal(a.Content, content["1"]) {
+		t.Errorf("wrong content from cold tier: %v", err)
+	}
+
+	c.Clean()
+	if got := tiers(); len(got) != 2 || !got["2"] || !got["3"] {
+		t.Errorf("wrong attachments demoted after promotion\nexpect: map[2:true 3:true]\ngot: %v", got)
+	}
+	if n := c.AttachmentLen(); n != 3 {
+		t.Errorf("wrong attachment count after tiering\nexpect: 3\ngot: %d", n)
+	}
+}
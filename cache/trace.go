@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the OpenTelemetry tracer creating the spans of the
+// cache.
+const tracerName = "github.com/ethanv2/disdup/cache"
+
+// spanNames are the names of the spans around provider calls and downloads
+// for each object type.
+var spanNames = map[ObjectType]string{
+	TypeChannel:    "cache.Channel",
+	TypeUser:       "cache.User",
+	TypeGuild:      "cache.Guild",
+	TypeAttachment: "cache.Attachment",
+	TypeMember:     "cache.Member",
+	TypeRole:       "cache.Role",
+	TypeEmoji:      "cache.Emoji",
+	TypeSticker:    "cache.Sticker",
+	TypeMessage:    "cache.Message",
+	TypeHistory:    "cache.RecentMessages",
+}
+
+// startSpan starts a span for a lookup of the object id of type t which missed
+// the cache, as a child of the span in ctx. The tracer is taken from the span
+// in ctx, so if ctx carries no recording span, no span is started and the
+// returned span is nil. Checking for this before building any attributes
+// means untraced lookups do not allocate.
+func startSpan(ctx context.Context, t ObjectType, id string) (context.Context, trace.Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.IsRecording() {
+		return ctx, nil
+	}
+
+	tracer := parent.TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, spanNames[t], trace.WithAttributes(
+		attribute.String("cache.type", t.String()),
+		attribute.String("cache.id", id),
+		attribute.Bool("cache.hit", false),
+	))
+}
+
+// endSpan ends span, recording err if non-nil. A nil span is ignored.
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
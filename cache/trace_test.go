@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+
+	c := NewCache(MockProvider{})
+	c.ChannelContext(ctx, "1234")
+	c.ChannelContext(ctx, "1234")
+	c.UserContext(ctx, "0")
+	root.End()
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("wrong number of spans\nexpect: 3\ngot: %d", len(spans))
+	}
+	if spans[0].Name() != "cache.Channel" || spans[0].Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("channel miss was not traced as a child span")
+	}
+	if spans[1].Name() != "cache.User" || len(spans[1].Events()) == 0 {
+		t.Error("failed user lookup did not record its error")
+	}
+
+	// Lookups without a span are not traced
+	c.User("5678")
+	if n := len(rec.Ended()); n != 3 {
+		t.Errorf("untraced lookup created spans\nexpect: 3\ngot: %d", n)
+	}
+}
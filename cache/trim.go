@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"unsafe"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// EstimateGuildSize returns a rough estimate, in bytes, of the memory held by
+// g: its fixed size, the fixed size of each object in its slices and the
+// length of the names and topics of its roles, channels and emojis. Memory
+// shared with other objects, or referenced more deeply, is not counted.
+func EstimateGuildSize(g *discordgo.Guild) int64 {
+	n := int64(unsafe.Sizeof(*g)) + int64(len(g.Name)+len(g.Description))
+	for _, r := range g.Roles {
+		n += int64(unsafe.Sizeof(*r)) + int64(len(r.Name))
+	}
+	for _, ch := range g.Channels {
+		n += int64(unsafe.Sizeof(*ch)) + int64(len(ch.Name)+len(ch.Topic))
+	}
+	for _, ch := range g.Threads {
+		n += int64(unsafe.Sizeof(*ch)) + int64(len(ch.Name))
+	}
+	for _, e := range g.Emojis {
+		n += int64(unsafe.Sizeof(*e)) + int64(len(e.Name))
+	}
+	for _, st := range g.Stickers {
+		n += int64(unsafe.Sizeof(*st)) + int64(len(st.Name)+len(st.Description))
+	}
+	for _, m := range g.Members {
+		n += int64(unsafe.Sizeof(*m)) + int64(len(m.Nick))
+		if m.User != nil {
+			n += int64(unsafe.Sizeof(*m.User))
+		}
+	}
+	n += int64(len(g.Presences)) * int64(unsafe.Sizeof(discordgo.Presence{}))
+	n += int64(len(g.VoiceStates)) * int64(unsafe.Sizeof(discordgo.VoiceState{}))
+
+	return n
+}
+
+// TrimGuildState is the default trimming function of WithMaxGuildBytes. It
+// strips the members, presences and voice states of g, which are only sent
+// with the guild over the gateway and are cached separately, if at all.
+func TrimGuildState(g *discordgo.Guild) {
+	g.Members, g.Presences, g.VoiceStates = nil, nil, nil
+}
+
+// GuildSize returns the estimated size of the cached guild ID, as by
+// EstimateGuildSize, and whether it is cached. The guild is not looked up if
+// it is not cached, and the lookup is not counted in the guild stats.
+func (c *Cache) GuildSize(ID string) (int64, bool) {
+	e, ok := c.guilds.peek(ID)
+	if !ok || e.expired(c.now(), c.guilds.ttl) {
+		return 0, false
+	}
+
+	return EstimateGuildSize(e.val), true
+}
+
+// trimGuild trims g if its estimated size exceeds the guild byte threshold
+// (see WithMaxGuildBytes).
+func (c *Cache) trimGuild(g *discordgo.Guild) {
+	if EstimateGuildSize(g) > c.maxGuildBytes {
+		c.guildTrim(g)
+	}
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMaxGuildBytes(t *testing.T) {
+	large := &discordgo.Guild{
+		ID:    "1",
+		Name:  "Large Guild",
+		Roles: []*discordgo.Role{{ID: "1", Name: "Role"}},
+	}
+	for i := 0; i < 100; i++ {
+		large.Members = append(large.Members, &discordgo.Member{
+			GuildID: "1",
+			User:    &discordgo.User{ID: strconv.Itoa(i)},
+		})
+	}
+	small := &discordgo.Guild{
+		ID:      "2",
+		Name:    "Small Guild",
+		Members: []*discordgo.Member{{GuildID: "2", User: &discordgo.User{ID: "1"}}},
+	}
+	limit := EstimateGuildSize(small)
+
+	c := NewCache(MockProvider{}, WithMaxGuildBytes(limit, nil))
+	c.SeedGuild(large)
+	c.SeedGuild(small)
+
+	g, err := c.Guild("1")
+	if err != nil {
+		t.Fatal("Unexpected error from guild lookup:", err)
+	}
+	if len(g.Members) != 0 || len(g.Roles) != 1 {
+		t.Errorf("large guild trimmed wrongly\nexpect: 0 members, 1 role\ngot: %d members, %d roles",
+			len(g.Members), len(g.Roles))
+	}
+	if len(large.Members) != 100 {
+		t.Error("trimming modified the seeded guild")
+	}
+	if size, ok := c.GuildSize("1"); !ok || size >= EstimateGuildSize(large) {
+		t.Errorf("wrong size of trimmed guild\nexpect: less than %d\ngot: %d (cached %v)",
+			EstimateGuildSize(large), size, ok)
+	}
+	if g, _ := c.Guild("2"); len(g.Members) != 1 {
+		t.Errorf("small guild was trimmed\nexpect: 1 member\ngot: %d", len(g.Members))
+	}
+	if _, ok := c.GuildSize("3"); ok {
+		t.Error("size reported for uncached guild")
+	}
+
+	// Callers may choose what to trim
+	c = NewCache(MockProvider{}, WithMaxGuildBytes(limit, func(g *discordgo.Guild) {
+		g.Roles = nil
+	}))
+	c.SeedGuild(large)
+	if g, _ := c.Guild("1"); len(g.Members) != 100 || len(g.Roles) != 0 {
+		t.Errorf("guild trimmed wrongly by custom trim\nexpect: 100 members, 0 roles\ngot: %d members, %d roles",
+			len(g.Members), len(g.Roles))
+	}
+}
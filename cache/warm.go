@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// Default rate limit of WarmUsers (see WithWarmRate).
+const (
+	DefaultWarmRate  rate.Limit = 10
+	DefaultWarmBurst            = DefaultBatchConcurrency
+)
+
+// WarmGuild prefetches and caches the guild guildID, followed by every channel
+// and role of the guild, such that later lookups of any of them are served from
+// the cache. This is useful on joining a guild, for example on a GuildCreate
+// event, in place of looking each object up individually. The channels and
+// roles are fetched concurrently, bounded as in the batch lookup methods (see
+// WithBatchConcurrency). The first error encountered is returned, or nil once
+// everything is cached. The provider must be able to look up the channels and
+// roles of a guild (see GuildChannelsProvider and RoleProvider), or
+// ErrUnsupported is returned.
+func (c *Cache) WarmGuild(ctx context.Context, guildID string) error {
+	if _, err := c.GuildContext(ctx, guildID); err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	if c.batchConcurrency > 0 {
+		g.SetLimit(c.batchConcurrency)
+	}
+
+	g.Go(func() error {
+		v, err := c.doContext(ctx, "channels:"+guildID, func(ctx context.Context) (interface{}, error) {
+			return fetchGuildChannels(ctx, c.provider, guildID)
+		})
+		if err != nil {
+			return err
+		}
+
+		c.SeedChannels(v.([]*discordgo.Channel))
+		return nil
+	})
+	g.Go(func() error {
+		_, err := c.guildRoles(ctx, guildID)
+		return err
+	})
+
+	return g.Wait()
+}
+
+// A WarmSummary is the outcome of warming the cache with WarmUsers.
+type WarmSummary struct {
+	// Succeeded is the number of objects fetched and cached.
+	Succeeded int
+	// Failed is the number of objects which could not be fetched.
+	Failed int
+	// Skipped is the number of objects which were already cached.
+	Skipped int
+}
+
+// WarmUsers prefetches and caches every user in IDs, such as the known active
+// members of a guild on startup, skipping those already cached. The users are
+// fetched concurrently, bounded as in the batch lookup methods (see
+// WithBatchConcurrency), and at a limited rate (see WithWarmRate), so that a
+// large warmup does not trip Discord's rate limits or crowd out other lookups.
+// A user which cannot be fetched does not stop the rest from being fetched:
+// once every user has been tried, a summary of the outcome is returned along
+// with a LookupError of each failed user, if any. If ctx is done, or its
+// deadline would pass while waiting for the rate limit, the users not yet
+// fetched fail with the context's error.
+func (c *Cache) WarmUsers(ctx context.Context, IDs []string) (WarmSummary, error) {
+	var (
+		sum    WarmSummary
+		misses []string
+		seen   = make(map[string]bool, len(IDs))
+	)
+	for _, id := range IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if c.users.has(id) {
+			sum.Skipped++
+		} else {
+			misses = append(misses, id)
+		}
+	}
+
+	found, err := batch(ctx, c.batchConcurrency, misses, func(ctx context.Context, id string) (discordgo.User, error) {
+		if err := c.warmLimiter.Wait(ctx); err != nil {
+			// The limiter gives up early if the wait would outlast the
+			// deadline of ctx, with an error of its own
+			if ctx.Err() != nil {
+				return discordgo.User{}, ctx.Err()
+			} else if _, ok := ctx.Deadline(); ok {
+				return discordgo.User{}, context.DeadlineExceeded
+			}
+			return discordgo.User{}, err
+		}
+		return c.UserContext(ctx, id)
+	})
+	sum.Succeeded = len(found)
+	sum.Failed = len(misses) - len(found)
+
+	return sum, err
+}
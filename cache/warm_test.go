@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestWarmGuild(t *testing.T) {
+	p := &CountingProvider{release: make(chan struct{})}
+	close(p.release)
+	c := NewCache(p)
+
+	if err := c.WarmGuild(context.Background(), "9101112"); err != nil {
+		t.Fatal("Unexpected error from warming guild:", err)
+	}
+	if p.calls != 3 {
+		t.Errorf("wrong number of provider calls\nexpect: 3\ngot: %d", p.calls)
+	}
+
+	c.Guild("9101112")
+	c.Channel("1234")
+	c.Channel("4321")
+	c.Role("9101112", "1")
+	if p.calls != 3 {
+		t.Errorf("warmed lookups caused provider calls\nexpect: 3\ngot: %d", p.calls)
+	}
+
+	if err := c.WarmGuild(context.Background(), "missing"); err == nil {
+		t.Error("warming a missing guild succeeded")
+	}
+}
+
+func TestWarmUsers(t *testing.T) {
+	c := NewCache(MockProvider{}, WithWarmRate(50, 1))
+	c.SeedUsers([]*discordgo.User{{ID: "2"}})
+
+	start := time.Now()
+	sum, err := c.WarmUsers(context.Background(), []string{"5678", "5678", "1", "2", "3", "4", "5", "6"})
+	elapsed := time.Since(start)
+
+	expect := WarmSummary{Succeeded: 1, Failed: 5, Skipped: 1}
+	if sum != expect {
+		t.Errorf("wrong warm summary\nexpect: %+v\ngot: %+v", expect, sum)
+	}
+	var lerr LookupError
+	if !errors.As(err, &lerr) || len(lerr) != 5 || lerr["1"] == nil {
+		t.Errorf("wrong error from warming users\nexpect: lookup error of 5 IDs\ngot: %v", err)
+	}
+	if !c.users.has("5678") {
+		t.Error("warmed user was not cached")
+	}
+
+	// Six provider calls at 50 per second need at least 100ms
+	if elapsed < 80*time.Millisecond {
+		t.Errorf("warming was not rate limited\nexpect: at least 100ms\ngot: %v", elapsed)
+	}
+
+	// Users not yet fetched fail once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sum, err = c.WarmUsers(ctx, []string{"5678", "7"})
+	if expect := (WarmSummary{Failed: 1, Skipped: 1}); sum != expect {
+		t.Errorf("wrong warm summary after cancellation\nexpect: %+v\ngot: %+v", expect, sum)
+	}
+	if !errors.As(err, &lerr) || lerr["7"] != context.Canceled {
+		t.Errorf("wrong error after cancellation\nexpect: %v\ngot: %v", context.Canceled, err)
+	}
+
+	// As do users whose wait for the rate limit would outlast the deadline
+	c = NewCache(MockProvider{}, WithWarmRate(1, 1))
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second/2)
+	defer cancel()
+	_, err = c.WarmUsers(ctx, []string{"5678", "7"})
+	var deadline bool
+	if errors.As(err, &lerr) {
+		for _, err := range lerr {
+			deadline = deadline || err == context.DeadlineExceeded
+		}
+	}
+	if !deadline {
+		t.Errorf("wrong error past deadline\nexpect: %v\ngot: %v", context.DeadlineExceeded, err)
+	}
+}
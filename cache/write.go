@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"io"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// WriteAttachmentTo writes the content of the cached attachment at url to w,
+// returning the number of bytes written. Content held in memory is written
+// from the cache directly, without being copied, and content held on disk is
+// streamed from its file. Nothing is downloaded: if the attachment is not
+// cached, ErrMissing is returned (but see CopyAttachment).
+func (c *Cache) WriteAttachmentTo(w io.Writer, url string) (int64, error) {
+	if c.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	key := c.keyOfURL(url)
+	a, ok := c.cachedAttachment(key)
+	if !ok {
+		return 0, ErrMissing
+	}
+
+	return c.writeCached(w, key, a)
+}
+
+// CopyAttachment is like WriteAttachmentTo, but if the attachment at is not
+// cached, it is downloaded from the Discord CDN with ctx and written to w as it
+// is read, while also being inserted into the cache, such that the caller is
+// served and the cache populated in a single pass. Like AttachmentStream, the
+// download is not shared with concurrent lookups. If the download fails, the
+// attachment is not cached, although some of its content may already have been
+// written to w.
+func (c *Cache) CopyAttachment(ctx context.Context, w io.Writer, at *discordgo.MessageAttachment) (int64, error) {
+	if c.closed.Load() {
+		return 0, ErrClosed
+	}
+	if c.disabled[TypeAttachment] {
+		return 0, ErrUnsupported
+	}
+
+	key := c.keyOf(at)
+	if a, ok := c.cachedAttachment(key); ok {
+		a = c.revalidate(ctx, at, a)
+		if n, err := c.writeCached(w, key, a); err != ErrMissing {
+			return n, err
+		}
+	}
+	c.noteMiss(TypeAttachment, key)
+
+	r, err := c.fetch(ctx, at, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Body.Close()
+
+	cw := &countingWriter{w: w}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(r.Body, cw), r.Body}
+	_, err = c.readAttachment(ctx, at, r)
+	return cw.n, err
+}
+
+// writeCached writes the content of a, the cached attachment under key, to w.
+// If the backing file of a has been lost, the attachment is forgotten and
+// ErrMissing is returned. If the content is found to be corrupt once written,
+// the attachment is forgotten and ErrCorrupt is returned.
+func (c *Cache) writeCached(w io.Writer, key string, a Attachment) (int64, error) {
+	rc, err := c.openCached(key, a)
+	if err != nil {
+		c.discardAttachment(key, err)
+		return 0, ErrMissing
+	}
+	defer rc.Close()
+	c.noteHit(TypeAttachment, key)
+
+	return io.Copy(w, rc)
+}
+
+// countingWriter is a writer which counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestWriteAttachmentTo(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("content"))
+	}))
+	defer srv.Close()
+
+	at := &discordgo.MessageAttachment{URL: srv.URL + "/a.png"}
+	c := NewCache(MockProvider{})
+
+	var buf bytes.Buffer
+	if _, err := c.WriteAttachmentTo(&buf, at.URL); err != ErrMissing {
+		t.Errorf("wrong error for uncached attachment\nexpect: %v\ngot: %v", ErrMissing, err)
+	}
+
+	// Downloads are written while being cached
+	n, err := c.CopyAttachment(context.Background(), &buf, at)
+	if err != nil || n != int64(len("content")) || buf.String() != "content" {
+		t.Fatalf("failed to copy downloaded attachment: %v (%d bytes: %s)", err, n, buf.String())
+	}
+	if !c.HasAttachment(at.URL) {
+		t.Error("copied attachment was not cached")
+	}
+
+	buf.Reset()
+	if n, err := c.WriteAttachmentTo(&buf, at.URL); err != nil || n != int64(len("content")) || buf.String() != "content" {
+		t.Errorf("failed to write cached attachment: %v (%d bytes: %s)", err, n, buf.String())
+	}
+	buf.Reset()
+	if _, err := c.CopyAttachment(context.Background(), &buf, at); err != nil || buf.String() != "content" {
+		t.Error("failed to copy cached attachment:", err)
+	}
+	if hits != 1 {
+		t.Errorf("wrong number of downloads\nexpect: 1\ngot: %d", hits)
+	}
+}
@@ -64,7 +64,7 @@ func NewDuplicator(conf config.Config) (Duplicator, error) {
 		discordgo.IntentMessageContent | discordgo.IntentDirectMessages | discordgo.IntentGuilds
 
 	// Set up cache based on current discord session
-	dup.cache = cache.NewCache(dup.conn)
+	dup.cache = cache.NewCache(cache.NewSessionProvider(dup.conn))
 
 	// Event handling.
 	// Discordgo automatically dispatches events to the correct handler